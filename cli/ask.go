@@ -0,0 +1,182 @@
+// ask.go: "tmuxai ask" subcommand to run one request without the chat interface
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/internal"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	noInteractive bool
+	askApprove    string
+	askOutput     string
+)
+
+var askCmd = &cobra.Command{
+	Use:   "ask [request message]",
+	Short: "Run one request without the chat and print the answer",
+	Long: `Run one request to completion with the panes of the current tmux window as context,
+print the final answer to stdout and exit. Progress goes to stderr. The request is read
+from the arguments, --file or stdin. Input piped next to a request in the arguments is
+attached as a document, and files mentioned as @path are attached too.
+
+Nobody is asked to confirm actions, --approve decides them:
+  none    nothing runs, the AI can only answer
+  policy  only commands approved by whitelist_patterns and the policy run (default)
+  all     everything runs but privileged, destructive and irreversible commands
+          and commands run through an expansion, e.g. bash -c "$CMD"
+
+Exit codes:
+  0    accomplished
+  1    error
+  3    the AI is waiting for an answer
+  4    an action was rejected by the approval policy
+  5    stopped at a limit
+  130  cancelled
+
+Examples:
+  tmuxai ask why did the last command fail
+  git diff | tmuxai ask --approve none
+  make 2>&1 | tmuxai ask why did this fail
+  tmuxai ask --approve none explain @go.mod
+  tmuxai ask --approve policy --output json run the tests and summarize failures`,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runAsk(args))
+	},
+}
+
+// runAsk runs a headless request and returns the exit code
+func runAsk(args []string) int {
+	message, piped, err := askMessage(args)
+	if err != nil {
+		return askFailed("%v", err)
+	}
+	return runHeadless(message, piped, "")
+}
+
+// askFailed reports an error of a headless run and returns its exit code
+func askFailed(format string, a ...any) int {
+	logger.Error(format, a...)
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	return internal.HeadlessError.ExitCode()
+}
+
+// runHeadless runs message with --approve and --output, attaching piped input and
+// using model when set, and returns the exit code
+func runHeadless(message string, piped []byte, model string) int {
+	// keep stdout for the answer, everything printed along the way goes to stderr
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	color.Output = os.Stderr
+	fail := askFailed
+
+	if askOutput != "text" && askOutput != "json" {
+		return fail("Invalid --output %q, use text or json", askOutput)
+	}
+	approve, err := internal.ParseHeadlessApprove(askApprove)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fail("Error loading configuration: %v", err)
+	}
+	mgr, err := internal.NewHeadlessManager(cfg, approve)
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer mgr.Shutdown()
+	if model != "" {
+		mgr.SessionOverrides["openrouter.model"] = model
+	}
+	if piped != nil {
+		if err := mgr.AttachContent("stdin", piped); err != nil {
+			return fail("Error attaching stdin: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+	result := mgr.RunHeadless(ctx, message)
+
+	if askOutput == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return fail("%v", err)
+		}
+	} else {
+		if result.Answer != "" {
+			fmt.Fprintln(stdout, result.Answer)
+		}
+		if result.Error != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", result.Status, result.Error)
+		}
+	}
+	return result.ExitCode
+}
+
+// askMessage returns the request from the arguments, --file or stdin when it is not a terminal.
+// When the request is given otherwise, input piped to stdin is returned to be attached.
+func askMessage(args []string) (message string, piped []byte, err error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		if piped, err = io.ReadAll(os.Stdin); err != nil {
+			return "", nil, fmt.Errorf("error reading stdin: %w", err)
+		}
+		if len(bytes.TrimSpace(piped)) == 0 {
+			piped = nil
+		}
+	}
+
+	switch {
+	case len(args) > 0:
+		return strings.Join(args, " "), piped, nil
+	case taskFileFlag != "":
+		content, err := internal.RenderTaskFile(taskFileFlag)
+		if err != nil {
+			return "", nil, fmt.Errorf("error reading task file: %w", err)
+		}
+		return content, piped, nil
+	case piped != nil:
+		return strings.TrimSpace(string(piped)), nil, nil
+	}
+	return "", nil, fmt.Errorf("no request given, pass it as arguments, with --file or on stdin")
+}
+
+// addAskFlags adds the flags of a headless run, shared by ask and tmuxai --no-interactive
+func addAskFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&askApprove, "approve", string(internal.HeadlessApprovePolicy), "Approval policy for actions: none, policy or all")
+	cmd.Flags().StringVarP(&askOutput, "output", "o", "text", "Output format: text or json")
+}
+
+// checkAskFlags refuses --approve and --output without --no-interactive, the chat would
+// silently ignore them
+func checkAskFlags(cmd *cobra.Command) error {
+	for _, name := range []string{"approve", "output"} {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%s only applies with --no-interactive or tmuxai ask", name)
+		}
+	}
+	return nil
+}
+
+func init() {
+	askCmd.Flags().StringVarP(&taskFileFlag, "file", "f", "", "Read request from specified file")
+	addAskFlags(askCmd)
+	rootCmd.AddCommand(askCmd)
+}
@@ -0,0 +1,132 @@
+// audit.go: "tmuxai audit" subcommand to query the audit log
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditFilter internal.AuditFilter
+	auditSince  string
+	auditLimit  int
+	auditJSON   bool
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show commands, keys and pastes sent to panes",
+	Long: `Show the audit log of every command, keystroke and paste TmuxAI sent to a pane,
+with how it was approved and its outcome.
+
+Examples:
+  tmuxai audit --since 24h --approval rejected
+  tmuxai audit --session 20250101-120000 --json
+  tmuxai audit --action exec --grep kubectl --limit 20`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("error loading configuration: %w", err)
+		}
+
+		if auditSince != "" {
+			since, err := parseSince(auditSince)
+			if err != nil {
+				return err
+			}
+			auditFilter.Since = since
+		}
+
+		path, err := internal.AuditLogPath(cfg)
+		if err != nil {
+			return err
+		}
+		entries, err := internal.ReadAuditLog(path, auditFilter)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "No audit log at %s\n", path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if auditLimit > 0 && len(entries) > auditLimit {
+			entries = entries[len(entries)-auditLimit:]
+		}
+
+		if auditJSON {
+			enc := json.NewEncoder(os.Stdout)
+			for _, entry := range entries {
+				if err := enc.Encode(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tSESSION\tPANE\tACTION\tAPPROVAL\tSTATUS\tRISK\tEXIT\tDURATION\tTEXT")
+		for _, entry := range entries {
+			exit := "-"
+			if entry.ExitCode != nil {
+				exit = fmt.Sprintf("%d", *entry.ExitCode)
+			}
+			text := entry.Text
+			if entry.EditedText != "" {
+				text = entry.EditedText + " (edited from: " + entry.Text + ")"
+			}
+			pane := entry.PaneId
+			if entry.Host != "" {
+				pane += "@" + entry.Host
+			}
+			risk := entry.Risk
+			if risk == "" {
+				risk = "-"
+			}
+			status := entry.Status
+			if status == "" {
+				status = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.Time.Local().Format("2006-01-02 15:04:05"), entry.SessionId, pane, entry.Action,
+				entry.Approval, status, risk, exit, time.Duration(entry.DurationMs)*time.Millisecond,
+				strings.ReplaceAll(text, "\n", "\\n"))
+		}
+		return w.Flush()
+	},
+}
+
+// parseSince accepts a duration ago ("24h", "30m") or a date ("2006-01-02", RFC 3339)
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q, use a duration like 24h or a date like 2006-01-02", value)
+}
+
+func init() {
+	auditCmd.Flags().StringVar(&auditFilter.SessionId, "session", "", "Only show entries of this session id")
+	auditCmd.Flags().StringVar(&auditFilter.PaneId, "pane", "", "Only show entries for this pane id, e.g. %3")
+	auditCmd.Flags().StringVar(&auditFilter.Host, "host", "", "Only show entries sent to this remote host")
+	auditCmd.Flags().StringVar(&auditFilter.Action, "action", "", "Only show this action: exec, send_keys or paste")
+	auditCmd.Flags().StringVar(&auditFilter.Approval, "approval", "", "Only show this approval: auto_approved, session_rule, no_confirm, confirmed, always, edited, headless or rejected")
+	auditCmd.Flags().StringVar(&auditFilter.Contains, "grep", "", "Only show entries whose text contains this string")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "Only show entries newer than a duration (24h) or date (2006-01-02)")
+	auditCmd.Flags().IntVarP(&auditLimit, "limit", "n", 0, "Only show the last n matching entries")
+	auditCmd.Flags().BoolVar(&auditJSON, "json", false, "Print matching entries as JSON lines")
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,94 @@
+// auth.go: "tmuxai auth" subcommands to keep the API key in the OS keyring
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Store the API key in the OS keyring",
+	Long: `Store the API key in the OS keyring instead of the config file: the Secret Service
+API through secret-tool on Linux (GNOME Keyring, KeePassXC, KWallet), the login keychain
+on macOS.
+
+The keyring is used when the configuration sets none of openrouter.api_key,
+api_key_cmd and api_key_file, nor TMUXAI_OPENROUTER_API_KEY.`,
+}
+
+var authSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Store the API key in the keyring, read from the terminal or stdin",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var key string
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Print("API key: ")
+			input, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			if err != nil {
+				return err
+			}
+			key = string(input)
+		} else {
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			key = line
+		}
+		if key = strings.TrimSpace(key); key == "" {
+			return fmt.Errorf("no API key given")
+		}
+		if err := system.KeyringSet(config.KeyringService, config.KeyringAccount, config.KeyringLabel, key); err != nil {
+			return fmt.Errorf("failed to store the API key: %w", err)
+		}
+		fmt.Println("Stored the API key in the keyring")
+		if source := configuredAPIKeySource(); source != "" {
+			fmt.Printf("It is not used while %s is set, remove it to use the keyring\n", source)
+		}
+		return nil
+	},
+}
+
+var authRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove the API key from the keyring",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := system.KeyringDelete(config.KeyringService, config.KeyringAccount); err != nil {
+			return fmt.Errorf("failed to remove the API key: %w", err)
+		}
+		fmt.Println("Removed the API key from the keyring")
+		return nil
+	},
+}
+
+// configuredAPIKeySource returns the key of the configuration taking precedence over the
+// keyring, if any
+func configuredAPIKeySource() string {
+	cfg, err := config.LoadUnvalidated()
+	if err != nil {
+		return ""
+	}
+	switch {
+	case cfg.OpenRouter.APIKey != "":
+		return "openrouter.api_key (" + cfg.SourceFile("openrouter.api_key") + ")"
+	case cfg.OpenRouter.APIKeyCmd != "":
+		return "openrouter.api_key_cmd"
+	case cfg.OpenRouter.APIKeyFile != "":
+		return "openrouter.api_key_file"
+	}
+	return ""
+}
+
+func init() {
+	authCmd.AddCommand(authSetCmd, authRemoveCmd)
+	rootCmd.AddCommand(authCmd)
+}
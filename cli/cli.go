@@ -16,6 +16,8 @@ import (
 var (
 	initMessage  string
 	taskFileFlag string
+	modelFlag    string
+	setFlags     []string
 )
 
 var rootCmd = &cobra.Command{
@@ -27,8 +29,19 @@ var rootCmd = &cobra.Command{
 			fmt.Printf("tmuxai version: %s\ncommit: %s\nbuild date: %s\n", internal.Version, internal.Commit, internal.Date)
 			os.Exit(0)
 		}
+		if err := setConfigFlags(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		if noInteractive {
+			os.Exit(runAsk(args))
+		}
+		if err := checkAskFlags(cmd); err != nil {
+			os.Exit(askFailed("Error: %v", err))
+		}
+
 		cfg, err := config.Load()
 		if err != nil {
 			logger.Error("Error loading configuration: %v", err)
@@ -41,13 +54,13 @@ var rootCmd = &cobra.Command{
 		}
 
 		if taskFileFlag != "" {
-			content, err := os.ReadFile(taskFileFlag)
+			content, err := internal.RenderTaskFile(taskFileFlag)
 			if err != nil {
 				logger.Error("Error reading task file: %v", err)
 				fmt.Fprintf(os.Stderr, "Error reading task file: %v\n", err)
 				os.Exit(1)
 			}
-			initMessage = string(content)
+			initMessage = content
 			logger.Info("Read request from file: %s", taskFileFlag)
 		}
 
@@ -70,6 +83,29 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.Flags().StringVarP(&taskFileFlag, "file", "f", "", "Read request from specified file")
 	rootCmd.Flags().BoolP("version", "v", false, "Print version information")
+	rootCmd.Flags().BoolVar(&noInteractive, "no-interactive", false, "Run the request without the chat like tmuxai ask, print the answer and exit")
+	rootCmd.PersistentFlags().StringVar(&modelFlag, "model", "", "Model to use, overrides openrouter.model of the configuration")
+	rootCmd.PersistentFlags().StringArrayVar(&setFlags, "set", nil, "Set a config key, key=value, repeatable, e.g. --set limits.max_steps=10")
+	addAskFlags(rootCmd)
+}
+
+// setConfigFlags passes --model and --set to the flag layer of the configuration
+func setConfigFlags() error {
+	values := make(map[string]string)
+	for _, set := range setFlags {
+		key, value, ok := strings.Cut(set, "=")
+		if !ok {
+			return fmt.Errorf("--set %s: expected key=value", set)
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	if modelFlag != "" {
+		values["openrouter.model"] = modelFlag
+	}
+	if err := config.SetFlagValues(values); err != nil {
+		return fmt.Errorf("--set: %w", err)
+	}
+	return nil
 }
 
 func Execute() error {
@@ -0,0 +1,230 @@
+// config.go: "tmuxai config" subcommands to check and create the configuration
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/internal"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	doctorEndpoint string
+	initForce      bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Check or create the configuration",
+}
+
+var configDoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration, tmux, the API key, the provider and the shell",
+	Long: `Check the configuration file for unknown keys and invalid values, and what TmuxAI
+needs around it: tmux, the API key, a request to the provider and a shell /prepare supports.
+
+The provider is checked with a GET request with the API key, to the key endpoint of
+OpenRouter or the models list of other providers. --endpoint requests another URL.
+
+Exits with 1 when a check fails.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadUnvalidated()
+		if err == nil {
+			if errs := config.Validate(cfg); errs != nil {
+				err = errs
+			}
+		}
+
+		failed := false
+		for _, check := range internal.Doctor(context.Background(), cfg, err, doctorEndpoint) {
+			var mark string
+			switch check.Status {
+			case internal.DoctorOK:
+				mark = color.GreenString("✓")
+			case internal.DoctorWarning:
+				mark = color.YellowString("!")
+			default:
+				mark = color.RedString("✗")
+				failed = true
+			}
+			fmt.Printf("%s %-9s %s\n", mark, check.Name, check.Detail)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create ~/.config/tmuxai/config.yaml by answering a few questions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := config.GetConfigFilePath("config.yaml")
+		if _, err := os.Stat(path); err == nil && !initForce {
+			return fmt.Errorf("%s already exists, use --force to replace it", path)
+		}
+
+		answers, err := askConfigQuestions(bufio.NewReader(os.Stdin), os.Stdout)
+		if err != nil {
+			return err
+		}
+		if answers.Keyring {
+			if err := system.KeyringSet(config.KeyringService, config.KeyringAccount, config.KeyringLabel, answers.APIKey); err != nil {
+				return fmt.Errorf("failed to store the API key in the keyring: %w", err)
+			}
+		}
+		var b strings.Builder
+		if err := configTemplate.Execute(&b, answers); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+		fmt.Printf("\nWrote %s, check it with: tmuxai config doctor\n", path)
+		return nil
+	},
+}
+
+// configAnswers are the answers of tmuxai config init
+type configAnswers struct {
+	Provider string
+	BaseURL  string
+	Region   string
+	Model    string
+	APIKey   string
+	Keyring  bool // APIKey is stored in the keyring instead of the config file
+	Confirm  bool
+}
+
+// providerDefaults are the base URL and model suggested for each provider
+var providerDefaults = map[string][2]string{
+	"openrouter": {"https://openrouter.ai/api/v1", config.DefaultConfig().OpenRouter.Model},
+	"openai":     {"https://api.openai.com/v1", "gpt-4o-mini"},
+	"bedrock":    {"", ""},
+	"other":      {"http://localhost:11434/v1", ""},
+}
+
+// askConfigQuestions asks for the provider, model, API key and confirmations
+func askConfigQuestions(in *bufio.Reader, out io.Writer) (configAnswers, error) {
+	ask := func(question, def string) (string, error) {
+		if def != "" {
+			fmt.Fprintf(out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(out, "%s: ", question)
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("no answer: %w", err)
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			return def, nil
+		}
+		return line, nil
+	}
+
+	var a configAnswers
+	var err error
+	for {
+		if a.Provider, err = ask("Provider (openrouter, openai, bedrock or other OpenAI compatible)", "openrouter"); err != nil {
+			return a, err
+		}
+		if _, ok := providerDefaults[a.Provider]; ok {
+			break
+		}
+		fmt.Fprintf(out, "Unknown provider %q\n", a.Provider)
+	}
+	defaults := providerDefaults[a.Provider]
+
+	if a.Provider == "bedrock" {
+		if a.Region, err = ask("AWS region", "us-west-2"); err != nil {
+			return a, err
+		}
+	} else if a.BaseURL, err = ask("Base URL", defaults[0]); err != nil {
+		return a, err
+	}
+	if a.Provider == "other" {
+		a.Provider = "openai"
+	}
+	for a.Model == "" {
+		if a.Model, err = ask("Model", defaults[1]); err != nil {
+			return a, err
+		}
+	}
+
+	if a.Provider != "bedrock" {
+		fmt.Fprint(out, "API key (leave empty to use TMUXAI_OPENROUTER_API_KEY or api_key_cmd): ")
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			key, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(out)
+			if err != nil {
+				return a, err
+			}
+			a.APIKey = strings.TrimSpace(string(key))
+		} else {
+			line, _ := in.ReadString('\n')
+			a.APIKey = strings.TrimSpace(line)
+		}
+		if a.APIKey != "" && system.KeyringAvailable() {
+			keyring, err := ask("Store the API key in the keyring instead of the config file? (yes/no)", "yes")
+			if err != nil {
+				return a, err
+			}
+			a.Keyring = !strings.HasPrefix(strings.ToLower(keyring), "n")
+		}
+	}
+
+	confirm, err := ask("Confirm commands, keys and pastes before they are sent to a pane? (yes/no)", "yes")
+	if err != nil {
+		return a, err
+	}
+	a.Confirm = !strings.HasPrefix(strings.ToLower(confirm), "n")
+	return a, nil
+}
+
+var configTemplate = template.Must(template.New("config").Funcs(template.FuncMap{
+	"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+}).Parse(`# TmuxAI configuration, created by tmuxai config init
+# See https://github.com/alvinunreal/tmuxai/blob/main/config.example.yaml for all settings
+
+exec_confirm: {{.Confirm}} # Confirm before executing commands
+send_keys_confirm: {{.Confirm}} # Confirm before executing send keys
+paste_multiline_confirm: {{.Confirm}} # Confirm before pasting multiline content
+
+openrouter:
+  provider: {{.Provider}}
+{{- if .BaseURL}}
+  base_url: {{quote .BaseURL}}
+{{- end}}
+{{- if .Region}}
+  region: {{.Region}}
+{{- end}}
+  model: {{quote .Model}}
+{{- if .Keyring}}
+  # the API key is in the keyring, see tmuxai auth
+{{- else if .APIKey}}
+  api_key: {{quote .APIKey}}
+{{- else if ne .Provider "bedrock"}}
+  # api_key_cmd: pass show openrouter # or api_key_file: ~/.config/tmuxai/api_key
+{{- end}}
+`))
+
+func init() {
+	configDoctorCmd.Flags().StringVar(&doctorEndpoint, "endpoint", "", "URL requested to check the provider")
+	configInitCmd.Flags().BoolVar(&initForce, "force", false, "Replace an existing config file")
+	configCmd.AddCommand(configDoctorCmd, configInitCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,124 @@
+// task.go: "tmuxai task" subcommands to list and run tasks of the task library
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/internal"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/spf13/cobra"
+)
+
+var taskVars []string
+
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "List and run saved tasks",
+	Long: `Tasks are saved requests in ~/.config/tmuxai/tasks and in .tmuxai/tasks of the
+current project, which override user tasks of the same name. A task is a Go text/template
+with optional YAML front-matter:
+
+  ---
+  description: Commit and push the current changes
+  vars: [remote]            # required, passed with --var remote=origin
+  defaults: {branch: main}  # optional
+  model: openai/gpt-4o-mini # preferred model
+  approve: policy           # approval policy with --no-interactive
+  ---
+  Do git diff, write a commit message and push to {{.remote}} {{.branch}}.
+
+Project tasks can not choose the model, and approve: all is capped at policy.`,
+}
+
+var taskListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tasks of the user and the current project",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := os.Getwd()
+		tasks, err := internal.LoadTasks(dir)
+		if err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			fmt.Fprintln(os.Stderr, "No tasks, add them to ~/.config/tmuxai/tasks or .tmuxai/tasks in your project")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSOURCE\tVARS\tDESCRIPTION")
+		for _, task := range tasks {
+			vars := strings.Join(task.VarNames(), " ")
+			if vars == "" {
+				vars = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", task.Name, task.Source, vars, task.Description)
+		}
+		return w.Flush()
+	},
+}
+
+var taskRunCmd = &cobra.Command{
+	Use:   "run <name>",
+	Short: "Run a task in the chat, or headless with --no-interactive",
+	Example: `  tmuxai task run git-commit --var remote=origin
+  tmuxai task run review-history --no-interactive --output json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !noInteractive {
+			if err := checkAskFlags(cmd); err != nil {
+				os.Exit(askFailed("Error: %v", err))
+			}
+		}
+		dir, _ := os.Getwd()
+		task, err := internal.FindTask(args[0], dir)
+		if err != nil {
+			os.Exit(askFailed("%v", err))
+		}
+		vars, err := internal.ParseTaskVars(taskVars)
+		if err != nil {
+			os.Exit(askFailed("%v", err))
+		}
+		message, err := task.Render(vars)
+		if err != nil {
+			os.Exit(askFailed("%v, pass them with --var name=value", err))
+		}
+		logger.Info("Running task %s from %s", task.Name, task.Path)
+
+		if noInteractive {
+			if task.Approve != "" && !cmd.Flags().Changed("approve") {
+				askApprove = task.Approve
+			}
+			os.Exit(runHeadless(message, nil, task.Model))
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			os.Exit(askFailed("Error loading configuration: %v", err))
+		}
+		mgr, err := internal.NewManager(cfg)
+		if err != nil {
+			logger.Error("manager.NewManager failed: %v", err)
+			os.Exit(1)
+		}
+		if task.Model != "" {
+			mgr.SessionOverrides["openrouter.model"] = task.Model
+		}
+		if err := mgr.Start(message); err != nil {
+			logger.Error("manager.Start failed: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	taskRunCmd.Flags().StringArrayVar(&taskVars, "var", nil, "Set a task variable, name=value, repeatable")
+	taskRunCmd.Flags().BoolVar(&noInteractive, "no-interactive", false, "Run the task without the chat like tmuxai ask, print the answer and exit")
+	addAskFlags(taskRunCmd)
+	taskCmd.AddCommand(taskListCmd, taskRunCmd)
+	rootCmd.AddCommand(taskCmd)
+}
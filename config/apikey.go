@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// Sources of the API key, in the order ResolveAPIKey tries them
+const (
+	APIKeyFromConfig  = "api_key"
+	APIKeyFromCommand = "api_key_cmd"
+	APIKeyFromFile    = "api_key_file"
+	APIKeyFromKeyring = "keyring"
+)
+
+// The API key is stored in the OS keyring under this service and account
+const (
+	KeyringService = "tmuxai"
+	KeyringAccount = "openrouter.api_key"
+	KeyringLabel   = "TmuxAI API key"
+)
+
+// apiKeyCommandTimeout bounds api_key_cmd, long enough to unlock a password manager
+const apiKeyCommandTimeout = 2 * time.Minute
+
+// apiKeyCommands caches the output of api_key_cmd by command for the session
+var (
+	apiKeyCommandsMu sync.Mutex
+	apiKeyCommands   = make(map[string]string)
+)
+
+// ResolveAPIKey sets APIKey and APIKeySource from the first source configured: api_key,
+// api_key_cmd, api_key_file, then the OS keyring. An API key which is not found leaves
+// APIKey empty, a command or file which fails is an error.
+func (c *OpenRouterConfig) ResolveAPIKey() error {
+	switch {
+	case c.APIKey != "":
+		if c.APIKeySource == "" {
+			c.APIKeySource = APIKeyFromConfig
+		}
+		return nil
+	case c.APIKeyCmd != "":
+		key, err := runAPIKeyCommand(c.APIKeyCmd)
+		if err != nil {
+			return err
+		}
+		c.APIKey, c.APIKeySource = key, APIKeyFromCommand
+	case c.APIKeyFile != "":
+		key, err := readAPIKeyFile(c.APIKeyFile)
+		if err != nil {
+			return err
+		}
+		c.APIKey, c.APIKeySource = key, APIKeyFromFile
+	case system.KeyringAvailable():
+		key, err := system.KeyringGet(KeyringService, KeyringAccount)
+		if err != nil {
+			if !errors.Is(err, system.ErrKeyringNotFound) {
+				logger.Debug("Keyring: %v", err)
+			}
+			return nil
+		}
+		c.APIKey, c.APIKeySource = key, APIKeyFromKeyring
+	}
+	return nil
+}
+
+// runAPIKeyCommand runs command with sh -c and returns the first line of its output, e.g.
+// the password of pass show. The terminal is passed on for password manager prompts.
+func runAPIKeyCommand(command string) (string, error) {
+	apiKeyCommandsMu.Lock()
+	defer apiKeyCommandsMu.Unlock()
+	if key, ok := apiKeyCommands[command]; ok {
+		return key, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("openrouter.api_key_cmd timed out after %s", apiKeyCommandTimeout)
+		}
+		return "", fmt.Errorf("openrouter.api_key_cmd failed: %w", err)
+	}
+	key, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	if key = strings.TrimSpace(key); key == "" {
+		return "", fmt.Errorf("openrouter.api_key_cmd printed nothing")
+	}
+	apiKeyCommands[command] = key
+	logger.Info("Read the API key with openrouter.api_key_cmd")
+	return key, nil
+}
+
+// readAPIKeyFile returns the first line of path, ~ is the home directory
+func readAPIKeyFile(path string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("openrouter.api_key_file: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o077 != 0 {
+		logger.Info("%s is readable by other users, chmod 600 it", path)
+	}
+	key, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	if key = strings.TrimSpace(key); key == "" {
+		return "", fmt.Errorf("openrouter.api_key_file: %s is empty", path)
+	}
+	return key, nil
+}
@@ -6,33 +6,71 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
-
-	"github.com/spf13/viper"
+	"time"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Debug                 bool             `mapstructure:"debug"`
-	MaxCaptureLines       int              `mapstructure:"max_capture_lines"`
-	MaxContextSize        int              `mapstructure:"max_context_size"`
-	WaitInterval          int              `mapstructure:"wait_interval"`
-	SendKeysConfirm       bool             `mapstructure:"send_keys_confirm"`
-	PasteMultilineConfirm bool             `mapstructure:"paste_multiline_confirm"`
-	ExecConfirm           bool             `mapstructure:"exec_confirm"`
-	WhitelistPatterns     []string         `mapstructure:"whitelist_patterns"`
-	BlacklistPatterns     []string         `mapstructure:"blacklist_patterns"`
-	OpenRouter            OpenRouterConfig `mapstructure:"openrouter"`
-	Prompts               PromptsConfig    `mapstructure:"prompts"`
+	Debug                 bool                     `mapstructure:"debug"`
+	MaxCaptureLines       int                      `mapstructure:"max_capture_lines"`
+	MaxContextSize        int                      `mapstructure:"max_context_size"`
+	WaitInterval          int                      `mapstructure:"wait_interval"`
+	SendKeysConfirm       bool                     `mapstructure:"send_keys_confirm"`
+	PasteMultilineConfirm bool                     `mapstructure:"paste_multiline_confirm"`
+	ExecConfirm           bool                     `mapstructure:"exec_confirm"`
+	WhitelistPatterns     []string                 `mapstructure:"whitelist_patterns"`
+	BlacklistPatterns     []string                 `mapstructure:"blacklist_patterns"`
+	AllowedWritePaths     []string                 `mapstructure:"allowed_write_paths"` // redirections may write here without confirmation
+	RiskRules             []RiskRule               `mapstructure:"risk_rules"`
+	WatchTriggers         []WatchTrigger           `mapstructure:"watch_triggers"`
+	WatchAct              WatchActConfig           `mapstructure:"watch_act"`
+	OpenRouter            OpenRouterConfig         `mapstructure:"openrouter"`
+	Prompts               PromptsConfig            `mapstructure:"prompts"`
+	Sandbox               SandboxConfig            `mapstructure:"sandbox"`
+	Checkpoints           CheckpointsConfig        `mapstructure:"checkpoints"`
+	Audit                 AuditConfig              `mapstructure:"audit"`
+	Limits                LimitsConfig             `mapstructure:"limits"`
+	Notify                NotifyConfig             `mapstructure:"notify"`
+	Attach                AttachConfig             `mapstructure:"attach"`
+	Commands              map[string]CommandConfig `mapstructure:"commands"` // custom slash commands by name
+	Context               string                   `mapstructure:"context"`  // added to the system prompt, e.g. "this repo uses pnpm"
+
+	Sources     map[string]string `mapstructure:"-"` // layer of each key set by a layer, see Source
+	ProjectFile string            `mapstructure:"-"` // .tmuxai.yaml in use, if any
+	Warnings    []string          `mapstructure:"-"` // ignored project keys and tmux options
+}
+
+// CommandConfig declares a custom slash command: a prompt macro sent to the AI, a shell
+// command whose output is attached to the next message, or both
+type CommandConfig struct {
+	Description string        `mapstructure:"description"` // shown in /help
+	Args        []string      `mapstructure:"args"`        // required arguments, available by name in the templates
+	Prompt      string        `mapstructure:"prompt"`      // text/template sent to the AI
+	Shell       string        `mapstructure:"shell"`       // text/template run with sh -c in the exec pane directory
+	Timeout     time.Duration `mapstructure:"timeout"`     // of shell, 30s by default
+	Model       string        `mapstructure:"model"`       // model for the prompt
+	Complete    []string      `mapstructure:"complete"`    // completions of the first argument
+}
+
+// AttachConfig limits files attached with /attach, @path mentions and piped input
+type AttachConfig struct {
+	MaxBytes       int      `mapstructure:"max_bytes"`       // larger files are truncated
+	MaxFiles       int      `mapstructure:"max_files"`       // per /attach
+	RedactPatterns []string `mapstructure:"redact_patterns"` // regexes replaced with [REDACTED], besides the built-in secret patterns
 }
 
 // OpenRouterConfig holds API configuration for OpenRouter and compatible services
 type OpenRouterConfig struct {
 	APIKey      string `mapstructure:"api_key"`
+	APIKeyCmd   string `mapstructure:"api_key_cmd"`  // command printing the API key, e.g. pass show openrouter
+	APIKeyFile  string `mapstructure:"api_key_file"` // file holding the API key
 	Model       string `mapstructure:"model"`
 	BaseURL     string `mapstructure:"base_url"`
 	Provider    string `mapstructure:"provider"`     // "openrouter", "openai", "anthropic", "bedrock", etc.
 	Region      string `mapstructure:"region"`       // AWS region for Bedrock
 	ServiceName string `mapstructure:"service_name"` // Service name for Bedrock (e.g., "bedrock-runtime")
+
+	APIKeySource string `mapstructure:"-"` // where APIKey was read from, see ResolveAPIKey
 }
 
 // PromptsConfig holds customizable prompt templates
@@ -43,6 +81,85 @@ type PromptsConfig struct {
 	Watch                 string `mapstructure:"watch"`
 }
 
+// RiskRule classifies commands matching Pattern, checked before the built-in rules
+type RiskRule struct {
+	Pattern string `mapstructure:"pattern"` // regex matched against each simple command
+	Level   string `mapstructure:"level"`   // read-only, local write, network, privileged, destructive or irreversible
+	Explain string `mapstructure:"explain"` // shown in the confirmation prompt
+}
+
+// WatchTrigger fires in watch mode without asking the AI. Set one of Pattern, Literal, Exit or Idle.
+type WatchTrigger struct {
+	Name     string        `mapstructure:"name"`
+	Pattern  string        `mapstructure:"pattern"`  // regex matched against each new output line
+	Literal  string        `mapstructure:"literal"`  // text matched against each new output line
+	Exit     string        `mapstructure:"exit"`     // regex matched against the name of a process exiting in a pane
+	Idle     time.Duration `mapstructure:"idle"`     // no new output for this long, e.g. 10m
+	Message  string        `mapstructure:"message"`  // shown when the trigger fires
+	Escalate bool          `mapstructure:"escalate"` // also ask the AI to explain the matched output
+	Notify   []string      `mapstructure:"notify"`   // notifiers, defaults to notify.trigger
+}
+
+// WatchActConfig restricts the commands of watchers started with /watch --act. Commands must
+// match whitelist_patterns and are confirmed with /watch approve unless they match Allow.
+type WatchActConfig struct {
+	MaxActions int           `mapstructure:"max_actions"` // commands a watcher may run per period
+	Period     time.Duration `mapstructure:"period"`
+	Allow      []string      `mapstructure:"allow"` // regexes of commands which run without confirmation
+}
+
+// SandboxConfig controls running the exec pane inside a restricted environment
+type SandboxConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Backend string `mapstructure:"backend"` // "bwrap" or "unshare", empty picks the first available
+	Network bool   `mapstructure:"network"` // allow network access inside the sandbox
+	Dir     string `mapstructure:"dir"`     // project directory, defaults to the current directory
+}
+
+// CheckpointsConfig controls snapshots of the working tree taken before each command
+type CheckpointsConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`
+	Directories []string `mapstructure:"directories"` // non-git directories snapshotted by copying
+}
+
+// AuditConfig controls the JSON lines log of every command, keystroke and paste sent to a pane
+type AuditConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"` // defaults to ~/.config/tmuxai/audit.jsonl
+}
+
+// LimitsConfig caps how much the agent may do for a single request before asking to continue, 0 disables a limit
+type LimitsConfig struct {
+	MaxSteps    int     `mapstructure:"max_steps"`    // AI responses
+	MaxDuration int     `mapstructure:"max_duration"` // wall-clock seconds
+	MaxTokens   int     `mapstructure:"max_tokens"`
+	MaxCost     float64 `mapstructure:"max_cost"` // USD
+	MaxCommands int     `mapstructure:"max_commands"`
+	InputPrice  float64 `mapstructure:"input_price"`  // USD per million prompt tokens, used when the provider reports no cost
+	OutputPrice float64 `mapstructure:"output_price"` // USD per million completion tokens
+}
+
+// NotifyConfig selects the notifiers of each event. Notifiers tmux, desktop and bell are
+// built in, others are declared under notifiers.
+type NotifyConfig struct {
+	Notifiers      map[string]NotifierConfig `mapstructure:"notifiers"`
+	MinDuration    int                       `mapstructure:"min_duration"` // seconds a request must take before accomplished and waiting_for_user notify
+	Accomplished   []string                  `mapstructure:"accomplished"`
+	WaitingForUser []string                  `mapstructure:"waiting_for_user"`
+	Confirmation   []string                  `mapstructure:"confirmation"`
+	Error          []string                  `mapstructure:"error"`
+	Watch          []string                  `mapstructure:"watch"`   // comments of the AI in watch mode
+	Trigger        []string                  `mapstructure:"trigger"` // watch triggers which fired
+}
+
+// NotifierConfig declares a notifier
+type NotifierConfig struct {
+	Type    string            `mapstructure:"type"`    // tmux, desktop, bell, webhook or command
+	URL     string            `mapstructure:"url"`     // webhook: receives the JSON payload as a POST
+	Headers map[string]string `mapstructure:"headers"` // webhook: e.g. an Authorization header
+	Command string            `mapstructure:"command"` // command: run with sh -c, the JSON payload on stdin
+}
+
 // DefaultConfig returns a configuration with default values
 func DefaultConfig() *Config {
 	return &Config{
@@ -55,6 +172,7 @@ func DefaultConfig() *Config {
 		ExecConfirm:           true,
 		WhitelistPatterns:     []string{},
 		BlacklistPatterns:     []string{},
+		AllowedWritePaths:     []string{"/dev/null"},
 		OpenRouter: OpenRouterConfig{
 			BaseURL:  "https://openrouter.ai/api/v1",
 			Model:    "google/gemini-2.5-flash-preview",
@@ -64,53 +182,56 @@ func DefaultConfig() *Config {
 			BaseSystem:    ``,
 			ChatAssistant: ``,
 		},
+		Checkpoints: CheckpointsConfig{
+			Enabled:     true,
+			Directories: []string{},
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+		},
+		WatchAct: WatchActConfig{
+			MaxActions: 3,
+			Period:     10 * time.Minute,
+		},
+		Limits: LimitsConfig{
+			MaxSteps:    30,
+			MaxDuration: 900,
+		},
+		Notify: NotifyConfig{
+			Watch:   []string{"tmux"},
+			Trigger: []string{"tmux"},
+		},
+		Attach: AttachConfig{
+			MaxBytes: 32000,
+			MaxFiles: 20,
+		},
 	}
 }
 
-// Load loads the configuration from file or environment variables
+// Load loads the configuration layers of the current directory and tmux pane and
+// validates them, see LoadLayers
 func Load() (*Config, error) {
-	config := DefaultConfig()
-
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
+	return LoadLayers(DefaultLayers())
+}
 
-	homeDir, err := os.UserHomeDir()
+// LoadLayers merges the configuration layers over the defaults, from the lowest to the
+// highest precedence: the user config file, the project config, tmux user options,
+// environment variables and flags. It validates the result, see Validate.
+func LoadLayers(layers Layers) (*Config, error) {
+	cfg, err := loadLayers(layers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
-	}
-
-	viper.AddConfigPath(".")
-
-	configDir, err := GetConfigDir()
-	if err == nil {
-		viper.AddConfigPath(configDir)
-	} else {
-		viper.AddConfigPath(filepath.Join(homeDir, ".config", "tmuxai"))
-	}
-
-	// Environment variables
-	viper.SetEnvPrefix("TMUXAI")
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
-	// Automatically bind all config keys to environment variables
-	configType := reflect.TypeOf(*config)
-	for _, key := range EnumerateConfigKeys(configType, "") {
-		viper.BindEnv(key)
-	}
-
-	viper.AutomaticEnv()
-
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("failed to read config file: %w", err)
-		}
+		return nil, err
 	}
-
-	if err := viper.Unmarshal(config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	if errs := Validate(cfg); errs != nil {
+		return nil, errs
 	}
+	return cfg, nil
+}
 
-	return config, nil
+// LoadUnvalidated loads the configuration like Load without validating it, for tmuxai
+// config doctor which reports the problems itself
+func LoadUnvalidated() (*Config, error) {
+	return loadLayers(DefaultLayers())
 }
 
 // EnumerateConfigKeys returns all config keys (dot notation) for the given struct type.
@@ -119,6 +240,9 @@ func EnumerateConfigKeys(cfgType reflect.Type, prefix string) []string {
 	for i := 0; i < cfgType.NumField(); i++ {
 		field := cfgType.Field(i)
 		tag := field.Tag.Get("mapstructure")
+		if tag == "-" {
+			continue
+		}
 		if tag == "" {
 			tag = strings.ToLower(field.Name)
 		}
@@ -154,65 +278,3 @@ func GetConfigFilePath(filename string) string {
 	configDir, _ := GetConfigDir()
 	return filepath.Join(configDir, filename)
 }
-
-func TryInferType(key, value string) any {
-	var typedValue any = value
-	// Only basic type inference for bool/int/string
-	for i := 0; i < reflect.TypeOf(Config{}).NumField(); i++ {
-		field := reflect.TypeOf(Config{}).Field(i)
-		tag := field.Tag.Get("mapstructure")
-		if tag == "" {
-			tag = strings.ToLower(field.Name)
-		}
-		// Support dot notation for nested fields
-		fullKey := tag
-		if key == fullKey {
-			switch field.Type.Kind() {
-			case reflect.Bool:
-				if value == "true" {
-					typedValue = true
-				} else if value == "false" {
-					typedValue = false
-				}
-			case reflect.Int, reflect.Int64, reflect.Int32:
-				var intVal int
-				_, err := fmt.Sscanf(value, "%d", &intVal)
-				if err == nil {
-					typedValue = intVal
-				}
-			}
-		}
-		// Nested struct support
-		if field.Type.Kind() == reflect.Struct {
-			nestedType := field.Type
-			prefix := tag + "."
-			if strings.HasPrefix(key, prefix) {
-				nestedKey := key[len(prefix):]
-				for j := 0; j < nestedType.NumField(); j++ {
-					nf := nestedType.Field(j)
-					ntag := nf.Tag.Get("mapstructure")
-					if ntag == "" {
-						ntag = strings.ToLower(nf.Name)
-					}
-					if ntag == nestedKey {
-						switch nf.Type.Kind() {
-						case reflect.Bool:
-							if value == "true" {
-								typedValue = true
-							} else if value == "false" {
-								typedValue = false
-							}
-						case reflect.Int, reflect.Int64, reflect.Int32:
-							var intVal int
-							_, err := fmt.Sscanf(value, "%d", &intVal)
-							if err == nil {
-								typedValue = intVal
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	return typedValue
-}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration layers, from the lowest to the highest precedence
+const (
+	LayerDefault = "default"
+	LayerUser    = "user"    // ~/.config/tmuxai/config.yaml
+	LayerProject = "project" // .tmuxai.yaml in the exec pane directory or above
+	LayerTmux    = "tmux"    // @tmuxai_* user options of the tmux server, session and window
+	LayerEnv     = "env"     // TMUXAI_* environment variables
+	LayerFlag    = "flag"    // --model and --set
+	LayerSession = "session" // /config set, only known to the chat
+)
+
+// ProjectConfigName is the file name of project configs
+const ProjectConfigName = ".tmuxai.yaml"
+
+// projectAllowedKeys are the only keys project configs may set. Anything else is ignored,
+// otherwise a cloned repository could approve its own commands, send the API key
+// elsewhere, run commands of its own or turn off checkpoints, limits and the blacklist.
+var projectAllowedKeys = []string{
+	"context",
+	"openrouter.model",
+	"max_capture_lines",
+	"max_context_size",
+	"wait_interval",
+	"watch_triggers",
+	"attach.max_bytes",
+	"attach.max_files",
+	"attach.redact_patterns",
+}
+
+// tmuxOptionAliases are short names of tmux options, others are @tmuxai_ followed by the
+// key with . replaced by _, e.g. @tmuxai_limits_max_steps
+var tmuxOptionAliases = map[string]string{
+	"@tmuxai_model": "openrouter.model",
+}
+
+// Layers locates the configuration layers beyond the user config file
+type Layers struct {
+	ProjectDir string // .tmuxai.yaml is looked up from here to the root
+	TmuxTarget string // pane whose @tmuxai_* options apply, empty outside tmux
+}
+
+// DefaultLayers are the layers of the directory and the tmux pane tmuxai runs in
+func DefaultLayers() Layers {
+	dir, _ := os.Getwd()
+	return Layers{ProjectDir: dir, TmuxTarget: os.Getenv("TMUX_PANE")}
+}
+
+var flagValues map[string]string
+
+// SetFlagValues sets the values of the flag layer, keys in dot notation
+func SetFlagValues(values map[string]string) error {
+	for key := range values {
+		if _, err := lookupField(DefaultConfig(), key); err != nil {
+			return err
+		}
+	}
+	flagValues = values
+	return nil
+}
+
+// FindProjectConfig returns the nearest .tmuxai.yaml in dir or above, empty when there is none
+func FindProjectConfig(dir string) string {
+	for dir != "" {
+		path := filepath.Join(dir, ProjectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// loadLayers merges the layers over the defaults. The context of each layer is added to
+// the context of the layers below instead of replacing it.
+func loadLayers(layers Layers) (*Config, error) {
+	cfg := DefaultConfig()
+	cfg.Sources = make(map[string]string)
+	v := viper.New()
+
+	merge := func(layer string, values map[string]any) error {
+		if len(values) == 0 {
+			return nil
+		}
+		for _, key := range leafKeys(values, reflect.TypeOf(Config{}), "") {
+			cfg.Sources[key] = layer
+		}
+		if context, ok := values["context"].(string); ok && v.GetString("context") != "" {
+			values["context"] = v.GetString("context") + "\n" + context
+		}
+		return v.MergeConfigMap(values)
+	}
+
+	user, err := readLayerFile(ConfigFilePath())
+	if err != nil {
+		return nil, err
+	}
+	if err := merge(LayerUser, user); err != nil {
+		return nil, err
+	}
+
+	if cfg.ProjectFile = FindProjectConfig(layers.ProjectDir); cfg.ProjectFile != "" {
+		project, err := readLayerFile(cfg.ProjectFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range leafKeys(project, reflect.TypeOf(Config{}), "") {
+			if !projectAllowed(key) {
+				deleteNested(project, key)
+				cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("%s: %s is ignored, it can only be set in %s", cfg.ProjectFile, key, ConfigFilePath()))
+			}
+		}
+		if err := merge(LayerProject, project); err != nil {
+			return nil, err
+		}
+	}
+
+	if layers.TmuxTarget != "" {
+		options, err := system.TmuxUserOptions(layers.TmuxTarget, "@tmuxai_")
+		if err != nil {
+			logger.Debug("No tmux options: %v", err)
+		}
+		keys := tmuxOptionKeys()
+		tmux := make(map[string]any)
+		for _, name := range sortedKeys(options) {
+			key, ok := keys[name]
+			if !ok {
+				cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("tmux option %s is ignored, it is not a config key", name))
+				continue
+			}
+			setNested(tmux, key, options[name])
+		}
+		if err := merge(LayerTmux, tmux); err != nil {
+			return nil, err
+		}
+	}
+
+	env := make(map[string]any)
+	for _, key := range EnumerateConfigKeys(reflect.TypeOf(Config{}), "") {
+		if value, ok := os.LookupEnv(envName(key)); ok {
+			setNested(env, key, value)
+		}
+	}
+	if err := merge(LayerEnv, env); err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]any)
+	for key, value := range flagValues {
+		setNested(flags, key, value)
+	}
+	if err := merge(LayerFlag, flags); err != nil {
+		return nil, err
+	}
+
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	for _, warning := range cfg.Warnings {
+		logger.Info("Config: %s", warning)
+	}
+	return cfg, nil
+}
+
+// readLayerFile reads a YAML config file, a missing file is an empty layer
+func readLayerFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// envName returns the environment variable of key, e.g. TMUXAI_OPENROUTER_API_KEY
+func envName(key string) string {
+	return "TMUXAI_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// tmuxOptionKeys maps the names of tmux options to config keys
+func tmuxOptionKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, key := range EnumerateConfigKeys(reflect.TypeOf(Config{}), "") {
+		keys["@tmuxai_"+strings.ReplaceAll(key, ".", "_")] = key
+	}
+	for name, key := range tmuxOptionAliases {
+		keys[name] = key
+	}
+	return keys
+}
+
+// projectAllowed reports whether key is or is in one of projectAllowedKeys
+func projectAllowed(key string) bool {
+	for _, allowed := range projectAllowedKeys {
+		if key == allowed || strings.HasPrefix(key, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// leafKeys returns the config keys set in values: fields which are not sections, and
+// unknown keys as they are
+func leafKeys(values map[string]any, t reflect.Type, prefix string) []string {
+	var keys []string
+	for _, name := range sortedKeys(values) {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		field, ok := fieldByTag(t, name)
+		if nested, isMap := values[name].(map[string]any); ok && isMap && field.Type.Kind() == reflect.Struct {
+			keys = append(keys, leafKeys(nested, field.Type, key)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// setNested sets key (dot notation) in values, creating the maps of its sections
+func setNested(values map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := values[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			values[part] = next
+		}
+		values = next
+	}
+	values[parts[len(parts)-1]] = value
+}
+
+// deleteNested removes key (dot notation) from values
+func deleteNested(values map[string]any, key string) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := values[part].(map[string]any)
+		if !ok {
+			return
+		}
+		values = next
+	}
+	delete(values, parts[len(parts)-1])
+}
+
+// Source returns the layer key was set in, LayerDefault when no layer sets it
+func (c *Config) Source(key string) string {
+	for k := key; k != ""; {
+		if layer, ok := c.Sources[k]; ok {
+			return layer
+		}
+		i := strings.LastIndexAny(k, ".[")
+		if i < 0 {
+			break
+		}
+		k = k[:i]
+	}
+	return LayerDefault
+}
+
+// SourceFile returns where the layer of key is read from, for messages
+func (c *Config) SourceFile(key string) string {
+	switch c.Source(key) {
+	case LayerUser:
+		return ConfigFilePath()
+	case LayerProject:
+		return c.ProjectFile
+	case LayerTmux:
+		return "tmux options"
+	case LayerEnv:
+		return "environment"
+	case LayerFlag:
+		return "flags"
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFilePath returns the user config file, ~/.config/tmuxai/config.yaml
+func ConfigFilePath() string {
+	return GetConfigFilePath("config.yaml")
+}
+
+// AppendListValue adds value to the list at key (dot notation) in the config file, keeping
+// comments and formatting of the rest of the file. Values already in the list are not duplicated.
+func AppendListValue(key, value string) error {
+	return editConfigFile(func(root *yaml.Node) error {
+		node, err := lookupNode(root, key, true)
+		if err != nil {
+			return err
+		}
+		if node.Kind == 0 || (node.Kind == yaml.ScalarNode && node.Tag == "!!null") {
+			*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		if node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%s is not a list", key)
+		}
+		for _, item := range node.Content {
+			if item.Value == value {
+				return nil
+			}
+		}
+		// flow style lists like "[]" become block lists once they have items
+		node.Style = 0
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: yaml.SingleQuotedStyle})
+		return nil
+	})
+}
+
+// RemoveListValue removes value from the list at key (dot notation) in the config file,
+// keeping comments and formatting of the rest of the file
+func RemoveListValue(key, value string) error {
+	return editConfigFile(func(root *yaml.Node) error {
+		node, err := lookupNode(root, key, false)
+		if err != nil || node == nil {
+			return err
+		}
+		if node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%s is not a list", key)
+		}
+		node.Content = slices.DeleteFunc(node.Content, func(item *yaml.Node) bool {
+			return item.Value == value
+		})
+		return nil
+	})
+}
+
+// WriteValue sets the scalar at key (dot notation) in the config file to value, keeping
+// comments and formatting of the rest of the file
+func WriteValue(key string, value any) error {
+	return editConfigFile(func(root *yaml.Node) error {
+		node, err := lookupNode(root, key, true)
+		if err != nil {
+			return err
+		}
+		if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+			return fmt.Errorf("%s is not a single value in the config file", key)
+		}
+		node.Kind = yaml.ScalarNode
+		node.Style = 0
+		switch v := value.(type) {
+		case bool:
+			node.Tag, node.Value = "!!bool", strconv.FormatBool(v)
+		case int:
+			node.Tag, node.Value = "!!int", strconv.Itoa(v)
+		case float64:
+			node.Tag, node.Value = "!!float", strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			// durations are written as 30s
+			node.Tag, node.Value = "!!str", fmt.Sprint(v)
+		}
+		return nil
+	})
+}
+
+// editConfigFile parses the config file into a yaml node tree, applies edit and writes it back
+func editConfigFile(edit func(root *yaml.Node) error) error {
+	path := ConfigFilePath()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s does not contain a mapping", path)
+	}
+
+	if err := edit(root); err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	enc := yaml.NewEncoder(&sb)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	enc.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// write through a temporary file so a failed write never truncates the config
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// lookupNode returns the value node at key (dot notation), creating missing mappings when create is set
+func lookupNode(root *yaml.Node, key string, create bool) (*yaml.Node, error) {
+	node := root
+	for _, part := range strings.Split(key, ".") {
+		if node.Kind == 0 {
+			*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("cannot set %s: parent is not a mapping", key)
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == part {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			if !create {
+				return nil, nil
+			}
+			next = &yaml.Node{}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, next)
+		}
+		node = next
+	}
+	return node, nil
+}
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem with one key of the configuration
+type ValidationError struct {
+	File   string // config file, empty when the value does not come from a file
+	Key    string // dot notation, list items as key[i]
+	Reason string
+}
+
+func (e ValidationError) Error() string {
+	if e.File == "" {
+		return e.Key + ": " + e.Reason
+	}
+	return e.File + ": " + e.Key + ": " + e.Reason
+}
+
+// ValidationErrors are all the problems found by Validate
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// builtinNotifiers can be used without declaring them under notify.notifiers
+var builtinNotifiers = []string{"tmux", "desktop", "bell"}
+
+// riskLevels are the levels accepted by risk_rules, see parseRiskLevel in internal/risk.go
+var riskLevels = []string{"read-only", "readonly", "read_only", "local write", "local-write", "local_write", "write",
+	"network/remote", "network", "remote", "privileged", "destructive", "irreversible"}
+
+// Validate checks cfg and the config files it was read from: unknown keys, regexes, ranges
+// and references between keys. Errors name the layer the key was set in. It returns nil
+// when the configuration is fine.
+func Validate(cfg *Config) ValidationErrors {
+	v := validator{cfg: cfg}
+	v.unknownKeys(ConfigFilePath())
+	if cfg.ProjectFile != "" {
+		v.unknownKeys(cfg.ProjectFile)
+	}
+
+	if cfg.MaxCaptureLines <= 0 {
+		v.add("max_capture_lines", "must be greater than 0, got %d", cfg.MaxCaptureLines)
+	}
+	if cfg.MaxContextSize <= 0 {
+		v.add("max_context_size", "must be greater than 0, got %d", cfg.MaxContextSize)
+	}
+	v.notNegative("wait_interval", cfg.WaitInterval)
+
+	if cfg.OpenRouter.Model == "" {
+		v.add("openrouter.model", "is empty, set the model to use, e.g. %s", DefaultConfig().OpenRouter.Model)
+	}
+	if cfg.OpenRouter.Provider != "bedrock" {
+		if u, err := url.Parse(cfg.OpenRouter.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("openrouter.base_url", "must be an http or https URL such as %s, got '%s'", DefaultConfig().OpenRouter.BaseURL, cfg.OpenRouter.BaseURL)
+		}
+	}
+
+	for _, key := range regexKeys {
+		value, _ := GetValue(cfg, key)
+		for i, pattern := range value.([]string) {
+			v.regex(fmt.Sprintf("%s[%d]", key, i), pattern)
+		}
+	}
+	for i, rule := range cfg.RiskRules {
+		key := fmt.Sprintf("risk_rules[%d]", i)
+		v.regex(key+".pattern", rule.Pattern)
+		if !slices.Contains(riskLevels, strings.ToLower(strings.TrimSpace(rule.Level))) {
+			v.add(key+".level", "unknown level '%s', use read-only, local write, network, privileged, destructive or irreversible", rule.Level)
+		}
+	}
+	for i, trigger := range cfg.WatchTriggers {
+		key := fmt.Sprintf("watch_triggers[%d]", i)
+		v.regex(key+".pattern", trigger.Pattern)
+		v.regex(key+".exit", trigger.Exit)
+		set := 0
+		for _, isSet := range []bool{trigger.Pattern != "", trigger.Literal != "", trigger.Exit != "", trigger.Idle > 0} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			v.add(key, "set exactly one of pattern, literal, exit or idle")
+		}
+	}
+
+	switch cfg.Sandbox.Backend {
+	case "", "bwrap", "unshare":
+	default:
+		v.add("sandbox.backend", "unknown backend '%s', use bwrap or unshare", cfg.Sandbox.Backend)
+	}
+	v.notNegative("watch_act.max_actions", cfg.WatchAct.MaxActions)
+	v.notNegative("limits.max_steps", cfg.Limits.MaxSteps)
+	v.notNegative("limits.max_duration", cfg.Limits.MaxDuration)
+	v.notNegative("limits.max_tokens", cfg.Limits.MaxTokens)
+	v.notNegative("limits.max_commands", cfg.Limits.MaxCommands)
+	if cfg.Limits.MaxCost < 0 {
+		v.add("limits.max_cost", "must not be negative")
+	}
+	v.notNegative("attach.max_bytes", cfg.Attach.MaxBytes)
+	v.notNegative("attach.max_files", cfg.Attach.MaxFiles)
+
+	v.notifiers(cfg.Notify)
+	for _, name := range sortedKeys(cfg.Commands) {
+		if cmd := cfg.Commands[name]; cmd.Prompt == "" && cmd.Shell == "" {
+			v.add("commands."+name, "needs a prompt or a shell command")
+		}
+	}
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// validator collects the errors of Validate
+type validator struct {
+	cfg  *Config
+	errs ValidationErrors
+}
+
+func (v *validator) add(key, format string, a ...any) {
+	v.addIn(v.cfg.SourceFile(key), key, format, a...)
+}
+
+func (v *validator) addIn(file, key, format string, a ...any) {
+	v.errs = append(v.errs, ValidationError{File: file, Key: key, Reason: fmt.Sprintf(format, a...)})
+}
+
+func (v *validator) notNegative(key string, value int) {
+	if value < 0 {
+		v.add(key, "must not be negative, got %d", value)
+	}
+}
+
+func (v *validator) regex(key, pattern string) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		v.add(key, "invalid regex '%s': %v", pattern, err)
+	}
+}
+
+// notifiers checks the declared notifiers and that events only use known ones
+func (v *validator) notifiers(cfg NotifyConfig) {
+	for _, name := range sortedKeys(cfg.Notifiers) {
+		notifier := cfg.Notifiers[name]
+		key := "notify.notifiers." + name
+		switch notifier.Type {
+		case "tmux", "desktop", "bell":
+		case "webhook":
+			if notifier.URL == "" {
+				v.add(key+".url", "webhook notifier needs a url")
+			}
+		case "command":
+			if notifier.Command == "" {
+				v.add(key+".command", "command notifier needs a command")
+			}
+		default:
+			v.add(key+".type", "unknown notifier type '%s', use tmux, desktop, bell, webhook or command", notifier.Type)
+		}
+	}
+	events := map[string][]string{
+		"accomplished":     cfg.Accomplished,
+		"waiting_for_user": cfg.WaitingForUser,
+		"confirmation":     cfg.Confirmation,
+		"error":            cfg.Error,
+		"watch":            cfg.Watch,
+		"trigger":          cfg.Trigger,
+	}
+	for _, event := range sortedKeys(events) {
+		for _, name := range events[event] {
+			if _, declared := cfg.Notifiers[name]; !declared && !slices.Contains(builtinNotifiers, name) {
+				v.add("notify."+event, "unknown notifier '%s', declare it under notify.notifiers", name)
+			}
+		}
+	}
+}
+
+// unknownKeys reports keys of a config file which do not exist, unmarshalling ignores them
+func (v *validator) unknownKeys(file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	var content map[string]any
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		// reading the config already reported it
+		return
+	}
+	v.checkKeys(file, content, reflect.TypeOf(Config{}), "")
+}
+
+// checkKeys compares the keys of a mapping of a config file with the fields of t
+func (v *validator) checkKeys(file string, content map[string]any, t reflect.Type, prefix string) {
+	for _, name := range sortedKeys(content) {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		field, ok := fieldByTag(t, name)
+		if !ok {
+			if suggestion := closestField(t, name); suggestion != "" {
+				v.addIn(file, key, "unknown key, did you mean %s?", suggestion)
+			} else {
+				v.addIn(file, key, "unknown key")
+			}
+			continue
+		}
+
+		switch value := content[name].(type) {
+		case map[string]any:
+			switch {
+			case field.Type.Kind() == reflect.Struct:
+				v.checkKeys(file, value, field.Type, key)
+			case field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.Struct:
+				for _, entry := range sortedKeys(value) {
+					if item, ok := value[entry].(map[string]any); ok {
+						v.checkKeys(file, item, field.Type.Elem(), key+"."+entry)
+					}
+				}
+			}
+		case []any:
+			if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+				for i, entry := range value {
+					if item, ok := entry.(map[string]any); ok {
+						v.checkKeys(file, item, field.Type.Elem(), fmt.Sprintf("%s[%d]", key, i))
+					}
+				}
+			}
+		}
+	}
+}
+
+// fieldByTag returns the field of t with the mapstructure tag name
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" {
+			tag = strings.ToLower(field.Name)
+		}
+		if tag == name && tag != "-" {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// closestField returns the key of t closest to the misspelled name, if any is close
+func closestField(t reflect.Type, name string) string {
+	best, bestDistance := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("mapstructure")
+		if tag == "-" {
+			continue
+		}
+		if d := editDistance(name, tag); d < bestDistance {
+			best, bestDistance = tag, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
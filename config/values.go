@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// regexKeys are the lists of regular expressions, checked when the config is loaded and
+// when items are added
+var regexKeys = []string{
+	"whitelist_patterns",
+	"blacklist_patterns",
+	"watch_act.allow",
+	"attach.redact_patterns",
+}
+
+// secretKeys can not be changed from the chat, they would end up in the history and the config file
+var secretKeys = []string{"openrouter.api_key", "openrouter.api_key_cmd", "openrouter.api_key_file"}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// lookupField returns the field of cfg at key (dot notation)
+func lookupField(cfg *Config, key string) (reflect.Value, error) {
+	val := reflect.ValueOf(cfg).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if val.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown config key '%s'", key)
+		}
+		found := false
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			tag := field.Tag.Get("mapstructure")
+			if tag == "" {
+				tag = strings.ToLower(field.Name)
+			}
+			if tag == part {
+				val = val.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown config key '%s'", key)
+		}
+	}
+	if val.Kind() == reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("%s is a section, use one of its keys", key)
+	}
+	return val, nil
+}
+
+// settable reports whether values of type t can be given as text
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64, reflect.String:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// SettableKeys returns the keys which can be changed for a session, lists included
+func SettableKeys() []string {
+	var keys []string
+	cfg := DefaultConfig()
+	for _, key := range EnumerateConfigKeys(reflect.TypeOf(*cfg), "") {
+		field, err := lookupField(cfg, key)
+		if err == nil && settable(field.Type()) && !slices.Contains(secretKeys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ListKeys returns the keys holding lists of values
+func ListKeys() []string {
+	var keys []string
+	for _, key := range SettableKeys() {
+		if IsListKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// IsListKey reports whether key holds a list of values
+func IsListKey(key string) bool {
+	field, err := lookupField(DefaultConfig(), key)
+	return err == nil && field.Kind() == reflect.Slice
+}
+
+// settableField returns the field at key when it can be changed
+func settableField(cfg *Config, key string) (reflect.Value, error) {
+	field, err := lookupField(cfg, key)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if slices.Contains(secretKeys, key) {
+		return reflect.Value{}, fmt.Errorf("%s can only be set in the config file or the environment", key)
+	}
+	if !settable(field.Type()) {
+		return reflect.Value{}, fmt.Errorf("%s can only be set in the config file", key)
+	}
+	return field, nil
+}
+
+// ParseValue converts value to the type of the field at key, e.g. "true" for a bool field
+func ParseValue(key, value string) (any, error) {
+	field, err := settableField(DefaultConfig(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a duration such as 30s or 5m, got '%s'", key, value)
+		}
+		return d, nil
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false, got '%s'", key, value)
+		}
+		return b, nil
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number, got '%s'", key, value)
+		}
+		return n, nil
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number, got '%s'", key, value)
+		}
+		return f, nil
+	case field.Kind() == reflect.Slice:
+		return nil, fmt.Errorf("%s is a list, add or remove its items", key)
+	}
+	return value, nil
+}
+
+// ValidateListItem checks item before it is added to the list at key
+func ValidateListItem(key, item string) error {
+	field, err := settableField(DefaultConfig(), key)
+	if err != nil {
+		return err
+	}
+	if field.Kind() != reflect.Slice {
+		return fmt.Errorf("%s is not a list", key)
+	}
+	if slices.Contains(regexKeys, key) {
+		if _, err := regexp.Compile(item); err != nil {
+			return fmt.Errorf("invalid regex '%s' for %s: %v", item, key, err)
+		}
+	}
+	return nil
+}
+
+// GetValue returns the value of cfg at key
+func GetValue(cfg *Config, key string) (any, error) {
+	field, err := lookupField(cfg, key)
+	if err != nil {
+		return nil, err
+	}
+	return field.Interface(), nil
+}
+
+// SetValue sets the field of cfg at key to value, which must have the type of the field
+func SetValue(cfg *Config, key string, value any) error {
+	field, err := lookupField(cfg, key)
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || !v.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("%s expects a %s, got %T", key, field.Type(), value)
+	}
+	if list, ok := value.([]string); ok {
+		v = reflect.ValueOf(slices.Clone(list))
+	}
+	field.Set(v)
+	return nil
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// AgentState is what the agent is currently doing
+type AgentState int
+
+const (
+	StateIdle AgentState = iota
+	StateThinking
+	StateAwaitingConfirmation
+	StateExecuting
+	StateWaitingForPane
+	StateWaitingForUser
+	StateDone
+	StateError
+)
+
+var agentStateNames = map[AgentState]string{
+	StateIdle:                 "idle",
+	StateThinking:             "thinking",
+	StateAwaitingConfirmation: "awaiting-confirmation",
+	StateExecuting:            "executing",
+	StateWaitingForPane:       "waiting-for-pane",
+	StateWaitingForUser:       "waiting-for-user",
+	StateDone:                 "done",
+	StateError:                "error",
+}
+
+func (s AgentState) String() string {
+	return agentStateNames[s]
+}
+
+// Active reports whether the agent is working on a request
+func (s AgentState) Active() bool {
+	switch s {
+	case StateThinking, StateAwaitingConfirmation, StateExecuting, StateWaitingForPane:
+		return true
+	}
+	return false
+}
+
+// AgentEvent describes a state transition
+type AgentEvent struct {
+	Time   time.Time
+	From   AgentState
+	To     AgentState
+	Detail string // e.g. the command being executed or the error
+}
+
+// OnEvent registers fn to be called on every state transition
+func (m *Manager) OnEvent(fn func(AgentEvent)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observers = append(m.observers, fn)
+}
+
+// State returns what the agent is currently doing
+func (m *Manager) State() AgentState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// setState moves the agent to state and notifies observers. Once the current run
+// is cancelled it can no longer become active again.
+func (m *Manager) setState(state AgentState, detail string) {
+	m.mu.Lock()
+	if state.Active() && m.runCtx != nil && m.runCtx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+	event := AgentEvent{Time: time.Now(), From: m.status, To: state, Detail: detail}
+	m.status = state
+	observers := m.observers
+	m.mu.Unlock()
+
+	m.notifyObservers(event, observers)
+}
+
+// notifyObservers calls observers without holding the lock, they may call back into the manager
+func (m *Manager) notifyObservers(event AgentEvent, observers []func(AgentEvent)) {
+	logger.Debug("Agent state %s -> %s %s", event.From, event.To, event.Detail)
+	for _, fn := range observers {
+		fn(event)
+	}
+}
+
+// beginRun returns the context of the current run, cancelled by m.Cancel.
+// Nested calls share the context of the outer run.
+func (m *Manager) beginRun(parent context.Context) (context.Context, context.CancelFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.runCtx != nil && m.runCtx.Err() == nil {
+		return m.runCtx, func() {}
+	}
+	ctx, cancel := context.WithCancel(parent)
+	m.runCtx, m.cancelRun = ctx, cancel
+	return ctx, func() {
+		cancel()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.runCtx == ctx {
+			m.runCtx, m.cancelRun = nil, nil
+		}
+	}
+}
+
+// Cancel stops the current run, watchers keep running. It is safe to call from any goroutine.
+func (m *Manager) Cancel() {
+	m.mu.Lock()
+	if m.cancelRun != nil {
+		m.cancelRun()
+	}
+	if !m.status.Active() {
+		m.mu.Unlock()
+		return
+	}
+	event := AgentEvent{Time: time.Now(), From: m.status, To: StateIdle, Detail: "cancelled"}
+	m.status = StateIdle
+	observers := m.observers
+	m.mu.Unlock()
+
+	m.notifyObservers(event, observers)
+}
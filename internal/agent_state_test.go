@@ -0,0 +1,124 @@
+// Tests for the agent loop state machine in agent_state.go and process_message.go
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// newTestAgent returns a manager whose AI replies with responses in order
+func newTestAgent(t *testing.T, responses ...string) (*Manager, *[]AgentEvent) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if requests >= len(responses) {
+			http.Error(w, "no more responses", http.StatusInternalServerError)
+			return
+		}
+		content := responses[requests]
+		requests++
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Choices: []ChatCompletionChoice{{Message: Message{Role: "assistant", Content: content}}},
+			Usage:   &Usage{TotalTokens: 100},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	m := newServerAgent(server.URL)
+	var events []AgentEvent
+	m.OnEvent(func(e AgentEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	return m, &events
+}
+
+// newServerAgent returns a manager using the AI at url
+func newServerAgent(url string) *Manager {
+	cfg := config.DefaultConfig()
+	cfg.OpenRouter.BaseURL = url
+	cfg.Audit.Enabled = false
+	return &Manager{
+		Config:           cfg,
+		AiClient:         NewAiClient(&cfg.OpenRouter),
+		ExecPane:         &system.TmuxPaneDetails{},
+		SessionOverrides: map[string]interface{}{},
+	}
+}
+
+func statesOf(events []AgentEvent) []AgentState {
+	var states []AgentState
+	for _, e := range events {
+		states = append(states, e.To)
+	}
+	return states
+}
+
+func TestAgentLoop_RetriesGuidelinesUntilAccomplished(t *testing.T) {
+	m, events := newTestAgent(t,
+		"I forgot the tags",
+		"All good <RequestAccomplished>1</RequestAccomplished>",
+	)
+	m.startRequestUsage()
+
+	if !m.ProcessUserMessage(context.Background(), "check the disk") {
+		t.Fatal("expected request to be accomplished")
+	}
+	want := []AgentState{StateThinking, StateThinking, StateDone}
+	if got := statesOf(*events); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("expected transitions %v, got %v", want, got)
+	}
+	if m.Usage.Steps != 2 || m.Usage.Tokens != 200 {
+		t.Errorf("expected 2 steps and 200 tokens, got %+v", m.Usage)
+	}
+	if m.runCtx != nil {
+		t.Error("run context should be released after the request")
+	}
+}
+
+func TestAgentLoop_ErrorAndWaitingForUser(t *testing.T) {
+	m, _ := newTestAgent(t, "Which disk? <WaitingForUserResponse>1</WaitingForUserResponse>")
+	if m.ProcessUserMessage(context.Background(), "check the disk") {
+		t.Fatal("expected request to wait for the user")
+	}
+	if m.State() != StateWaitingForUser {
+		t.Errorf("expected %s, got %s", StateWaitingForUser, m.State())
+	}
+
+	// the fake server has no more responses and fails
+	if m.ProcessUserMessage(context.Background(), "sda") {
+		t.Fatal("expected failure")
+	}
+	if m.State() != StateError {
+		t.Errorf("expected %s, got %s", StateError, m.State())
+	}
+}
+
+func TestAgentLoop_Cancel(t *testing.T) {
+	m, events := newTestAgent(t, "All good <RequestAccomplished>1</RequestAccomplished>")
+	m.OnEvent(func(e AgentEvent) {
+		if e.To == StateThinking {
+			m.Cancel()
+		}
+	})
+
+	if m.ProcessUserMessage(context.Background(), "check the disk") {
+		t.Fatal("cancelled request must not be accomplished")
+	}
+	if m.State() != StateIdle {
+		t.Errorf("expected %s after cancel, got %s", StateIdle, m.State())
+	}
+	if last := (*events)[len(*events)-1]; last.Detail != "cancelled" {
+		t.Errorf("expected a cancelled event, got %+v", last)
+	}
+}
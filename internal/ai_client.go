@@ -26,6 +26,15 @@ type AiClient struct {
 	client        *http.Client
 	bedrockClient *bedrockruntime.Client
 	messageLength int
+	lastUsage     Usage
+}
+
+// Usage is the token count (and cost, when the provider reports it) of one completion
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"` // USD, reported by OpenRouter
 }
 
 // Message represents a chat message
@@ -36,8 +45,14 @@ type Message struct {
 
 // ChatCompletionRequest represents a request to the chat completion API
 type ChatCompletionRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model    string        `json:"model"`
+	Messages []Message     `json:"messages"`
+	Usage    *UsageRequest `json:"usage,omitempty"`
+}
+
+// UsageRequest asks OpenRouter to include the cost in the response usage
+type UsageRequest struct {
+	Include bool `json:"include"`
 }
 
 // ChatCompletionChoice represents a choice in the chat completion response
@@ -52,6 +67,7 @@ type ChatCompletionResponse struct {
 	Object  string                 `json:"object"`
 	Created int64                  `json:"created"`
 	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *Usage                 `json:"usage,omitempty"`
 }
 
 func NewAiClient(cfg *config.OpenRouterConfig) *AiClient {
@@ -107,7 +123,7 @@ func (c *AiClient) GetResponseFromChatMessages(ctx context.Context, chatMessages
 
 		aiMessages = append(aiMessages, Message{
 			Role:    role,
-			Content: msg.Content,
+			Content: msg.text(),
 		})
 	}
 
@@ -122,8 +138,15 @@ func (c *AiClient) GetResponseFromChatMessages(ctx context.Context, chatMessages
 	return response, nil
 }
 
+// LastUsage returns the usage reported for the most recent completion
+func (c *AiClient) LastUsage() Usage {
+	return c.lastUsage
+}
+
 // ChatCompletion sends a chat completion request to the appropriate AI provider
 func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model string) (string, error) {
+	c.lastUsage = Usage{}
+
 	// Use AWS Bedrock if provider is bedrock
 	if c.config.Provider == "bedrock" {
 		return c.bedrockChatCompletion(ctx, messages, model)
@@ -139,6 +162,10 @@ func (c *AiClient) openRouterChatCompletion(ctx context.Context, messages []Mess
 		Model:    model,
 		Messages: messages,
 	}
+	// other OpenAI compatible APIs may reject unknown parameters
+	if strings.Contains(c.config.BaseURL, "openrouter.ai") {
+		reqBody.Usage = &UsageRequest{Include: true}
+	}
 
 	reqJSON, err := json.Marshal(reqBody)
 	if err != nil {
@@ -200,6 +227,10 @@ func (c *AiClient) openRouterChatCompletion(ctx context.Context, messages []Mess
 		return "", fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
+	if completionResp.Usage != nil {
+		c.lastUsage = *completionResp.Usage
+	}
+
 	// Return the response content
 	if len(completionResp.Choices) > 0 {
 		responseContent := completionResp.Choices[0].Message.Content
@@ -243,6 +274,14 @@ func (c *AiClient) bedrockChatCompletion(ctx context.Context, messages []Message
 		return "", fmt.Errorf("failed to invoke Bedrock model: %w", err)
 	}
 
+	if output.Usage != nil {
+		c.lastUsage = Usage{
+			PromptTokens:     int(aws.ToInt32(output.Usage.InputTokens)),
+			CompletionTokens: int(aws.ToInt32(output.Usage.OutputTokens)),
+			TotalTokens:      int(aws.ToInt32(output.Usage.TotalTokens)),
+		}
+	}
+
 	// Parse the response based on the model
 	responseContent, err := c.parseBedrockResponse(output)
 	if err != nil {
@@ -375,7 +414,7 @@ func debugChatMessages(chatMessages []ChatMessage, response string) {
 		timeStr := msg.Timestamp.Format(time.RFC3339)
 
 		file.WriteString(fmt.Sprintf("Message %d: Role=%s, Time=%s\n", i+1, role, timeStr))
-		file.WriteString(fmt.Sprintf("Content:\n%s\n\n", msg.Content))
+		file.WriteString(fmt.Sprintf("Content:\n%s\n\n", msg.text()))
 	}
 
 	file.WriteString("==================    RECEIVED RESPONSE ==================\n\n")
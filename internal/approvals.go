@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// SessionApproval is an "always allow" rule which lasts until TmuxAI exits.
+// Blacklist patterns still override it.
+type SessionApproval struct {
+	Command    string // exact command line, empty for program rules
+	Program    string
+	Subcommand string
+	Uses       int
+	CreatedAt  time.Time
+}
+
+func (a SessionApproval) String() string {
+	if a.Command != "" {
+		return fmt.Sprintf("exact command `%s`", a.Command)
+	}
+	if a.Subcommand == "" {
+		return fmt.Sprintf("program `%s`", a.Program)
+	}
+	return fmt.Sprintf("program `%s %s`", a.Program, a.Subcommand)
+}
+
+// subcommandPrograms are tools whose first argument selects what they do, so program
+// rules for them are scoped to the subcommand. Other programs are approved as a whole.
+var subcommandPrograms = map[string]bool{
+	"git": true, "kubectl": true, "oc": true, "helm": true, "docker": true, "podman": true,
+	"npm": true, "pnpm": true, "yarn": true, "cargo": true, "go": true, "pip": true, "pip3": true,
+	"systemctl": true, "journalctl": true, "apt": true, "apt-get": true, "dnf": true, "yum": true,
+	"brew": true, "terraform": true, "tofu": true, "aws": true, "gcloud": true, "az": true,
+	"gh": true, "tmux": true, "make": true, "ip": true, "nmcli": true,
+}
+
+// stageSubcommand returns the subcommand a program rule for stage is scoped to
+func stageSubcommand(stage commandStage) string {
+	if subcommandPrograms[stage.Program] {
+		return stage.Subcommand
+	}
+	return ""
+}
+
+// matchesStage reports whether a program rule covers stage
+func (a SessionApproval) matchesStage(stage commandStage) bool {
+	return a.Command == "" && stage.Program != "" && stage.Program == a.Program && stageSubcommand(stage) == a.Subcommand
+}
+
+// WhitelistPatterns returns whitelist_patterns equivalent to the rule, one per stage
+// for exact commands since the whitelist is matched against each simple command
+func (a SessionApproval) WhitelistPatterns() []string {
+	if a.Command == "" {
+		pattern := "^" + regexp.QuoteMeta(a.Program)
+		if a.Subcommand != "" {
+			pattern += `\s+` + regexp.QuoteMeta(a.Subcommand)
+		}
+		return []string{pattern + `(\s|$)`}
+	}
+	stages, err := parseCommandStages(a.Command)
+	if err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, stage := range stages {
+		patterns = append(patterns, "^"+regexp.QuoteMeta(stage.Text)+"$")
+	}
+	return patterns
+}
+
+// addSessionApproval records an always allow rule for command, either for the exact
+// command line or for the program and subcommand of each of its stages
+func (m *Manager) addSessionApproval(command string, exact bool) []SessionApproval {
+	var added []SessionApproval
+	if exact {
+		added = append(added, SessionApproval{Command: command, CreatedAt: time.Now()})
+	} else {
+		stages, _ := parseCommandStages(command)
+		seen := map[string]bool{}
+		for _, stage := range stages {
+			subcommand := stageSubcommand(stage)
+			key := stage.Program + " " + subcommand
+			if stage.Program == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			added = append(added, SessionApproval{Program: stage.Program, Subcommand: subcommand, CreatedAt: time.Now()})
+		}
+	}
+	for _, a := range added {
+		logger.Info("Session approval added: %s", a)
+	}
+	m.SessionApprovals = append(m.SessionApprovals, added...)
+	return added
+}
+
+// sessionApprovalFor returns the rule approving the whole command line, if any
+func (m *Manager) sessionApprovalFor(command string) *SessionApproval {
+	for i := range m.SessionApprovals {
+		if a := &m.SessionApprovals[i]; a.Command != "" && a.Command == strings.TrimSpace(command) {
+			return a
+		}
+	}
+	return nil
+}
+
+// sessionApprovalForStage returns the program rule approving stage, if any
+func (m *Manager) sessionApprovalForStage(stage commandStage) *SessionApproval {
+	for i := range m.SessionApprovals {
+		if a := &m.SessionApprovals[i]; a.matchesStage(stage) {
+			return a
+		}
+	}
+	return nil
+}
+
+// useSessionApprovals counts a run of command approved by a session rule, or confirmed
+// with "always" which recorded one, for the rules approving it. It is called when the
+// command runs, checking the policy alone does not count.
+func (m *Manager) useSessionApprovals(approval Approval, command string) {
+	if approval != ApprovalSession && approval != ApprovalAlways {
+		return
+	}
+	if decision := m.checkPolicy(command); decision.Approved {
+		for _, rule := range decision.rules {
+			rule.Uses++
+		}
+	}
+}
+
+// promptAlwaysAllow asks which kind of session rule to record after the user chose "always"
+func (m *Manager) promptAlwaysAllow(command string) {
+	stages, _ := parseCommandStages(command)
+	var programs []string
+	for _, stage := range stages {
+		if stage.Program != "" {
+			programs = append(programs, strings.TrimSpace(stage.Program+" "+stageSubcommand(stage)))
+		}
+	}
+
+	exact := true
+	if len(programs) > 0 {
+		exact = !m.confirmYesNo(fmt.Sprintf("Always allow any `%s` instead of only this exact command?", strings.Join(programs, "`, `")))
+	}
+	m.addSessionApproval(command, exact)
+	m.Println("Approved for this session, see /approvals to list or revoke")
+}
+
+// processApprovalsCommand handles /approvals [revoke <n|all> | save <n>]
+func (m *Manager) processApprovalsCommand(args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		if len(m.SessionApprovals) == 0 {
+			m.Println("No session approvals, choose [A]lways when confirming a command to add one")
+			return
+		}
+		formatter := system.NewInfoFormatter()
+		for i, a := range m.SessionApprovals {
+			fmt.Printf("%s %s %s\n",
+				formatter.LabelColor.Sprintf("%3d", i+1),
+				formatter.ValueColor.Sprint(a),
+				formatter.NeutralColor.Sprintf("(added %s, used %d times)", a.CreatedAt.Format("15:04:05"), a.Uses))
+		}
+		return
+	}
+
+	usage := "Usage: /approvals [revoke <n|all> | save <n>]"
+	if len(args) < 2 {
+		m.Println(usage)
+		return
+	}
+
+	if args[0] == "revoke" && args[1] == "all" {
+		m.SessionApprovals = nil
+		m.Println("All session approvals revoked")
+		return
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 || n > len(m.SessionApprovals) {
+		m.Println(fmt.Sprintf("No session approval %s, see /approvals", args[1]))
+		return
+	}
+	approval := m.SessionApprovals[n-1]
+
+	switch args[0] {
+	case "revoke":
+		m.SessionApprovals = append(m.SessionApprovals[:n-1], m.SessionApprovals[n:]...)
+		logger.Info("Session approval revoked: %s", approval)
+		m.Println("Revoked " + approval.String())
+	case "save":
+		patterns := approval.WhitelistPatterns()
+		for _, pattern := range patterns {
+			if err := config.AppendListValue("whitelist_patterns", pattern); err != nil {
+				m.Println("Failed to save to config: " + err.Error())
+				return
+			}
+			m.Config.WhitelistPatterns = append(m.Config.WhitelistPatterns, pattern)
+		}
+		logger.Info("Session approval saved to whitelist_patterns: %v", patterns)
+		m.Println(fmt.Sprintf("Added %s to whitelist_patterns in %s", strings.Join(patterns, ", "), config.ConfigFilePath()))
+	default:
+		m.Println(usage)
+	}
+}
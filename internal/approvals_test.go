@@ -0,0 +1,88 @@
+// Tests for session "always allow" approvals in approvals.go
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestSessionApprovals(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BlacklistPatterns = []string{`\s--all-namespaces\b`}
+	m := &Manager{Config: cfg}
+
+	if m.checkPolicy("kubectl get pods -n foo").Approved {
+		t.Fatal("expected manual check without approvals")
+	}
+
+	m.addSessionApproval("kubectl get pods -n foo", true)
+	if d := m.checkPolicy("kubectl get pods -n foo"); !d.Approved || !d.SessionRule {
+		t.Errorf("expected exact approval, got %s", d)
+	}
+	if m.checkPolicy("kubectl get pods -n bar").Approved {
+		t.Error("exact approval must not cover other arguments")
+	}
+
+	m.addSessionApproval("kubectl get pods -n foo | grep api", false)
+	if d := m.checkPolicy("kubectl get svc -n bar | grep web"); !d.Approved {
+		t.Errorf("expected program approval for kubectl get and grep, got %s", d)
+	}
+	if m.checkPolicy("kubectl delete pod x").Approved {
+		t.Error("program approval must not cover other subcommands")
+	}
+	if d := m.checkPolicy("kubectl get pods --all-namespaces"); d.Approved {
+		t.Error("blacklist must override session approvals")
+	}
+	if m.SessionApprovals[0].Uses != 0 {
+		t.Errorf("checking the policy must not count uses, got %d", m.SessionApprovals[0].Uses)
+	}
+	m.useSessionApprovals(ApprovalSession, "kubectl get pods -n foo")
+	if m.SessionApprovals[0].Uses != 1 {
+		t.Errorf("expected exact rule used once, got %d", m.SessionApprovals[0].Uses)
+	}
+	m.useSessionApprovals(ApprovalConfirmed, "kubectl get pods -n foo")
+	if m.SessionApprovals[0].Uses != 1 {
+		t.Errorf("a confirmed run must not count as a use of the rule, got %d", m.SessionApprovals[0].Uses)
+	}
+	// "always" records the rule and runs the command right away
+	m.addSessionApproval("kubectl logs api-0", true)
+	m.useSessionApprovals(ApprovalAlways, "kubectl logs api-0")
+	if rule := m.SessionApprovals[len(m.SessionApprovals)-1]; rule.Uses != 1 {
+		t.Errorf("expected the first run of an always rule to count, got %d", rule.Uses)
+	}
+
+	m.processApprovalsCommand([]string{"revoke", "all"})
+	if len(m.SessionApprovals) != 0 || m.checkPolicy("kubectl get pods -n foo").Approved {
+		t.Error("expected all approvals revoked")
+	}
+}
+
+func TestSessionApprovals_SaveToWhitelist(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".config", "tmuxai", "config.yaml")
+	os.MkdirAll(filepath.Dir(configPath), 0o755)
+	os.WriteFile(configPath, []byte("# my settings\nwhitelist_patterns: [] # safe commands\nwait_interval: 3\n"), 0o644)
+
+	m := &Manager{Config: config.DefaultConfig()}
+	m.addSessionApproval("kubectl get pods -n foo", false)
+	m.processApprovalsCommand([]string{"save", "1"})
+
+	data, _ := os.ReadFile(configPath)
+	content := string(data)
+	for _, want := range []string{"# my settings", "wait_interval: 3", `'^kubectl\s+get(\s|$)'`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("config missing %q:\n%s", want, content)
+		}
+	}
+
+	fresh := &Manager{Config: config.DefaultConfig()}
+	fresh.Config.WhitelistPatterns = m.Config.WhitelistPatterns
+	if !fresh.checkPolicy("kubectl get nodes").Approved {
+		t.Error("saved pattern should approve kubectl get")
+	}
+}
@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// Attachment is a file or piped input sent with a message, kept apart from the pane
+// content so squashing can drop its content and keep its name
+type Attachment struct {
+	Name      string // path as given, or "stdin"
+	Content   string // redacted and cut at attach.max_bytes
+	Size      int    // original size in bytes
+	Truncated bool
+	Redacted  int // secrets replaced
+}
+
+// redactRule replaces secrets matching re with repl
+type redactRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// redactRules are always applied to attachments, attach.redact_patterns adds to them
+var redactRules = []redactRule{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), "[REDACTED PRIVATE KEY]"},
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), "[REDACTED]"},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`), "[REDACTED]"},
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), "[REDACTED]"},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`), "[REDACTED]"},
+	{regexp.MustCompile(`(?i)(authorization:\s*bearer\s+)\S+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)\b([a-z0-9_.-]*(?:api[_-]?key|secret|token|password|passwd)[a-z0-9_.-]*)(["']?\s*[:=]\s*["']?)[^\s"',;]+`), "${1}${2}[REDACTED]"},
+}
+
+// redactSecrets replaces credentials in text and returns how many were replaced
+func (m *Manager) redactSecrets(text string) (string, int, error) {
+	rules := redactRules
+	for _, pattern := range m.Config.Attach.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid redact pattern '%s': %w", pattern, err)
+		}
+		rules = append(rules[:len(rules):len(rules)], redactRule{re, "[REDACTED]"})
+	}
+
+	count := 0
+	for _, rule := range rules {
+		text = rule.re.ReplaceAllStringFunc(text, func(match string) string {
+			replaced := rule.re.ReplaceAllString(match, rule.repl)
+			if replaced != match { // already redacted by an earlier rule
+				count++
+			}
+			return replaced
+		})
+	}
+	return text, count, nil
+}
+
+// newAttachment checks and redacts data read from name. size is the full size of the
+// input, data may already be cut at attach.max_bytes.
+func (m *Manager) newAttachment(name string, data []byte, size int) (Attachment, error) {
+	sample := data[:min(len(data), 8000)]
+	if bytes.IndexByte(sample, 0) >= 0 || !validUTF8Prefix(sample) {
+		return Attachment{}, fmt.Errorf("%s looks like a binary file", name)
+	}
+
+	a := Attachment{Name: name, Size: size}
+	if limit := m.Config.Attach.MaxBytes; limit > 0 && len(data) > limit {
+		data = data[:limit]
+	}
+	a.Truncated = size > len(data)
+
+	content, redacted, err := m.redactSecrets(strings.ToValidUTF8(string(data), ""))
+	if err != nil {
+		return Attachment{}, err
+	}
+	a.Content, a.Redacted = content, redacted
+	return a, nil
+}
+
+// validUTF8Prefix reports whether data is UTF-8, allowing a rune cut at the end
+func validUTF8Prefix(data []byte) bool {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return len(data)-i < utf8.UTFMax && !utf8.FullRune(data[i:])
+		}
+		i += size
+	}
+	return true
+}
+
+// AttachContent attaches data, e.g. piped into tmuxai ask, to the next message
+func (m *Manager) AttachContent(name string, data []byte) error {
+	a, err := m.newAttachment(name, data, len(data))
+	if err != nil {
+		return err
+	}
+	m.addAttachment(a)
+	return nil
+}
+
+// attachFile attaches the file at path, see resolveAttachPath
+func (m *Manager) attachFile(path string) error {
+	resolved := m.resolveAttachPath(path)
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := io.Reader(f)
+	if limit := m.Config.Attach.MaxBytes; limit > 0 {
+		reader = io.LimitReader(f, int64(limit))
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	a, err := m.newAttachment(path, data, int(info.Size()))
+	if err != nil {
+		return err
+	}
+	m.addAttachment(a)
+	return nil
+}
+
+// resolveAttachPath expands ~ and makes path absolute against the exec pane directory.
+// Headless runs keep paths relative to the directory they were started in.
+func (m *Manager) resolveAttachPath(path string) string {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) && m.headless == nil && m.ExecPane != nil && m.ExecPane.CurrentPath != "" {
+		path = filepath.Join(m.ExecPane.CurrentPath, path)
+	}
+	return path
+}
+
+// addAttachment adds a to the next message, replacing an earlier attachment of the same name
+func (m *Manager) addAttachment(a Attachment) {
+	for i, existing := range m.Attachments {
+		if existing.Name == a.Name {
+			m.Attachments = append(m.Attachments[:i], m.Attachments[i+1:]...)
+			break
+		}
+	}
+	m.Attachments = append(m.Attachments, a)
+	logger.Info("Attached %s (%d bytes, truncated %t, %d redacted)", a.Name, a.Size, a.Truncated, a.Redacted)
+	m.Println("Attached " + a.describe())
+}
+
+// describe returns the name of a with its size and what was changed
+func (a Attachment) describe() string {
+	details := []string{fmt.Sprintf("%d bytes", a.Size)}
+	if a.Truncated {
+		details = append(details, fmt.Sprintf("truncated to %d", len(a.Content)))
+	}
+	if a.Redacted > 0 {
+		details = append(details, fmt.Sprintf("%d secrets redacted", a.Redacted))
+	}
+	return a.Name + " (" + strings.Join(details, ", ") + ")"
+}
+
+// mentionPattern matches @path mentions at the start of a word
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@(\S+)`)
+
+// attachMentions attaches the files mentioned as @path in input. Mentions which are not
+// files, e.g. @someone, are left alone.
+func (m *Manager) attachMentions(input string) {
+	for _, match := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		path := strings.TrimRight(match[1], ".,;:!?)\"'")
+		if info, err := os.Stat(m.resolveAttachPath(path)); err != nil || info.IsDir() {
+			continue
+		}
+		if err := m.attachFile(path); err != nil {
+			m.Println("Not attached: " + err.Error())
+		}
+	}
+}
+
+// processAttachCommand handles /attach: without arguments it lists the attachments of the
+// next message, "clear" drops them, otherwise each argument is a file or glob to attach
+func (m *Manager) processAttachCommand(input string) {
+	args, err := splitArgs(input)
+	if err != nil {
+		m.Println("Usage: /attach <file|glob>... | clear")
+		return
+	}
+
+	switch {
+	case len(args) == 0:
+		if len(m.Attachments) == 0 {
+			m.Println("Nothing attached, use /attach <file|glob> or mention @path in a message")
+			return
+		}
+		m.Println("Attached to the next message:")
+		for _, a := range m.Attachments {
+			fmt.Println("  " + a.describe())
+		}
+		return
+	case len(args) == 1 && args[0] == "clear":
+		m.Attachments = nil
+		m.Println("Attachments cleared")
+		return
+	}
+
+	attached := 0
+	for _, arg := range args {
+		matches, err := filepath.Glob(m.resolveAttachPath(arg))
+		if err != nil || len(matches) == 0 {
+			if err := m.attachFile(arg); err != nil {
+				m.Println("Not attached: " + err.Error())
+			}
+			continue
+		}
+		for _, match := range matches {
+			if max := m.Config.Attach.MaxFiles; max > 0 && attached >= max {
+				m.Println(fmt.Sprintf("Attached the first %d files, raise attach.max_files for more", max))
+				return
+			}
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			name := match
+			if !filepath.IsAbs(arg) {
+				// keep names relative like the pattern
+				if rel, err := filepath.Rel(m.resolveAttachPath("."), match); err == nil {
+					name = rel
+				}
+			}
+			if err := m.attachFile(name); err != nil {
+				m.Println("Not attached: " + err.Error())
+				continue
+			}
+			attached++
+		}
+	}
+}
+
+// attachCompletions completes the last word of an /attach line with file names
+func (m *Manager) attachCompletions(line string) []string {
+	word := ""
+	if fields := strings.Fields(line); len(fields) > 1 && !strings.HasSuffix(line, " ") {
+		word = fields[len(fields)-1]
+	}
+	// resolving cleans the path, keep the separator the word ends with
+	prefix := m.resolveAttachPath(word)
+	switch {
+	case word == "":
+		prefix = m.resolveAttachPath(".") + string(filepath.Separator)
+	case strings.HasSuffix(word, string(filepath.Separator)):
+		prefix += string(filepath.Separator)
+	}
+	matches, _ := filepath.Glob(prefix + "*")
+	var names []string
+	for _, match := range matches {
+		name := word + strings.TrimPrefix(match, prefix)
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// text returns the content of msg with its attachments as sent to the AI
+func (msg ChatMessage) text() string {
+	if len(msg.Attachments) == 0 {
+		return msg.Content
+	}
+	var b strings.Builder
+	for _, a := range msg.Attachments {
+		fmt.Fprintf(&b, "<attached_file name=%q size=\"%d\"", a.Name, a.Size)
+		if a.Truncated {
+			b.WriteString(` truncated="true"`)
+		}
+		b.WriteString(">\n" + a.Content + "\n</attached_file>\n\n")
+	}
+	return b.String() + msg.Content
+}
+
+// attachmentNames lists the names of the attachments of msg
+func (msg ChatMessage) attachmentNames() []string {
+	var names []string
+	for _, a := range msg.Attachments {
+		names = append(names, a.Name)
+	}
+	return names
+}
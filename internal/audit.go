@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// Approval records how an action was allowed or refused
+type Approval string
+
+const (
+	ApprovalAuto      Approval = "auto_approved" // policy approved it without asking
+	ApprovalNoConfirm Approval = "no_confirm"    // confirmation disabled in config
+	ApprovalSession   Approval = "session_rule"  // an "always allow" rule of this session approved it
+	ApprovalConfirmed Approval = "confirmed"
+	ApprovalAlways    Approval = "always"   // confirmed and recorded as a session rule
+	ApprovalEdited    Approval = "edited"   // confirmed after the user changed the text
+	ApprovalHeadless  Approval = "headless" // approved by --approve all of a headless run
+	ApprovalRejected  Approval = "rejected"
+)
+
+// Audit statuses of an action which ran, rejected actions have none
+const (
+	AuditStarted  = "started"  // written before the action is sent, so a crash still leaves a record
+	AuditFinished = "finished" // written once it was sent, with its duration and exit code
+)
+
+// Approved reports whether the action may run
+func (a Approval) Approved() bool {
+	return a != ApprovalRejected
+}
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	SessionId  string    `json:"session_id"`
+	PaneId     string    `json:"pane_id"`
+	Host       string    `json:"host,omitempty"` // remote host when the pane runs ssh, docker, etc.
+	Cwd        string    `json:"cwd,omitempty"`
+	Action     string    `json:"action"`            // exec, send_keys or paste
+	Watcher    string    `json:"watcher,omitempty"` // watcher which ran the command on its own
+	Text       string    `json:"text"`
+	EditedText string    `json:"edited_text,omitempty"`
+	Approval   Approval  `json:"approval"`
+	Status     string    `json:"status,omitempty"` // AuditStarted or AuditFinished
+	Risk       string    `json:"risk,omitempty"`
+	ExitCode   *int      `json:"exit_code,omitempty"` // only known in prepared panes
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// AuditLogPath returns the configured audit log path, ~/.config/tmuxai/audit.jsonl by default
+func AuditLogPath(cfg *config.Config) (string, error) {
+	if cfg.Audit.Path != "" {
+		return expandHome(cfg.Audit.Path), nil
+	}
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "audit.jsonl"), nil
+}
+
+// audit appends entry to the audit log, filling in the session and exec pane details.
+// Headless runs also keep it for their result.
+func (m *Manager) audit(entry AuditEntry) {
+	m.auditWith(m.Config, entry)
+}
+
+// auditWith is audit with the audit settings of cfg, watchers pass their snapshot
+func (m *Manager) auditWith(cfg *config.Config, entry AuditEntry) {
+	if !cfg.Audit.Enabled && m.headless == nil {
+		return
+	}
+	entry.Time = time.Now()
+	entry.SessionId = m.SessionId
+	// watchers act in the pane they watch, not in the exec pane
+	if m.ExecPane != nil && entry.PaneId == "" {
+		entry.PaneId = m.ExecPane.Id
+		entry.Host = m.ExecPane.RemoteHost
+		entry.Cwd = m.ExecPane.CurrentPath
+	}
+	if entry.EditedText == entry.Text {
+		entry.EditedText = ""
+	}
+	// the result of a headless run lists each action once, when it is known how it ended
+	if m.headless != nil && entry.Status != AuditStarted {
+		m.headless.actions = append(m.headless.actions, entry)
+	}
+	if !cfg.Audit.Enabled {
+		return
+	}
+
+	if err := appendAuditEntry(cfg, entry); err != nil {
+		logger.Error("Failed to write audit log: %v", err)
+	}
+}
+
+func appendAuditEntry(cfg *config.Config, entry AuditEntry) error {
+	path, err := AuditLogPath(cfg)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// O_APPEND keeps concurrent sessions from overwriting each other's lines
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// AuditFilter selects audit entries, zero values match everything
+type AuditFilter struct {
+	SessionId string
+	PaneId    string
+	Host      string
+	Action    string
+	Approval  string
+	Contains  string // substring of the original or edited text
+	Since     time.Time
+}
+
+// Match reports whether entry passes the filter
+func (f AuditFilter) Match(entry AuditEntry) bool {
+	switch {
+	case f.SessionId != "" && entry.SessionId != f.SessionId:
+		return false
+	case f.PaneId != "" && entry.PaneId != f.PaneId:
+		return false
+	case f.Host != "" && entry.Host != f.Host:
+		return false
+	case f.Action != "" && entry.Action != f.Action:
+		return false
+	case f.Approval != "" && string(entry.Approval) != f.Approval:
+		return false
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case f.Contains != "" && !strings.Contains(entry.Text, f.Contains) && !strings.Contains(entry.EditedText, f.Contains):
+		return false
+	}
+	return true
+}
+
+// ReadAuditLog returns the entries of the audit log at path matching filter, oldest first
+func ReadAuditLog(path string, filter AuditFilter) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,86 @@
+// Tests for writing and querying the audit log in audit.go
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+func TestAuditLog_AppendAndFilter(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Path = filepath.Join(t.TempDir(), "audit.jsonl")
+	m := &Manager{
+		Config:    cfg,
+		SessionId: "20250101-120000",
+		ExecPane:  &system.TmuxPaneDetails{Id: "%3", CurrentPath: "/srv", RemoteHost: "jump1"},
+	}
+
+	code := 1
+	m.audit(AuditEntry{Action: "exec", Text: "ls", EditedText: "ls", Approval: ApprovalAuto, ExitCode: &code})
+	m.audit(AuditEntry{Action: "exec", Text: "rm -rf x", EditedText: "rm -rf y", Approval: ApprovalEdited})
+	m.audit(AuditEntry{Action: "send_keys", Text: "C-c", Approval: ApprovalRejected})
+
+	all, err := ReadAuditLog(cfg.Audit.Path, AuditFilter{})
+	if err != nil {
+		t.Fatalf("ReadAuditLog: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(all))
+	}
+	first := all[0]
+	if first.SessionId != "20250101-120000" || first.PaneId != "%3" || first.Host != "jump1" || first.Cwd != "/srv" {
+		t.Errorf("session and pane details not recorded: %+v", first)
+	}
+	if first.EditedText != "" {
+		t.Errorf("unchanged text should not be recorded as edited: %q", first.EditedText)
+	}
+	if first.ExitCode == nil || *first.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %v", first.ExitCode)
+	}
+
+	filtered, _ := ReadAuditLog(cfg.Audit.Path, AuditFilter{Action: "exec", Contains: "rm -rf y"})
+	if len(filtered) != 1 || filtered[0].Approval != ApprovalEdited {
+		t.Errorf("expected the edited rm entry, got %+v", filtered)
+	}
+	rejected, _ := ReadAuditLog(cfg.Audit.Path, AuditFilter{Approval: string(ApprovalRejected)})
+	if len(rejected) != 1 || rejected[0].Action != "send_keys" {
+		t.Errorf("expected the rejected keys entry, got %+v", rejected)
+	}
+	future, _ := ReadAuditLog(cfg.Audit.Path, AuditFilter{Since: time.Now().Add(time.Hour)})
+	if len(future) != 0 {
+		t.Errorf("expected no entries after --since in the future, got %d", len(future))
+	}
+
+	cfg.Audit.Enabled = false
+	m.audit(AuditEntry{Action: "exec", Text: "ls"})
+	if all, _ := ReadAuditLog(cfg.Audit.Path, AuditFilter{}); len(all) != 3 {
+		t.Errorf("disabled audit log should not be written")
+	}
+}
+
+func TestAuditLog_StartedAndFinished(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Path = filepath.Join(t.TempDir(), "audit.jsonl")
+	m := &Manager{Config: cfg, headless: &headlessRun{approve: HeadlessApproveAll}}
+
+	entry := AuditEntry{Action: "exec", Text: "make", Approval: ApprovalHeadless, Status: AuditStarted}
+	m.audit(entry)
+	if all, _ := ReadAuditLog(cfg.Audit.Path, AuditFilter{}); len(all) != 1 || all[0].Status != AuditStarted {
+		t.Fatalf("expected a started entry before the command is sent, got %+v", all)
+	}
+	entry.Status = AuditFinished
+	entry.DurationMs = 1200
+	m.audit(entry)
+
+	all, _ := ReadAuditLog(cfg.Audit.Path, AuditFilter{})
+	if len(all) != 2 || all[1].Status != AuditFinished || all[1].DurationMs != 1200 {
+		t.Errorf("expected a started and a finished entry, got %+v", all)
+	}
+	if len(m.headless.actions) != 1 || m.headless.actions[0].Status != AuditFinished {
+		t.Errorf("headless result should list the action once, got %+v", m.headless.actions)
+	}
+}
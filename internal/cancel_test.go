@@ -0,0 +1,160 @@
+// Tests for cancelling a run from another goroutine, meant to run with go test -race
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eiannone/keyboard"
+)
+
+// waitForState polls until the agent reaches state
+func waitForState(t *testing.T, m *Manager, state AgentState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("agent never reached %s, still %s", state, m.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// fakeKeyboard replaces the keyboard with keys and reports when it is closed
+func fakeKeyboard(t *testing.T) (chan keyboard.KeyEvent, chan struct{}) {
+	keys := make(chan keyboard.KeyEvent, 1)
+	closed := make(chan struct{}, 2)
+	original := openKeyboard
+	openKeyboard = func() (<-chan keyboard.KeyEvent, func(), error) {
+		return keys, func() { closed <- struct{}{} }, nil
+	}
+	t.Cleanup(func() { openKeyboard = original })
+	return keys, closed
+}
+
+func TestCancel_DuringAICall(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // never answers before the test ends
+	}))
+	defer server.Close()
+	defer close(release)
+	m := newServerAgent(server.URL)
+
+	result := make(chan bool)
+	go func() { result <- m.ProcessUserMessage(context.Background(), "check the disk") }()
+
+	waitForState(t, m, StateThinking)
+	m.Cancel()
+
+	select {
+	case accomplished := <-result:
+		if accomplished {
+			t.Error("cancelled request must not be accomplished")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessUserMessage did not return after Cancel")
+	}
+	if m.State() != StateIdle {
+		t.Errorf("expected %s, got %s", StateIdle, m.State())
+	}
+}
+
+func TestCancel_DuringCountdown(t *testing.T) {
+	_, closed := fakeKeyboard(t)
+	m, _ := newTestAgent(t)
+	ctx, done := m.beginRun(context.Background())
+	defer done()
+	m.setState(StateWaitingForPane, "")
+
+	result := make(chan bool)
+	go func() { result <- m.Countdown(ctx, 60) }()
+
+	time.Sleep(50 * time.Millisecond)
+	m.Cancel()
+
+	select {
+	case completed := <-result:
+		if completed {
+			t.Error("cancelled countdown must not complete")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Countdown did not return after Cancel")
+	}
+	select {
+	case <-closed:
+	default:
+		t.Error("keyboard was not closed")
+	}
+	if m.State() != StateIdle {
+		t.Errorf("expected %s, got %s", StateIdle, m.State())
+	}
+}
+
+func TestCancel_CountdownKeys(t *testing.T) {
+	keys, _ := fakeKeyboard(t)
+	m, _ := newTestAgent(t)
+	ctx, done := m.beginRun(context.Background())
+	defer done()
+
+	keys <- keyboard.KeyEvent{Key: keyboard.KeyEnter}
+	if !m.Countdown(ctx, 60) {
+		t.Error("Enter should skip the countdown")
+	}
+
+	keys <- keyboard.KeyEvent{Key: keyboard.KeyCtrlC}
+	if m.Countdown(ctx, 60) {
+		t.Error("Ctrl+C should stop the countdown")
+	}
+	if ctx.Err() == nil {
+		t.Error("Ctrl+C should cancel the run")
+	}
+}
+
+func TestCancel_DuringExecWait(t *testing.T) {
+	m, _ := newTestAgent(t)
+	m.ExecPane.Id = newTestTmux(t, []string{"sh"}).pane
+	ctx, done := m.beginRun(context.Background())
+	defer done()
+	m.setState(StateExecuting, "sleep 60")
+
+	// the pane is not prepared, its prompt never ends with ]» so only cancellation ends the wait
+	result := make(chan error)
+	go func() {
+		_, err := m.ExecWaitCapture(ctx, "sleep 60")
+		result <- err
+	}()
+
+	time.Sleep(700 * time.Millisecond)
+	m.Cancel()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ExecWaitCapture did not return after Cancel")
+	}
+	if m.State() != StateIdle {
+		t.Errorf("expected %s, got %s", StateIdle, m.State())
+	}
+}
+
+func TestCancel_StaysIdle(t *testing.T) {
+	m, _ := newTestAgent(t)
+	ctx, done := m.beginRun(context.Background())
+	defer done()
+	m.setState(StateThinking, "")
+	m.Cancel()
+
+	// a step still finishing after the cancel cannot make the agent active again
+	m.setState(StateExecuting, "late command")
+	if ctx.Err() == nil || m.State() != StateIdle {
+		t.Errorf("expected cancelled run and %s, got %s", StateIdle, m.State())
+	}
+}
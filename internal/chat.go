@@ -17,9 +17,10 @@ import (
 
 // Message represents a chat message
 type ChatMessage struct {
-	Content   string
-	FromUser  bool
-	Timestamp time.Time
+	Content     string
+	FromUser    bool
+	Timestamp   time.Time
+	Attachments []Attachment // sent before Content, see text
 }
 
 type CLIInterface struct {
@@ -52,6 +53,10 @@ func (c *CLIInterface) Start(initMessage string) error {
 	}
 	defer rl.Close()
 
+	// watchers print above the prompt while it is being edited
+	c.manager.SetOutput(rl.Stdout())
+	defer c.manager.SetOutput(nil)
+
 	if initMessage != "" {
 		fmt.Printf("%s%s\n", c.manager.GetPrompt(), initMessage)
 		c.processInput(initMessage)
@@ -94,9 +99,25 @@ func (c *CLIInterface) printWelcomeMessage() {
 }
 
 func (c *CLIInterface) processInput(input string) {
+	c.manager.refreshProjectConfig()
 	if c.manager.IsMessageSubcommand(input) {
-		c.manager.ProcessSubCommand(input)
-		return
+		// task runs and custom commands are sent to the AI like messages
+		message, model, ok, err := c.manager.commandRequest(input)
+		switch {
+		case !ok:
+			c.manager.ProcessSubCommand(input)
+			return
+		case err != nil:
+			c.manager.Println(err.Error())
+			return
+		case message == "":
+			return
+		}
+		if model != "" {
+			defer c.manager.useModel(model)()
+		}
+		fmt.Println(message)
+		input = message
 	}
 
 	// Set up signal handling for Ctrl+C
@@ -106,25 +127,27 @@ func (c *CLIInterface) processInput(input string) {
 	// Set up a notification channel
 	done := make(chan struct{})
 
-	// Create a cancellable context
-	ctx, cancel := context.WithCancel(context.Background())
+	// Create the context of this run, cancelled by manager.Cancel
+	ctx, cancel := c.manager.beginRun(context.Background())
 	defer cancel()
 
 	// Launch a goroutine just for handling the interrupt
 	go func() {
 		select {
 		case <-sigChan:
-			cancel()
-			c.manager.Status = ""
-			c.manager.WatchMode = false
+			c.manager.Cancel()
 		case <-done:
 		}
 	}()
 
 	// Run the message processing in the main thread
-	c.manager.Status = "running"
-	c.manager.ProcessUserMessage(ctx, input)
-	c.manager.Status = ""
+	c.manager.attachMentions(input)
+	c.manager.startRequestUsage()
+	accomplished := c.manager.ProcessUserMessage(ctx, input)
+
+	if accomplished && c.manager.Sandbox != nil {
+		c.manager.reviewSandbox()
+	}
 
 	close(done)
 
@@ -133,19 +156,15 @@ func (c *CLIInterface) processInput(input string) {
 
 // newCompleter creates a readline.AutoCompleter for command completion
 func (c *CLIInterface) newCompleter() readline.AutoCompleter {
+	settableKeys := func(_ string) []string { return config.SettableKeys() }
+	listKeys := func(_ string) []string { return config.ListKeys() }
 	configCompleter := readline.PcItem("/config",
-		readline.PcItem("set",
-			readline.PcItemDynamic(func(_ string) []string {
-				// Only return the allowed keys
-				return AllowedConfigKeys
-			}),
-		),
-		readline.PcItem("get",
-			readline.PcItemDynamic(func(_ string) []string {
-				// Only return the allowed keys
-				return AllowedConfigKeys
-			}),
-		),
+		readline.PcItem("set", readline.PcItemDynamic(settableKeys)),
+		readline.PcItem("get", readline.PcItemDynamic(settableKeys)),
+		readline.PcItem("unset", readline.PcItemDynamic(settableKeys)),
+		readline.PcItem("add", readline.PcItemDynamic(listKeys)),
+		readline.PcItem("remove", readline.PcItemDynamic(listKeys)),
+		readline.PcItem("save"),
 	)
 
 	// Create completers for each base command using the global subCommands variable
@@ -154,10 +173,22 @@ func (c *CLIInterface) newCompleter() readline.AutoCompleter {
 		// Special handling for config to add nested completion
 		if cmd == "/config" {
 			completers = append(completers, configCompleter)
+		} else if cmd == "/task" {
+			completers = append(completers, readline.PcItem(cmd, readline.PcItemDynamic(c.manager.taskNames)))
+		} else if cmd == "/attach" {
+			completers = append(completers, readline.PcItem(cmd, readline.PcItemDynamic(c.manager.attachCompletions)))
 		} else {
 			completers = append(completers, readline.PcItem(cmd))
 		}
 	}
 
+	for _, name := range c.manager.customCommandNames() {
+		var items []readline.PrefixCompleterInterface
+		for _, value := range c.manager.Config.Commands[name].Complete {
+			items = append(items, readline.PcItem(value))
+		}
+		completers = append(completers, readline.PcItem("/"+name, items...))
+	}
+
 	return readline.NewPrefixCompleter(completers...)
 }
@@ -3,9 +3,9 @@ package internal
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/alvinunreal/tmuxai/config"
 	"github.com/alvinunreal/tmuxai/logger"
 	"github.com/alvinunreal/tmuxai/system"
 )
@@ -15,8 +15,20 @@ const helpMessage = `Available commands:
 - /clear: Clear the chat history
 - /reset: Reset the chat history
 - /prepare: Prepare the pane for TmuxAI automation
-- /watch <prompt>: Start watch mode
+- /unprepare: Restore the original prompt of the exec pane
+- /watch [flags] [goal]: Start a background watcher, see /watch list
+- /watch list | stop <id|name|all> | pause <id|name> | resume <id|name>: Manage watchers
+- /watch approve <id|name> | reject <id|name>: Run or reject the command an acting watcher proposed
+- /attach <file|glob>... | clear: Attach files to the next message, or mention @path in a message
+- /task [list] | <name> [var=value...]: List or run tasks from ~/.config/tmuxai/tasks and .tmuxai/tasks
 - /squash: Summarize the chat history
+- /sandbox: Review sandbox changes and apply them
+- /checkpoints: List working tree checkpoints taken before agent commands
+- /rollback [n]: Restore the working tree to before step n (default: last step)
+- /approvals [revoke <n|all> | save <n>]: List, revoke or save "always allow" rules of this session
+- /config [get <key> | set <key> <value> | unset <key>]: Show the configuration or change it for this session
+- /config add <key> <item> | remove <key> <item>: Change a list such as whitelist_patterns for this session
+- /config save: Write the changes of this session to the config file
 - /exit: Exit the application`
 
 var commands = []string{
@@ -27,8 +39,15 @@ var commands = []string{
 	"/info",
 	"/watch",
 	"/prepare",
+	"/unprepare",
 	"/config",
 	"/squash",
+	"/sandbox",
+	"/checkpoints",
+	"/rollback",
+	"/approvals",
+	"/attach",
+	"/task",
 }
 
 // checks if the given content is a command
@@ -54,16 +73,16 @@ func (m *Manager) ProcessSubCommand(command string) {
 	commandPrefix := parts[0]
 
 	// Process the command using prefix matching
-	switch {
-	case prefixMatch(commandPrefix, "/help"):
-		m.Println(helpMessage)
+	switch chatCommandFor(commandPrefix) {
+	case "/help":
+		m.Println(helpMessage + m.customCommandsHelp())
 		return
 
-	case prefixMatch(commandPrefix, "/info"):
+	case "/info":
 		m.formatInfo()
 		return
 
-	case prefixMatch(commandPrefix, "/prepare"):
+	case "/prepare":
 		m.InitExecPane()
 		m.PrepareExecPane()
 		m.Messages = []ChatMessage{}
@@ -80,71 +99,112 @@ func (m *Manager) ProcessSubCommand(command string) {
 
 		return
 
-	case prefixMatch(commandPrefix, "/clear"):
+	case "/unprepare":
+		if m.UnprepareExecPane() {
+			m.Println("Exec pane prompt restored")
+		} else {
+			m.Println("Exec pane is not prepared or is busy")
+		}
+		return
+
+	case "/clear":
 		m.Messages = []ChatMessage{}
 		system.TmuxClearPane(m.PaneId)
 		return
 
-	case prefixMatch(commandPrefix, "/reset"):
-		m.Status = ""
+	case "/reset":
+		m.setState(StateIdle, "reset")
 		m.Messages = []ChatMessage{}
 		system.TmuxClearPane(m.PaneId)
 		system.TmuxClearPane(m.ExecPane.Id)
 		return
 
-	case prefixMatch(commandPrefix, "/exit"):
-		logger.Info("Exit command received, stopping watch mode (if active) and exiting.")
+	case "/exit":
+		logger.Info("Exit command received, stopping watchers and exiting.")
+		m.Shutdown()
 		os.Exit(0)
 		return
 
-	case prefixMatch(commandPrefix, "/squash"):
-		m.squashHistory()
-		return
-
-	case prefixMatch(commandPrefix, "/watch") || commandPrefix == "/w":
-		parts := strings.Fields(command)
-		if len(parts) > 1 {
-			watchDesc := strings.Join(parts[1:], " ")
-			startWatch := `
-1. Find out if there is new content in the pane based on chat history.
-2. Comment only considering the new content in this pane output.
-
-Watch for: ` + watchDesc
-			m.Status = "running"
-			m.WatchMode = true
-			m.startWatchMode(startWatch)
+	case "/sandbox":
+		if m.Sandbox == nil {
+			m.Println("Sandbox mode is not enabled, set sandbox.enabled in the config file")
 			return
 		}
-		m.Println("Usage: /watch <description>")
+		m.reviewSandbox()
 		return
 
-	case prefixMatch(commandPrefix, "/config"):
-		// Helper function to check if a key is allowed
-		isKeyAllowed := func(key string) bool {
-			for _, k := range AllowedConfigKeys {
-				if k == key {
-					return true
-				}
-			}
-			return false
+	case "/checkpoints":
+		if len(m.Checkpoints) == 0 {
+			m.Println("No checkpoints recorded yet")
+			return
+		}
+		formatter := system.NewInfoFormatter()
+		for _, c := range m.Checkpoints {
+			fmt.Printf("%s %s %s\n   %s\n",
+				formatter.LabelColor.Sprintf("%3d", c.Step),
+				formatter.NeutralColor.Sprint(c.CreatedAt.Format("15:04:05")),
+				formatter.ValueColor.Sprint(c.Dir),
+				c.Command)
 		}
+		return
 
-		// Check if it's "config set" for a specific key
-		if len(parts) >= 3 && parts[1] == "set" {
-			key := parts[2]
-			if !isKeyAllowed(key) {
-				m.Println(fmt.Sprintf("Cannot set '%s'. Only these keys are allowed: %s", key, strings.Join(AllowedConfigKeys, ", ")))
+	case "/rollback":
+		step := len(m.Checkpoints)
+		if len(parts) > 1 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				m.Println("Usage: /rollback [n]")
 				return
 			}
-			value := strings.Join(parts[3:], " ")
-			m.SessionOverrides[key] = config.TryInferType(key, value)
-			m.Println(fmt.Sprintf("Set %s = %v", key, m.SessionOverrides[key]))
+			step = n
+		}
+		if step == 0 {
+			m.Println("No checkpoints recorded yet")
 			return
-		} else {
-			code, _ := system.HighlightCode("yaml", m.FormatConfig())
-			fmt.Println(code)
+		}
+		if step < 1 || step > len(m.Checkpoints) {
+			m.Println(fmt.Sprintf("No checkpoint %d, see /checkpoints", step))
 			return
 		}
+		c := m.Checkpoints[step-1]
+		if !m.confirmYesNo(fmt.Sprintf("Restore %s to before step %d (%s)?", c.Dir, step, c.Command)) {
+			return
+		}
+		if err := m.rollback(step); err != nil {
+			m.Println("Rollback failed: " + err.Error())
+			return
+		}
+		logger.Info("Rolled back %s to checkpoint %d", c.Dir, step)
+		m.Println(fmt.Sprintf("Restored %s to before step %d", c.Dir, step))
+		return
+
+	case "/approvals":
+		m.processApprovalsCommand(parts[1:])
+		return
+
+	case "/attach":
+		_, args, _ := strings.Cut(strings.TrimSpace(command), " ")
+		m.processAttachCommand(strings.TrimSpace(args))
+		return
+
+	case "/task":
+		// running a task is handled by the chat like a message
+		m.listTasks()
+		return
+
+	case "/squash":
+		m.squashHistory()
+		return
+
+	case "/watch":
+		_, args, _ := strings.Cut(strings.TrimSpace(command), " ")
+		m.processWatchCommand(strings.TrimSpace(args))
+		return
+
+	case "/config":
+		_, args, _ := strings.Cut(strings.TrimSpace(command), " ")
+		m.processConfigCommand(strings.TrimSpace(args))
+		return
 
 	default:
 		m.Println(fmt.Sprintf("Unknown command: %s. Type '/help' to see available commands.", command))
@@ -152,6 +212,24 @@ Watch for: ` + watchDesc
 	}
 }
 
+// commandPrecedence decides which command a prefix runs when it matches several, e.g.
+// "/s" runs /squash and "/sa" /sandbox. Commands are only ever appended so the short
+// prefixes users know keep their meaning.
+var commandPrecedence = []string{
+	"/help", "/info", "/prepare", "/clear", "/reset", "/exit", "/squash", "/watch", "/config",
+	"/unprepare", "/sandbox", "/checkpoints", "/rollback", "/approvals", "/attach", "/task",
+}
+
+// chatCommandFor returns the command prefix is short for, or "" if there is none
+func chatCommandFor(prefix string) string {
+	for _, command := range commandPrecedence {
+		if prefixMatch(prefix, command) {
+			return command
+		}
+	}
+	return ""
+}
+
 // Helper function to check if a command matches a prefix
 func prefixMatch(command, target string) bool {
 	return strings.HasPrefix(target, command)
@@ -171,13 +249,23 @@ func (m *Manager) formatInfo() {
 	formatLine("Version", Version)
 	formatLine("Max Capture Lines", m.Config.MaxCaptureLines)
 	formatLine("Wait Interval", m.Config.WaitInterval)
+	if m.Sandbox != nil {
+		network := "off"
+		if m.Sandbox.Network {
+			network = "on"
+		}
+		formatLine("Sandbox", fmt.Sprintf("%s (%s, network %s)", m.Sandbox.ProjectDir, m.Sandbox.Backend, network))
+		formatLine("Sandbox Scratch", m.Sandbox.ScratchDir)
+	} else {
+		formatLine("Sandbox", "off")
+	}
 
 	// Display context information section
 	fmt.Println(formatter.FormatSection("\nContext"))
 	formatLine("Messages", len(m.Messages))
 	var totalTokens int
 	for _, msg := range m.Messages {
-		totalTokens += system.EstimateTokenCount(msg.Content)
+		totalTokens += system.EstimateTokenCount(msg.text())
 	}
 
 	usagePercent := 0.0
@@ -0,0 +1,35 @@
+// Tests for resolving chat command prefixes in chat_command.go
+package internal
+
+import "testing"
+
+func TestChatCommandFor(t *testing.T) {
+	// the commands and their order before the sandbox, checkpoints, approvals, attach and
+	// task commands were added: every prefix must still run the same command
+	original := []string{"/help", "/info", "/prepare", "/clear", "/reset", "/exit", "/squash", "/watch", "/config"}
+	for _, command := range original {
+		for n := 2; n <= len(command); n++ {
+			prefix := command[:n]
+			want := ""
+			for _, c := range original {
+				if prefixMatch(prefix, c) {
+					want = c
+					break
+				}
+			}
+			if got := chatCommandFor(prefix); got != want {
+				t.Errorf("%s: expected %s, got %s", prefix, want, got)
+			}
+		}
+	}
+
+	for prefix, want := range map[string]string{
+		"/s": "/squash", "/sa": "/sandbox", "/c": "/clear", "/ch": "/checkpoints", "/r": "/reset",
+		"/ro": "/rollback", "/u": "/unprepare", "/a": "/approvals", "/at": "/attach", "/t": "/task",
+		"/w": "/watch", "/nope": "",
+	} {
+		if got := chatCommandFor(prefix); got != want {
+			t.Errorf("%s: expected %q, got %q", prefix, want, got)
+		}
+	}
+}
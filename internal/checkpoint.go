@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// Checkpoint is the state of a working tree recorded before an agent command ran
+type Checkpoint struct {
+	Step      int
+	Command   string
+	Dir       string // git toplevel or configured directory
+	Git       bool
+	Ref       string // git ref keeping the snapshot commit, or the snapshot directory
+	CreatedAt time.Time
+}
+
+// createCheckpoint snapshots the exec pane's working tree before command runs.
+// Only git repositories and directories listed in checkpoints.directories are recorded.
+// Read-only commands are skipped, and so are subshells such as ssh, whose directory is not
+// on this machine, and the sandbox, which does not touch the project.
+func (m *Manager) createCheckpoint(command string) {
+	if !m.Config.Checkpoints.Enabled || m.ExecPane.CurrentPath == "" || m.ExecPane.IsSubShell {
+		return
+	}
+	if m.Sandbox != nil && m.ExecPane.Id == m.Sandbox.PaneId {
+		return
+	}
+	if m.assessRisk(command).Level == RiskReadOnly {
+		return
+	}
+
+	step := len(m.Checkpoints) + 1
+	checkpoint := Checkpoint{
+		Step:      step,
+		Command:   command,
+		CreatedAt: time.Now(),
+	}
+
+	if top, err := gitOutput(m.ExecPane.CurrentPath, nil, "rev-parse", "--show-toplevel"); err == nil {
+		commit, err := gitSnapshot(top)
+		if err != nil {
+			logger.Error("Failed to create git checkpoint in %s: %v", top, err)
+			return
+		}
+		ref := fmt.Sprintf("refs/tmuxai/checkpoints/%s/%d", m.SessionId, step)
+		if _, err := gitOutput(top, nil, "update-ref", ref, commit); err != nil {
+			logger.Error("Failed to store checkpoint ref %s: %v", ref, err)
+			return
+		}
+		checkpoint.Dir = top
+		checkpoint.Git = true
+		checkpoint.Ref = ref
+	} else if dir := m.checkpointDirFor(m.ExecPane.CurrentPath); dir != "" {
+		configDir, err := config.GetConfigDir()
+		if err != nil {
+			return
+		}
+		snapshot := filepath.Join(configDir, "checkpoints", m.SessionId, fmt.Sprintf("%d", step))
+		if err := os.MkdirAll(snapshot, 0o755); err != nil {
+			logger.Error("Failed to create checkpoint directory: %v", err)
+			return
+		}
+		if out, err := exec.Command("cp", "-a", dir+"/.", snapshot).CombinedOutput(); err != nil {
+			logger.Error("Failed to copy %s for checkpoint: %v: %s", dir, err, out)
+			return
+		}
+		checkpoint.Dir = dir
+		checkpoint.Ref = snapshot
+	} else {
+		return
+	}
+
+	m.Checkpoints = append(m.Checkpoints, checkpoint)
+	logger.Info("Checkpoint %d of %s recorded before: %s", step, checkpoint.Dir, command)
+}
+
+// checkpointDirFor returns the configured checkpoint directory containing path
+func (m *Manager) checkpointDirFor(path string) string {
+	for _, dir := range m.Config.Checkpoints.Directories {
+		dir = expandHome(dir)
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return dir
+		}
+	}
+	return ""
+}
+
+// rollback restores the working tree to the state recorded before step
+func (m *Manager) rollback(step int) error {
+	if step < 1 || step > len(m.Checkpoints) {
+		return fmt.Errorf("no checkpoint %d, see /checkpoints", step)
+	}
+	checkpoint := m.Checkpoints[step-1]
+
+	if !checkpoint.Git {
+		return syncDir(checkpoint.Ref, checkpoint.Dir)
+	}
+
+	// files added after the checkpoint are not in its tree, find and remove them
+	current, err := gitSnapshot(checkpoint.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot current state: %w", err)
+	}
+	added, err := gitOutput(checkpoint.Dir, nil, "diff-tree", "-r", "--name-only", "--diff-filter=A", checkpoint.Ref, current)
+	if err != nil {
+		return fmt.Errorf("failed to list added files: %w", err)
+	}
+	for _, file := range strings.Split(added, "\n") {
+		if file == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(checkpoint.Dir, file)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", file, err)
+		}
+	}
+
+	// check out the snapshot through a temporary index so the user's staging area is untouched
+	index, err := os.CreateTemp("", "tmuxai-index-")
+	if err != nil {
+		return err
+	}
+	index.Close()
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	if _, err := gitOutput(checkpoint.Dir, env, "read-tree", checkpoint.Ref+"^{tree}"); err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if _, err := gitOutput(checkpoint.Dir, env, "checkout-index", "-a", "-f"); err != nil {
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+	return nil
+}
+
+// removeCheckpoints deletes the git refs and snapshot directories of this session
+func (m *Manager) removeCheckpoints() {
+	for _, checkpoint := range m.Checkpoints {
+		if checkpoint.Git {
+			gitOutput(checkpoint.Dir, nil, "update-ref", "-d", checkpoint.Ref)
+		} else {
+			os.RemoveAll(checkpoint.Ref)
+		}
+	}
+	m.Checkpoints = nil
+}
+
+// gitSnapshot records the working tree, including untracked but not ignored files,
+// as a commit object without touching the user's index, HEAD or stash.
+func gitSnapshot(dir string) (string, error) {
+	index, err := os.CreateTemp("", "tmuxai-index-")
+	if err != nil {
+		return "", err
+	}
+	index.Close()
+	defer os.Remove(index.Name())
+
+	// start from the real index so git can reuse its stat cache
+	if realIndex, err := gitOutput(dir, nil, "rev-parse", "--path-format=absolute", "--git-path", "index"); err == nil {
+		if data, err := os.ReadFile(realIndex); err == nil {
+			os.WriteFile(index.Name(), data, 0o600)
+		}
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	if _, err := gitOutput(dir, env, "add", "-A"); err != nil {
+		return "", err
+	}
+	tree, err := gitOutput(dir, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	env = append(env,
+		"GIT_AUTHOR_NAME=TmuxAI", "GIT_AUTHOR_EMAIL=tmuxai@localhost",
+		"GIT_COMMITTER_NAME=TmuxAI", "GIT_COMMITTER_EMAIL=tmuxai@localhost",
+	)
+	return gitOutput(dir, env, "commit-tree", tree, "-m", "tmuxai checkpoint")
+}
+
+// gitOutput runs git in dir and returns its trimmed stdout
+func gitOutput(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -0,0 +1,115 @@
+// Tests for git checkpoints in checkpoint.go
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+func TestCheckpoint_GitRollback(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return string(data)
+	}
+
+	run("init", "-q")
+	write("tracked.txt", "original\n")
+	write(".gitignore", "ignored.txt\n")
+	run("add", ".")
+	run("-c", "user.name=t", "-c", "user.email=t@t", "commit", "-qm", "init")
+	write("untracked.txt", "draft\n")
+
+	cfg := config.DefaultConfig()
+	m := &Manager{
+		Config:    cfg,
+		SessionId: "test",
+		ExecPane:  &system.TmuxPaneDetails{CurrentPath: dir},
+	}
+	m.createCheckpoint("rm -rf everything")
+	if len(m.Checkpoints) != 1 {
+		t.Fatalf("expected a checkpoint, got %d", len(m.Checkpoints))
+	}
+
+	write("tracked.txt", "trashed\n")
+	os.Remove(filepath.Join(dir, "untracked.txt"))
+	write("new.txt", "created by agent\n")
+	write("ignored.txt", "keep me\n")
+
+	if err := m.rollback(1); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if got := read("tracked.txt"); got != "original\n" {
+		t.Errorf("tracked.txt = %q", got)
+	}
+	if got := read("untracked.txt"); got != "draft\n" {
+		t.Errorf("untracked.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("new.txt should be removed")
+	}
+	if got := read("ignored.txt"); got != "keep me\n" {
+		t.Errorf("ignored files must not be touched, got %q", got)
+	}
+
+	m.removeCheckpoints()
+	cmd := exec.Command("git", "-C", dir, "for-each-ref", "refs/tmuxai")
+	if out, _ := cmd.Output(); len(out) != 0 {
+		t.Errorf("checkpoint refs left behind: %s", out)
+	}
+}
+
+func TestCreateCheckpoint_Skips(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, "notes")
+	os.MkdirAll(filepath.Join(dir, "..data"), 0o755)
+
+	cfg := config.DefaultConfig()
+	cfg.Checkpoints.Directories = []string{dir}
+	m := &Manager{Config: cfg, SessionId: "test", ExecPane: &system.TmuxPaneDetails{Id: "%1", CurrentPath: filepath.Join(dir, "..data")}}
+	if got := m.checkpointDirFor(filepath.Join(dir, "..data")); got != dir {
+		t.Errorf("a subdirectory starting with .. is inside the directory, got %q", got)
+	}
+	if got := m.checkpointDirFor(filepath.Join(home, "notes-old")); got != "" {
+		t.Errorf("a sibling directory is not inside the directory, got %q", got)
+	}
+
+	m.createCheckpoint("ls -la")
+	if len(m.Checkpoints) != 0 {
+		t.Error("read-only commands should not be checkpointed")
+	}
+	m.ExecPane.IsSubShell = true
+	m.createCheckpoint("touch file")
+	m.ExecPane.IsSubShell = false
+	m.Sandbox = &Sandbox{PaneId: "%1"}
+	m.createCheckpoint("touch file")
+	if len(m.Checkpoints) != 0 {
+		t.Error("subshells and the sandbox should not be checkpointed")
+	}
+	m.Sandbox = nil
+	m.createCheckpoint("touch file")
+	if len(m.Checkpoints) != 1 {
+		t.Errorf("expected a checkpoint of %s, got %d", dir, len(m.Checkpoints))
+	}
+	m.removeCheckpoints()
+}
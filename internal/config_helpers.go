@@ -2,20 +2,16 @@ package internal
 
 import (
 	"fmt"
+	"maps"
 	"reflect"
+	"slices"
+	"sort"
 	"strings"
-)
 
-// AllowedConfigKeys defines the list of configuration keys that users are allowed to modify
-var AllowedConfigKeys = []string{
-	"max_capture_lines",
-	"max_context_size",
-	"wait_interval",
-	"send_keys_confirm",
-	"paste_multiline_confirm",
-	"exec_confirm",
-	"openrouter.model",
-}
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+)
 
 // GetMaxCaptureLines returns the max capture lines value with session override if present
 func (m *Manager) GetMaxCaptureLines() int {
@@ -48,6 +44,10 @@ func (m *Manager) GetWaitInterval() int {
 }
 
 func (m *Manager) GetSendKeysConfirm() bool {
+	// headless runs decide every action with their approval policy
+	if m.headless != nil {
+		return true
+	}
 	if override, exists := m.SessionOverrides["send_keys_confirm"]; exists {
 		if val, ok := override.(bool); ok {
 			return val
@@ -57,6 +57,10 @@ func (m *Manager) GetSendKeysConfirm() bool {
 }
 
 func (m *Manager) GetPasteMultilineConfirm() bool {
+	// headless runs decide every action with their approval policy
+	if m.headless != nil {
+		return true
+	}
 	if override, exists := m.SessionOverrides["paste_multiline_confirm"]; exists {
 		if val, ok := override.(bool); ok {
 			return val
@@ -66,6 +70,10 @@ func (m *Manager) GetPasteMultilineConfirm() bool {
 }
 
 func (m *Manager) GetExecConfirm() bool {
+	// headless runs decide every action with their approval policy
+	if m.headless != nil {
+		return true
+	}
 	if override, exists := m.SessionOverrides["exec_confirm"]; exists {
 		if val, ok := override.(bool); ok {
 			return val
@@ -83,15 +91,45 @@ func (m *Manager) GetOpenRouterModel() string {
 	return m.Config.OpenRouter.Model
 }
 
-// FormatConfig returns a nicely formatted string of all config values with session overrides applied
+// GetLimits returns the autonomy limits with session overrides applied
+func (m *Manager) GetLimits() config.LimitsConfig {
+	limits := m.Config.Limits
+	intOverride := func(key string, target *int) {
+		if val, ok := m.SessionOverrides[key].(int); ok {
+			*target = val
+		}
+	}
+	intOverride("limits.max_steps", &limits.MaxSteps)
+	intOverride("limits.max_duration", &limits.MaxDuration)
+	intOverride("limits.max_tokens", &limits.MaxTokens)
+	intOverride("limits.max_commands", &limits.MaxCommands)
+	switch val := m.SessionOverrides["limits.max_cost"].(type) {
+	case float64:
+		limits.MaxCost = val
+	case int:
+		limits.MaxCost = float64(val)
+	}
+	return limits
+}
+
+// FormatConfig returns a nicely formatted string of all config values with session overrides
+// applied, each value set by a layer is followed by the layer, e.g. # project
 func (m *Manager) FormatConfig() string {
 	var result strings.Builder
-	formatConfigValue(&result, "", reflect.ValueOf(m.Config).Elem(), m.SessionOverrides, 1)
+	formatConfigValue(&result, "", reflect.ValueOf(m.Config).Elem(), m.SessionOverrides, m.configSource, 1)
 	return result.String()
 }
 
+// configSource returns the layer the value of key in this session comes from
+func (m *Manager) configSource(key string) string {
+	if _, exists := m.SessionOverrides[key]; exists {
+		return config.LayerSession
+	}
+	return m.Config.Source(key)
+}
+
 // formatConfigValue recursively formats config values using reflection
-func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, overrides map[string]interface{}, indent int) {
+func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, overrides map[string]interface{}, source func(string) string, indent int) {
 	typ := val.Type()
 
 	indentStr := ""
@@ -105,6 +143,9 @@ func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, ov
 
 		// Get the field name from mapstructure tag or use field name
 		tag := fieldType.Tag.Get("mapstructure")
+		if tag == "-" {
+			continue
+		}
 		if tag == "" {
 			tag = strings.ToLower(fieldType.Name)
 		}
@@ -118,7 +159,7 @@ func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, ov
 		// Handle nested structs
 		if field.Kind() == reflect.Struct {
 			sb.WriteString(fmt.Sprintf("%s%s:\n", indentStr, tag))
-			formatConfigValue(sb, key, field, overrides, indent+1)
+			formatConfigValue(sb, key, field, overrides, source, indent+1)
 			continue
 		}
 
@@ -127,8 +168,8 @@ func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, ov
 		switch field.Kind() {
 		case reflect.String:
 			// Mask API keys for security
-			if strings.Contains(strings.ToLower(fieldType.Name), "apikey") {
-				valueStr = maskAPIKey(field.String())
+			if tag == "api_key" {
+				valueStr = describeAPIKey(field.String(), val.FieldByName("APIKeySource").String())
 			} else {
 				valueStr = field.String()
 			}
@@ -144,9 +185,11 @@ func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, ov
 
 		// Check if there's a session override for this key
 		if override, exists := overrides[key]; exists {
-			sb.WriteString(fmt.Sprintf("%s%s: %v", indentStr, tag, override))
-		} else {
-			sb.WriteString(fmt.Sprintf("%s%s: %s", indentStr, tag, valueStr))
+			valueStr = fmt.Sprintf("%v", override)
+		}
+		sb.WriteString(fmt.Sprintf("%s%s: %s", indentStr, tag, valueStr))
+		if layer := source(key); layer != config.LayerDefault {
+			sb.WriteString(" # " + layer)
 		}
 
 		sb.WriteString("\n")
@@ -160,3 +203,313 @@ func maskAPIKey(key string) string {
 	}
 	return key[:4] + "..." + key[len(key)-4:]
 }
+
+// describeAPIKey masks key and names its source when it is not api_key, e.g. the keyring
+func describeAPIKey(key, source string) string {
+	switch {
+	case key == "":
+		return ""
+	case source == "" || source == config.APIKeyFromConfig:
+		return maskAPIKey(key)
+	}
+	return maskAPIKey(key) + " (from " + source + ")"
+}
+
+// apiKeyRequired explains where the API key can be set when none was found
+const apiKeyRequired = "OpenRouter API key is required. Set openrouter.api_key_cmd, api_key_file or api_key in the config file, " +
+	"TMUXAI_OPENROUTER_API_KEY, or store it in the keyring with: tmuxai auth set"
+
+const configUsage = `Usage: /config [get <key> | set <key> <value> | unset <key> | add <key> <item> | remove <key> <item> | save]`
+
+// processConfigCommand handles /config: without arguments it shows the configuration,
+// otherwise it changes it for this session until the changes are saved to the config file
+func (m *Manager) processConfigCommand(input string) {
+	if input == "" {
+		code, _ := system.HighlightCode("yaml", m.FormatConfig())
+		fmt.Println(code)
+		return
+	}
+	// values are taken as typed, e.g. regexes with spaces and capitals
+	sub, rest, _ := strings.Cut(input, " ")
+	key, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	value = unquote(strings.TrimSpace(value))
+
+	var err error
+	switch {
+	case sub == "get" && key != "" && value == "":
+		err = m.printConfigValue(key)
+	case sub == "set" && key != "" && value != "":
+		err = m.setConfigValue(key, value)
+	case sub == "unset" && key != "" && value == "":
+		err = m.unsetConfigValue(key)
+	case sub == "add" && key != "" && value != "":
+		err = m.addConfigItem(key, value)
+	case sub == "remove" && key != "" && value != "":
+		err = m.removeConfigItem(key, value)
+	case sub == "save" && key == "":
+		err = m.saveConfigOverrides()
+	default:
+		m.Println(configUsage)
+		return
+	}
+	if err != nil {
+		m.Println(err.Error())
+	}
+}
+
+// unquote removes quotes around a whole value, e.g. '^git status'
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// configValue returns the value of key in this session
+func (m *Manager) configValue(key string) (any, error) {
+	if override, exists := m.SessionOverrides[key]; exists {
+		return override, nil
+	}
+	return config.GetValue(m.Config, key)
+}
+
+// printConfigValue handles /config get
+func (m *Manager) printConfigValue(key string) error {
+	value, err := m.configValue(key)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("%v", value)
+	if s, ok := value.(string); ok && key == "openrouter.api_key" {
+		text = describeAPIKey(s, m.Config.OpenRouter.APIKeySource)
+	}
+	if layer := m.configSource(key); layer != config.LayerDefault {
+		text += " (" + layer + ")"
+	}
+	m.Println(fmt.Sprintf("%s = %s", key, text))
+	return nil
+}
+
+// setConfigValue handles /config set, value is checked against the type of key
+func (m *Manager) setConfigValue(key, value string) error {
+	typed, err := config.ParseValue(key, value)
+	if err != nil {
+		return err
+	}
+	if err := m.overrideConfig(key, typed); err != nil {
+		return err
+	}
+	m.Println(fmt.Sprintf("Set %s = %v for this session, /config save keeps it", key, typed))
+	return nil
+}
+
+// addConfigItem handles /config add, appending item to the list at key
+func (m *Manager) addConfigItem(key, item string) error {
+	if err := config.ValidateListItem(key, item); err != nil {
+		return err
+	}
+	value, err := m.configValue(key)
+	if err != nil {
+		return err
+	}
+	list := value.([]string)
+	if slices.Contains(list, item) {
+		return fmt.Errorf("%s already contains '%s'", key, item)
+	}
+	if err := m.overrideConfig(key, append(slices.Clone(list), item)); err != nil {
+		return err
+	}
+	m.Println(fmt.Sprintf("Added '%s' to %s for this session, /config save keeps it", item, key))
+	return nil
+}
+
+// removeConfigItem handles /config remove, dropping item from the list at key
+func (m *Manager) removeConfigItem(key, item string) error {
+	if !config.IsListKey(key) {
+		return fmt.Errorf("%s is not a list", key)
+	}
+	value, err := m.configValue(key)
+	if err != nil {
+		return err
+	}
+	list := value.([]string)
+	if !slices.Contains(list, item) {
+		return fmt.Errorf("%s does not contain '%s'", key, item)
+	}
+	list = slices.DeleteFunc(slices.Clone(list), func(s string) bool { return s == item })
+	if err := m.overrideConfig(key, list); err != nil {
+		return err
+	}
+	m.Println(fmt.Sprintf("Removed '%s' from %s for this session, /config save keeps it", item, key))
+	return nil
+}
+
+// overrideConfig changes key for this session. The config value is replaced too so code
+// reading m.Config directly sees the change, the original is kept for /config unset.
+func (m *Manager) overrideConfig(key string, value any) error {
+	if _, saved := m.configOriginals[key]; !saved {
+		original, err := config.GetValue(m.Config, key)
+		if err != nil {
+			return err
+		}
+		if list, ok := original.([]string); ok {
+			original = slices.Clone(list)
+		}
+		if m.configOriginals == nil {
+			m.configOriginals = make(map[string]any)
+		}
+		m.configOriginals[key] = original
+	}
+	if err := config.SetValue(m.Config, key, value); err != nil {
+		return err
+	}
+	m.SessionOverrides[key] = value
+	return nil
+}
+
+// unsetConfigValue handles /config unset, restoring the value of the config file
+func (m *Manager) unsetConfigValue(key string) error {
+	if _, exists := m.SessionOverrides[key]; !exists {
+		if _, err := config.GetValue(m.Config, key); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s is not changed in this session", key)
+	}
+	if original, saved := m.configOriginals[key]; saved {
+		if err := config.SetValue(m.Config, key, original); err != nil {
+			return err
+		}
+		delete(m.configOriginals, key)
+	}
+	delete(m.SessionOverrides, key)
+	value, _ := config.GetValue(m.Config, key)
+	m.Println(fmt.Sprintf("Unset %s, back to %v", key, value))
+	return nil
+}
+
+// saveConfigOverrides handles /config save, writing the session changes to the config file.
+// Lists are saved as the items added and removed, keeping the comments between the others.
+func (m *Manager) saveConfigOverrides() error {
+	if len(m.SessionOverrides) == 0 {
+		m.Println("Nothing changed in this session, see /config set")
+		return nil
+	}
+	keys := make([]string, 0, len(m.SessionOverrides))
+	for key := range m.SessionOverrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var shadowed []string
+	for _, key := range keys {
+		value := m.SessionOverrides[key]
+		if list, ok := value.([]string); ok {
+			original, _ := m.configOriginals[key].([]string)
+			for _, item := range list {
+				if !slices.Contains(original, item) {
+					if err := config.AppendListValue(key, item); err != nil {
+						return fmt.Errorf("failed to save %s: %w", key, err)
+					}
+				}
+			}
+			for _, item := range original {
+				if !slices.Contains(list, item) {
+					if err := config.RemoveListValue(key, item); err != nil {
+						return fmt.Errorf("failed to save %s: %w", key, err)
+					}
+				}
+			}
+		} else if err := config.WriteValue(key, value); err != nil {
+			return fmt.Errorf("failed to save %s: %w", key, err)
+		}
+		// the saved value is now the one of the config file
+		if err := config.SetValue(m.Config, key, value); err != nil {
+			return err
+		}
+		if layer := m.Config.Source(key); layer != config.LayerDefault && layer != config.LayerUser {
+			shadowed = append(shadowed, fmt.Sprintf("%s is also set in %s, which takes precedence when tmuxai starts", key, m.Config.SourceFile(key)))
+		} else if m.Config.Sources != nil {
+			m.Config.Sources[key] = config.LayerUser
+		}
+		delete(m.SessionOverrides, key)
+		delete(m.configOriginals, key)
+	}
+	logger.Info("Saved config changes %v to %s", keys, config.ConfigFilePath())
+	m.Println(fmt.Sprintf("Saved %s to %s", strings.Join(keys, ", "), config.ConfigFilePath()))
+	for _, note := range shadowed {
+		m.Println(note)
+	}
+	return nil
+}
+
+// snapshotConfig copies the config for a watcher, which keeps using it in the background
+// while the chat replaces or changes m.Config
+func (m *Manager) snapshotConfig() *config.Config {
+	cfg := *m.Config
+	cfg.WhitelistPatterns = slices.Clone(cfg.WhitelistPatterns)
+	cfg.BlacklistPatterns = slices.Clone(cfg.BlacklistPatterns)
+	cfg.AllowedWritePaths = slices.Clone(cfg.AllowedWritePaths)
+	cfg.RiskRules = slices.Clone(cfg.RiskRules)
+	cfg.WatchAct.Allow = slices.Clone(cfg.WatchAct.Allow)
+	cfg.Attach.RedactPatterns = slices.Clone(cfg.Attach.RedactPatterns)
+	cfg.Notify.Notifiers = maps.Clone(cfg.Notify.Notifiers)
+	for _, list := range []*[]string{&cfg.Notify.Accomplished, &cfg.Notify.WaitingForUser, &cfg.Notify.Confirmation,
+		&cfg.Notify.Error, &cfg.Notify.Watch, &cfg.Notify.Trigger} {
+		*list = slices.Clone(*list)
+	}
+	return &cfg
+}
+
+// refreshProjectConfig reloads the configuration when the exec pane is in a directory with
+// another project config than the one loaded, e.g. after cd into another repository.
+// The changes of this session are applied again on top of the reloaded layers.
+func (m *Manager) refreshProjectConfig() {
+	if m.ExecPane != nil && m.ExecPane.Id != "" {
+		if panes, err := m.GetTmuxPanes(); err == nil {
+			for _, pane := range panes {
+				if pane.Id == m.ExecPane.Id {
+					m.ExecPane.CurrentPath = pane.CurrentPath
+				}
+			}
+		}
+	}
+	dir := m.taskDir()
+	if config.FindProjectConfig(dir) == m.Config.ProjectFile {
+		return
+	}
+
+	cfg, err := config.LoadLayers(config.Layers{ProjectDir: dir, TmuxTarget: m.PaneId})
+	if err != nil {
+		m.Println("Keeping the current configuration, the project config is invalid:\n" + err.Error())
+		return
+	}
+	if err := cfg.OpenRouter.ResolveAPIKey(); err != nil {
+		m.Println("Keeping the current configuration: " + err.Error())
+		return
+	}
+	originals := make(map[string]any)
+	for key, value := range m.SessionOverrides {
+		original, err := config.GetValue(cfg, key)
+		if err != nil {
+			continue
+		}
+		originals[key] = original
+		config.SetValue(cfg, key, value)
+	}
+	previous := m.Config.ProjectFile
+	// copied in place, the AI client keeps a pointer to the openrouter section
+	*m.Config = *cfg
+	m.configOriginals = originals
+
+	for _, warning := range cfg.Warnings {
+		m.Println(warning)
+	}
+	switch {
+	case cfg.ProjectFile != "":
+		logger.Info("Loaded project config %s", cfg.ProjectFile)
+		m.Println("Using project config " + cfg.ProjectFile)
+	case previous != "":
+		logger.Info("Left project config %s", previous)
+		m.Println("Left project config " + previous)
+	}
+}
@@ -0,0 +1,99 @@
+// Tests for the /config command in config_helpers.go
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestConfigCommand_SetGetUnset(t *testing.T) {
+	m := &Manager{Config: config.DefaultConfig(), SessionOverrides: map[string]interface{}{}}
+	m.Config.OpenRouter.Model = "file-model"
+
+	m.processConfigCommand("set openrouter.model Vendor/Model-X")
+	if m.GetOpenRouterModel() != "Vendor/Model-X" || m.Config.OpenRouter.Model != "Vendor/Model-X" {
+		t.Errorf("model should be set as typed, got %q", m.GetOpenRouterModel())
+	}
+	m.processConfigCommand("set exec_confirm false")
+	m.processConfigCommand("set limits.max_cost 2.5")
+	m.processConfigCommand("set watch_act.period 2m")
+	if m.GetExecConfirm() || m.GetLimits().MaxCost != 2.5 || m.Config.WatchAct.Period != 2*time.Minute {
+		t.Errorf("typed overrides not applied: %v", m.SessionOverrides)
+	}
+
+	for input, want := range map[string]string{
+		"max_capture_lines lots":   "must be a whole number",
+		"exec_confirm maybe":       "must be true or false",
+		"whitelist_patterns ^ls":   "is a list",
+		"openrouter.api_key sk-1":  "can only be set in the config file",
+		"nonexistent 1":            "unknown config key",
+		"notify.notifiers foo":     "can only be set in the config file",
+		"watch_act.period forever": "must be a duration",
+	} {
+		if err := m.setConfigValue(strings.Fields(input)[0], strings.Fields(input)[1]); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("set %s: expected %q, got %v", input, want, err)
+		}
+	}
+
+	if value, _ := m.configValue("exec_confirm"); value != false {
+		t.Errorf("unexpected value %v", value)
+	}
+	m.processConfigCommand("unset openrouter.model")
+	if m.GetOpenRouterModel() != "file-model" || m.Config.OpenRouter.Model != "file-model" {
+		t.Errorf("unset should restore the model, got %q", m.GetOpenRouterModel())
+	}
+	if err := m.unsetConfigValue("openrouter.model"); err == nil {
+		t.Error("expected an error for a key which is not overridden")
+	}
+}
+
+func TestConfigCommand_ListsAndSave(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".config", "tmuxai", "config.yaml")
+	os.MkdirAll(filepath.Dir(configPath), 0o755)
+	os.WriteFile(configPath, []byte(`# my settings
+exec_confirm: true # ask first
+whitelist_patterns:
+  # read-only
+  - '^ls'
+  - '^cat\s'
+`), 0o644)
+
+	m := &Manager{Config: config.DefaultConfig(), SessionOverrides: map[string]interface{}{}}
+	m.Config.WhitelistPatterns = []string{`^ls`, `^cat\s`}
+
+	if err := m.addConfigItem("whitelist_patterns", "^git (status|diff"); err == nil || !strings.Contains(err.Error(), "invalid regex") {
+		t.Errorf("expected an invalid regex to be refused, got %v", err)
+	}
+	m.processConfigCommand(`add whitelist_patterns '^git status( |$)'`)
+	m.processConfigCommand(`remove whitelist_patterns ^cat\s`)
+	if !m.checkPolicy("git status").Approved || m.checkPolicy("cat foo").Approved {
+		t.Errorf("list changes should apply to the policy, got %v", m.Config.WhitelistPatterns)
+	}
+	m.processConfigCommand("set exec_confirm false")
+	m.processConfigCommand("set max_capture_lines 500")
+
+	m.processConfigCommand("save")
+	if len(m.SessionOverrides) != 0 {
+		t.Errorf("saved overrides should be cleared, got %v", m.SessionOverrides)
+	}
+	data, _ := os.ReadFile(configPath)
+	content := string(data)
+	for _, want := range []string{"# my settings", "exec_confirm: false # ask first", "# read-only", "'^ls'", `'^git status( |$)'`, "max_capture_lines: 500"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("config missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, `^cat`) {
+		t.Errorf("removed pattern should be gone:\n%s", content)
+	}
+	if m.GetExecConfirm() || m.GetMaxCaptureLines() != 500 {
+		t.Error("saved values should stay in effect")
+	}
+}
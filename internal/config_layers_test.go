@@ -0,0 +1,146 @@
+// Tests for the configuration layers in config/layers.go and refreshProjectConfig in config_helpers.go
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// writeProjectConfig writes .tmuxai.yaml into a new project directory and returns the directory
+func writeProjectConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, config.ProjectConfigName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadLayers_Precedence(t *testing.T) {
+	writeConfigFile(t, `context: "I use fish"
+max_capture_lines: 300
+openrouter:
+  model: user/model
+`)
+	project := writeProjectConfig(t, `context: "this repo uses pnpm and Go 1.22"
+max_capture_lines: 400
+exec_confirm: false
+openrouter:
+  model: project/model
+  base_url: http://example.com
+limits:
+  max_steps: 5
+checkpoints:
+  enabled: false
+`)
+	sub := filepath.Join(project, "cmd", "app")
+	os.MkdirAll(sub, 0o755)
+	t.Setenv("TMUXAI_LIMITS_MAX_STEPS", "7")
+	t.Setenv("TMUXAI_LIMITS_MAX_COMMANDS", "3")
+	if err := config.SetFlagValues(map[string]string{"limits.max_commands": "4"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.SetFlagValues(nil) })
+
+	cfg, err := config.LoadLayers(config.Layers{ProjectDir: sub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ProjectFile != filepath.Join(project, config.ProjectConfigName) {
+		t.Errorf("expected the project config to be found from a subdirectory, got %q", cfg.ProjectFile)
+	}
+	if cfg.OpenRouter.Model != "project/model" || cfg.MaxCaptureLines != 400 || cfg.Limits.MaxSteps != 7 || cfg.Limits.MaxCommands != 4 {
+		t.Errorf("layers merged in the wrong order: model %s, lines %d, steps %d, commands %d",
+			cfg.OpenRouter.Model, cfg.MaxCaptureLines, cfg.Limits.MaxSteps, cfg.Limits.MaxCommands)
+	}
+	if cfg.Context != "I use fish\nthis repo uses pnpm and Go 1.22" {
+		t.Errorf("contexts should be joined, got %q", cfg.Context)
+	}
+	if !cfg.ExecConfirm || cfg.OpenRouter.BaseURL != config.DefaultConfig().OpenRouter.BaseURL || !cfg.Checkpoints.Enabled || len(cfg.Warnings) != 4 {
+		t.Errorf("the project config should only set allowed keys, got %v %s %v %v", cfg.ExecConfirm, cfg.OpenRouter.BaseURL, cfg.Checkpoints.Enabled, cfg.Warnings)
+	}
+	for key, want := range map[string]string{
+		"openrouter.model":    config.LayerProject,
+		"limits.max_steps":    config.LayerEnv,
+		"limits.max_commands": config.LayerFlag,
+		"wait_interval":       config.LayerDefault,
+		"exec_confirm":        config.LayerDefault,
+	} {
+		if got := cfg.Source(key); got != want {
+			t.Errorf("Source(%s) = %s, want %s", key, got, want)
+		}
+	}
+
+	m := &Manager{Config: cfg, SessionOverrides: map[string]interface{}{}}
+	m.processConfigCommand("set wait_interval 9")
+	formatted := m.FormatConfig()
+	for _, want := range []string{"model: project/model # project", "max_capture_lines: 400 # project", "wait_interval: 9 # session", "max_steps: 7 # env"} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("missing %q in:\n%s", want, formatted)
+		}
+	}
+	if strings.Contains(formatted, "sources") || strings.Contains(formatted, "warnings") {
+		t.Errorf("layer bookkeeping should not be shown:\n%s", formatted)
+	}
+	if !strings.Contains(m.baseSystemPrompt(), "this repo uses pnpm") {
+		t.Error("the context should be added to the system prompt")
+	}
+}
+
+func TestLoadLayers_ProjectErrorsNameTheFile(t *testing.T) {
+	writeConfigFile(t, "openrouter:\n  model: user/model\n")
+	project := writeProjectConfig(t, "max_captur_lines: 10\nwait_interval: -1\n")
+
+	_, err := config.LoadLayers(config.Layers{ProjectDir: project})
+	path := filepath.Join(project, config.ProjectConfigName)
+	for _, want := range []string{path + ": max_captur_lines: unknown key", path + ": wait_interval: must not be negative"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q, got %v", want, err)
+		}
+	}
+	if err := config.SetFlagValues(map[string]string{"nonexistent": "1"}); err == nil {
+		t.Error("expected unknown flag keys to be refused")
+	}
+}
+
+func TestRefreshProjectConfig(t *testing.T) {
+	writeConfigFile(t, "openrouter:\n  model: user/model\n")
+	first := writeProjectConfig(t, "openrouter:\n  model: first/model\n")
+	second := writeProjectConfig(t, "max_capture_lines: 50\n")
+
+	cfg, err := config.LoadLayers(config.Layers{ProjectDir: first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	openrouter := &cfg.OpenRouter
+	m := &Manager{Config: cfg, SessionOverrides: map[string]interface{}{}, ExecPane: &system.TmuxPaneDetails{CurrentPath: second}}
+	m.processConfigCommand("set wait_interval 9")
+	watcher := m.snapshotConfig()
+
+	m.refreshProjectConfig()
+	if m.Config.ProjectFile != filepath.Join(second, config.ProjectConfigName) || m.Config.MaxCaptureLines != 50 || openrouter.Model != "user/model" {
+		t.Errorf("expected the second project config, got %s %d %s", m.Config.ProjectFile, m.Config.MaxCaptureLines, openrouter.Model)
+	}
+	if m.GetWaitInterval() != 9 || m.Config.WaitInterval != 9 {
+		t.Error("session changes should survive a reload")
+	}
+	if watcher.OpenRouter.Model != "first/model" || watcher.ProjectFile != filepath.Join(first, config.ProjectConfigName) {
+		t.Errorf("the snapshot of a watcher should not change with the chat, got %s %s", watcher.OpenRouter.Model, watcher.ProjectFile)
+	}
+	m.processConfigCommand("unset wait_interval")
+	if m.Config.WaitInterval != config.DefaultConfig().WaitInterval {
+		t.Errorf("unset should restore the reloaded value, got %d", m.Config.WaitInterval)
+	}
+
+	os.WriteFile(filepath.Join(first, config.ProjectConfigName), []byte("max_capture_lines: 0\n"), 0o644)
+	m.ExecPane.CurrentPath = first
+	m.refreshProjectConfig()
+	if m.Config.MaxCaptureLines != 50 {
+		t.Error("an invalid project config should keep the current configuration")
+	}
+}
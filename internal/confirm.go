@@ -2,27 +2,78 @@ package internal
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 
 	"github.com/chzyer/readline"
 	"github.com/fatih/color"
 )
 
-func (m *Manager) confirmedToExec(command string, prompt string, edit bool) (bool, string) {
-	isSafe, _ := m.whitelistCheck(command)
-	if isSafe {
-		return true, command
+// confirmOptions selects the answers offered by confirmPrompt
+type confirmOptions struct {
+	Edit     bool // offer editing the command before running it
+	TypedYes bool // only a typed "yes" confirms, Enter cancels
+	Always   bool // offer recording an "always allow" rule for this session
+	Risk     RiskLevel
+	Unseen   string // why part of the command can not be classified, see RiskAssessment
+}
+
+// confirmedToExec classifies the command and asks for confirmation unless the policy approves it.
+// Destructive and irreversible commands always ask and need a typed "yes".
+// It returns how the command was approved and the command to run, which the user may have edited.
+func (m *Manager) confirmedToExec(command string, prompt string, edit bool) (Approval, string) {
+	if m.headless != nil && m.headless.approve == HeadlessApproveNone {
+		return ApprovalRejected, ""
 	}
+	risk := m.assessRisk(command)
+	decision := m.checkPolicy(command)
+	if decision.Approved && !risk.Level.RequiresTypedYes() {
+		if decision.SessionRule {
+			return ApprovalSession, command
+		}
+		return ApprovalAuto, command
+	}
+
+	reasonColor := color.New(color.FgHiBlack)
+	fmt.Println(risk.FormatRisk())
+	if decision.Approved {
+		fmt.Println(reasonColor.Sprintf("Manual check: approved, but %s commands always need confirmation", risk.Level))
+	} else {
+		fmt.Println(reasonColor.Sprint("Manual check: " + decision.String()))
+	}
+
+	return m.confirmPrompt(command, prompt, confirmOptions{
+		Edit:     edit,
+		TypedYes: risk.Level.RequiresTypedYes(),
+		Always:   !risk.Level.RequiresTypedYes(),
+		Risk:     risk.Level,
+		Unseen:   risk.Unseen,
+	})
+}
 
+// confirmPrompt asks prompt until answered. With TypedYes only the word "yes" confirms
+// and Enter cancels, otherwise Enter confirms.
+// A headless run decides without asking, see headlessApproval.
+func (m *Manager) confirmPrompt(command string, prompt string, opts confirmOptions) (Approval, string) {
+	if m.headless != nil {
+		if approval := m.headlessApproval(opts); approval.Approved() {
+			return approval, command
+		}
+		return ApprovalRejected, ""
+	}
+	m.setState(StateAwaitingConfirmation, command)
 	promptColor := color.New(color.FgHiCyan)
 
-	var promptText string
-	if edit {
-		promptText = fmt.Sprintf("%s [Y]es/No/Edit: ", prompt)
-	} else {
-		promptText = fmt.Sprintf("%s [Y]es/No: ", prompt)
+	answers := "[Y]es/No"
+	if opts.TypedYes {
+		answers = "Type \"yes\" to confirm/No"
+	}
+	if opts.Edit {
+		answers += "/Edit"
 	}
+	if opts.Always {
+		answers += "/Always"
+	}
+	promptText := fmt.Sprintf("%s %s: ", prompt, answers)
 
 	// Use readline for initial confirmation to properly handle Ctrl+C
 	rlConfig := &readline.Config{
@@ -34,30 +85,41 @@ func (m *Manager) confirmedToExec(command string, prompt string, edit bool) (boo
 	rl, err := readline.NewEx(rlConfig)
 	if err != nil {
 		fmt.Printf("Error initializing readline: %v\n", err)
-		return false, ""
+		return ApprovalRejected, ""
 	}
 	defer rl.Close()
 
 	confirmInput, err := rl.Readline()
 	if err != nil {
 		if err == readline.ErrInterrupt {
-			m.Status = ""
-			return false, ""
+			m.Cancel()
+			return ApprovalRejected, ""
 		}
 
 		fmt.Printf("Error reading confirmation: %v\n", err)
-		return false, ""
+		return ApprovalRejected, ""
 	}
 
 	confirmInput = strings.TrimSpace(strings.ToLower(confirmInput))
 
+	if opts.TypedYes {
+		switch confirmInput {
+		case "yes":
+			return ApprovalConfirmed, command
+		case "e", "edit":
+		default:
+			// anything but the typed word cancels, including a bare Enter
+			return ApprovalRejected, ""
+		}
+	}
+
 	if confirmInput == "" {
 		confirmInput = "y"
 	}
 
 	switch confirmInput {
 	case "y", "yes", "ok", "sure":
-		return true, command
+		return ApprovalConfirmed, command
 	case "e", "edit":
 		// Allow user to edit the command using readline for better editing experience
 		editConfig := &readline.Config{
@@ -69,7 +131,7 @@ func (m *Manager) confirmedToExec(command string, prompt string, edit bool) (boo
 		editRl, editErr := readline.NewEx(editConfig)
 		if editErr != nil {
 			fmt.Printf("Error initializing readline for edit: %v\n", editErr)
-			return false, ""
+			return ApprovalRejected, ""
 		}
 		defer editRl.Close()
 
@@ -77,61 +139,55 @@ func (m *Manager) confirmedToExec(command string, prompt string, edit bool) (boo
 		editedCommand, editErr := editRl.ReadlineWithDefault(command)
 		if editErr != nil {
 			if editErr == readline.ErrInterrupt {
-				m.Status = ""
-				return false, ""
+				m.Cancel()
+				return ApprovalRejected, ""
 			}
 
 			fmt.Printf("Error reading edited command: %v\n", editErr)
-			return false, ""
+			return ApprovalRejected, ""
 		}
 
 		editedCommand = strings.TrimSpace(editedCommand)
-		if editedCommand != "" {
-			return true, editedCommand
+		if editedCommand == command {
+			return ApprovalConfirmed, command
+		} else if editedCommand != "" {
+			return ApprovalEdited, editedCommand
 		} else {
 			// empty command
-			return false, ""
+			return ApprovalRejected, ""
 		}
+	case "a", "always":
+		if !opts.Always {
+			return m.confirmPrompt(command, prompt, opts)
+		}
+		m.promptAlwaysAllow(command)
+		return ApprovalAlways, command
 	case "n", "no", "cancel":
-		return false, ""
+		return ApprovalRejected, ""
 	default:
 		// any other input is retry confirmation
-		return m.confirmedToExec(command, prompt, edit)
+		return m.confirmPrompt(command, prompt, opts)
 	}
 }
 
-func (m *Manager) whitelistCheck(command string) (bool, error) {
-	isWhitelisted := false
-	for _, pattern := range m.Config.WhitelistPatterns {
-		if pattern == "" {
-			continue
-		}
-		match, err := regexp.MatchString(pattern, command)
-		if err != nil {
-			return false, fmt.Errorf("invalid whitelist regex pattern '%s': %w", pattern, err)
-		}
-		if match {
-			isWhitelisted = true
-			break
-		}
-	}
-
-	if !isWhitelisted {
-		return false, nil
+// confirmYesNo asks a plain yes/no question, anything but an explicit yes is a no
+func (m *Manager) confirmYesNo(prompt string) bool {
+	promptColor := color.New(color.FgHiCyan)
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          promptColor.Sprintf("%s y/[N]: ", prompt),
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		fmt.Printf("Error initializing readline: %v\n", err)
+		return false
 	}
+	defer rl.Close()
 
-	for _, pattern := range m.Config.BlacklistPatterns {
-		if pattern == "" {
-			continue
-		}
-		match, err := regexp.MatchString(pattern, command)
-		if err != nil {
-			return false, fmt.Errorf("invalid blacklist regex pattern '%s': %w", pattern, err)
-		}
-		if match {
-			return false, nil
-		}
+	input, err := rl.Readline()
+	if err != nil {
+		return false
 	}
-
-	return true, nil
+	input = strings.TrimSpace(strings.ToLower(input))
+	return input == "y" || input == "yes"
 }
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -9,29 +10,40 @@ import (
 	"github.com/fatih/color"
 )
 
-func (m *Manager) Countdown(seconds int) {
+// openKeyboard opens the keyboard and returns its key events and a function to close it,
+// tests replace it to simulate key presses
+var openKeyboard = func() (<-chan keyboard.KeyEvent, func(), error) {
+	keys, err := keyboard.GetKeys(10)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, func() { keyboard.Close() }, nil
+}
+
+// Countdown waits for seconds, Space pauses and Enter skips the wait.
+// It returns false if ctx was cancelled or the user pressed Ctrl+C.
+func (m *Manager) Countdown(ctx context.Context, seconds int) bool {
 	highlightColor := color.New(color.FgHiYellow).SprintFunc()
 	dimColor := color.New(color.FgHiBlack).SprintFunc()
 	pauseColor := color.New(color.FgHiRed).SprintFunc()
 
-	// Set up keyboard
-	if err := keyboard.Open(); err != nil {
-		fmt.Println("Error opening keyboard:", err)
-		return
+	// a headless run has no keyboard to pause or skip
+	if m.headless != nil {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Duration(seconds) * time.Second):
+			return true
+		}
 	}
-	defer keyboard.Close()
 
-	// Create a channel for keyboard events
-	keyChan := make(chan keyboard.Key, 10)
-	go func() {
-		for {
-			_, key, err := keyboard.GetKey()
-			if err != nil {
-				return
-			}
-			keyChan <- key
-		}
-	}()
+	// Set up keyboard, the events channel is closed with the keyboard
+	keys, closeKeys, err := openKeyboard()
+	if err != nil {
+		fmt.Println("Error opening keyboard:", err)
+		return ctx.Err() == nil
+	}
+	defer closeKeys()
 
 	paused := false
 	remaining := seconds
@@ -43,20 +55,24 @@ func (m *Manager) Countdown(seconds int) {
 
 	for remaining > 0 {
 		select {
-		case key := <-keyChan:
-			switch key {
-			case keyboard.KeySpace: // Space key
+		case <-ctx.Done():
+			fmt.Print("\033[0G\033[K")
+			return false
+		case event, ok := <-keys:
+			if !ok {
+				keys = nil // keyboard closed, keep counting down
+				continue
+			}
+			switch event.Key {
+			case keyboard.KeySpace:
 				paused = !paused
 				renderCountdown(remaining, seconds, paused, highlightColor, dimColor, pauseColor)
-			case keyboard.KeyEnter: // Enter key
-				// Just continue execution without exiting the function
-				remaining = 0 // Set remaining to 0 to end the countdown loop
+			case keyboard.KeyEnter:
+				remaining = 0
 				renderCountdown(remaining, seconds, paused, highlightColor, dimColor, pauseColor)
-				break
-			case keyboard.KeyCtrlC: // Ctrl+C
-				m.Status = ""
-				m.WatchMode = false
-				return
+			case keyboard.KeyCtrlC:
+				m.Cancel()
+				return false
 			}
 		case <-ticker.C:
 			if !paused {
@@ -65,6 +81,7 @@ func (m *Manager) Countdown(seconds int) {
 			}
 		}
 	}
+	return ctx.Err() == nil
 }
 
 // renderCountdown displays the current state of the countdown
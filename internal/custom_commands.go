@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// customCommandTimeout is how long the shell of a custom command may run by default
+const customCommandTimeout = 30 * time.Second
+
+// customCommand returns the custom command called by input, e.g. "/explain-error".
+// Custom commands never replace built-in ones and must be typed in full.
+func (m *Manager) customCommand(input string) (string, config.CommandConfig, bool) {
+	parts := strings.Fields(input)
+	if len(parts) == 0 {
+		return "", config.CommandConfig{}, false
+	}
+	name := strings.TrimPrefix(strings.ToLower(parts[0]), "/")
+	cmd, ok := m.Config.Commands[name]
+	if !ok || isBuiltinCommand("/"+name) {
+		return "", config.CommandConfig{}, false
+	}
+	return name, cmd, true
+}
+
+func isBuiltinCommand(name string) bool {
+	for _, cmd := range commands {
+		if cmd == name {
+			return true
+		}
+	}
+	return false
+}
+
+// customCommandNames returns the usable custom commands, sorted
+func (m *Manager) customCommandNames() []string {
+	var names []string
+	for name := range m.Config.Commands {
+		if isBuiltinCommand("/" + name) {
+			logger.Info("Custom command /%s is ignored, it is a built-in command", name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// customCommandsHelp lists the custom commands for /help
+func (m *Manager) customCommandsHelp() string {
+	names := m.customCommandNames()
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nCustom commands:")
+	for _, name := range names {
+		cmd := m.Config.Commands[name]
+		usage := "/" + name
+		for _, arg := range cmd.Args {
+			usage += " <" + arg + ">"
+		}
+		b.WriteString("\n- " + usage)
+		if cmd.Description != "" {
+			b.WriteString(": " + cmd.Description)
+		}
+	}
+	return b.String()
+}
+
+// commandRequest returns the message a slash command sends to the AI, for task runs and
+// custom commands, and the model to use for it. ok is false for other commands. An empty
+// message with ok means the command is done, e.g. a shell command attached its output.
+func (m *Manager) commandRequest(input string) (message string, model string, ok bool, err error) {
+	if isTaskRun(input) {
+		message, model, err = m.taskRequest(input)
+		return message, model, true, err
+	}
+	name, cmd, found := m.customCommand(input)
+	if !found {
+		return "", "", false, nil
+	}
+	message, err = m.runCustomCommand(name, cmd, input)
+	return message, cmd.Model, true, err
+}
+
+// runCustomCommand runs the shell of cmd and attaches its output, then renders its prompt
+func (m *Manager) runCustomCommand(name string, cmd config.CommandConfig, input string) (string, error) {
+	if cmd.Prompt == "" && cmd.Shell == "" {
+		return "", fmt.Errorf("custom command /%s needs a prompt or a shell command", name)
+	}
+	_, rest, _ := strings.Cut(strings.TrimSpace(input), " ")
+	argv, err := splitArgs(rest)
+	if err != nil {
+		// free text such as "why it's broken" is still fine for .args
+		argv = strings.Fields(rest)
+	}
+	if len(argv) < len(cmd.Args) {
+		usage := "/" + name
+		for _, arg := range cmd.Args {
+			usage += " <" + arg + ">"
+		}
+		return "", fmt.Errorf("Usage: %s", usage)
+	}
+
+	data := map[string]any{
+		"args": strings.TrimSpace(rest),
+		"argv": argv,
+		"cwd":  m.taskDir(),
+	}
+	for i, arg := range cmd.Args {
+		data[arg] = argv[i]
+	}
+	if strings.Contains(cmd.Prompt+cmd.Shell, "last_output") {
+		data["last_output"] = m.execPaneLastOutput()
+	}
+
+	if cmd.Shell != "" {
+		script, err := renderCommandTemplate(name, cmd.Shell, data)
+		if err != nil {
+			return "", err
+		}
+		output, err := m.runCommandShell(script, cmd.Timeout)
+		if err != nil {
+			return "", fmt.Errorf("/%s: %w", name, err)
+		}
+		if err := m.AttachContent(strings.TrimSpace("/"+name+" "+rest), output); err != nil {
+			return "", err
+		}
+	}
+	if cmd.Prompt == "" {
+		return "", nil
+	}
+	return renderCommandTemplate(name, cmd.Prompt, data)
+}
+
+// renderCommandTemplate renders a prompt or shell template of a custom command,
+// quote shell-quotes a value
+func renderCommandTemplate(name string, text string, data map[string]any) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"quote": func(s string) (string, error) { return syntax.Quote(s, syntax.LangPOSIX) },
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("custom command /%s: %w", name, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("custom command /%s: %w", name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// runCommandShell runs script with sh -c in the exec pane directory and returns its
+// output, a failing command adds its exit status
+func (m *Manager) runCommandShell(script string, timeout time.Duration) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = customCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.Info("Running custom command: %s", script)
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Dir = m.taskDir()
+	// children of sh may keep the output open after it was killed
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("timed out after %s", timeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		output = append(output, fmt.Sprintf("\n[exit status %d]", exitErr.ExitCode())...)
+	} else if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// execPaneLastOutput returns the output of the last command in a prepared exec pane,
+// otherwise what the exec pane shows
+func (m *Manager) execPaneLastOutput() string {
+	if m.ExecPane == nil || m.ExecPane.Id == "" {
+		return ""
+	}
+	if m.ExecPane.IsPrepared {
+		m.parseExecPaneCommandHistory()
+		for i := len(m.ExecHistory) - 1; i >= 0; i-- {
+			if m.ExecHistory[i].Command != "" {
+				last := m.ExecHistory[i]
+				if last.Code == unknownExitCode {
+					return fmt.Sprintf("$ %s\n%s\n[exit status unknown]", last.Command, last.Output)
+				}
+				return fmt.Sprintf("$ %s\n%s\n[exit status %d]", last.Command, last.Output, last.Code)
+			}
+		}
+	}
+	m.ExecPane.Refresh(m.GetMaxCaptureLines())
+	return strings.TrimSpace(m.ExecPane.Content)
+}
@@ -0,0 +1,73 @@
+// Tests for user-defined slash commands in custom_commands.go
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+func newCustomCommandManager(t *testing.T, commands map[string]config.CommandConfig) *Manager {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Commands = commands
+	return &Manager{Config: cfg, ExecPane: &system.TmuxPaneDetails{CurrentPath: t.TempDir()}, SessionOverrides: map[string]interface{}{}}
+}
+
+func TestCommandRequest_PromptMacro(t *testing.T) {
+	m := newCustomCommandManager(t, map[string]config.CommandConfig{
+		"review": {Description: "Review a file", Args: []string{"file"}, Prompt: "Review {{.file}} ({{.args}}), focus on {{index .argv 1}}", Model: "small"},
+		"help":   {Prompt: "never used"},
+	})
+
+	message, model, ok, err := m.commandRequest(`/review main.go "error handling"`)
+	if !ok || err != nil || model != "small" || message != `Review main.go (main.go "error handling"), focus on error handling` {
+		t.Errorf("unexpected request %q %q %t %v", message, model, ok, err)
+	}
+	if _, _, ok, err := m.commandRequest("/review"); !ok || err == nil || err.Error() != "Usage: /review <file>" {
+		t.Errorf("expected a usage error, got %t %v", ok, err)
+	}
+	if _, _, ok, _ := m.commandRequest("/help"); ok {
+		t.Error("built-in commands should not be replaced")
+	}
+	if _, _, ok, _ := m.commandRequest("/rev main.go"); ok {
+		t.Error("custom commands should need their full name")
+	}
+
+	help := m.customCommandsHelp()
+	if !strings.Contains(help, "/review <file>: Review a file") || strings.Contains(help, "/help") {
+		t.Errorf("unexpected help %q", help)
+	}
+}
+
+func TestCommandRequest_Shell(t *testing.T) {
+	m := newCustomCommandManager(t, map[string]config.CommandConfig{
+		"status": {Shell: "echo status of {{quote .args}}; pwd"},
+		"fail":   {Shell: "echo broken; exit 2", Prompt: "Why did it fail?"},
+		"slow":   {Shell: "sleep 5", Timeout: 50 * time.Millisecond},
+	})
+
+	message, _, ok, err := m.commandRequest("/status it's fine")
+	if !ok || err != nil || message != "" {
+		t.Fatalf("a shell command without prompt should only attach, got %q %t %v", message, ok, err)
+	}
+	a := m.Attachments[0]
+	if a.Name != "/status it's fine" || !strings.Contains(a.Content, "status of it's fine\n"+m.ExecPane.CurrentPath) {
+		t.Errorf("unexpected attachment %+v", a)
+	}
+
+	message, _, _, err = m.commandRequest("/fail")
+	if err != nil || message != "Why did it fail?" {
+		t.Errorf("unexpected request %q %v", message, err)
+	}
+	if a := m.Attachments[1]; a.Name != "/fail" || !strings.Contains(a.Content, "broken\n\n[exit status 2]") {
+		t.Errorf("expected the exit status in the output, got %+v", a)
+	}
+
+	if _, _, _, err := m.commandRequest("/slow"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// DoctorStatus is the outcome of a check of tmuxai config doctor
+type DoctorStatus int
+
+const (
+	DoctorOK DoctorStatus = iota
+	DoctorWarning
+	DoctorFailed
+)
+
+// DoctorCheck is one line of tmuxai config doctor
+type DoctorCheck struct {
+	Name   string
+	Status DoctorStatus
+	Detail string
+}
+
+// minTmuxVersion is the oldest tmux known to support everything TmuxAI uses
+const minTmuxVersion = 3.0
+
+// doctorTimeout bounds the request checking the provider
+const doctorTimeout = 10 * time.Second
+
+// Doctor checks the configuration and what TmuxAI needs around it: tmux, the API key, the
+// provider and the shell for /prepare. loadErr is the error of loading cfg, cfg is nil when
+// it could not be read at all. endpoint is requested to check the provider, empty uses the
+// models list of openrouter.base_url.
+func Doctor(ctx context.Context, cfg *config.Config, loadErr error, endpoint string) []DoctorCheck {
+	var checks []DoctorCheck
+	check := func(name string, status DoctorStatus, format string, a ...any) {
+		checks = append(checks, DoctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	var validation config.ValidationErrors
+	switch {
+	case errors.As(loadErr, &validation):
+		for _, err := range validation {
+			check("config", DoctorFailed, "%s", err.Error())
+		}
+	case loadErr != nil:
+		check("config", DoctorFailed, "%v", loadErr)
+	default:
+		files := config.ConfigFilePath()
+		if cfg != nil && cfg.ProjectFile != "" {
+			files += ", " + cfg.ProjectFile
+		}
+		check("config", DoctorOK, "%s", files)
+	}
+	if cfg == nil {
+		return checks
+	}
+	for _, warning := range cfg.Warnings {
+		check("config", DoctorWarning, "%s", warning)
+	}
+
+	version, err := system.TmuxVersion()
+	switch {
+	case err != nil:
+		check("tmux", DoctorFailed, "tmux is not installed or not in PATH: %v", err)
+	case tmuxVersionNumber(version) > 0 && tmuxVersionNumber(version) < minTmuxVersion:
+		check("tmux", DoctorWarning, "tmux %s is older than %.1f, some features may not work", version, minTmuxVersion)
+	case os.Getenv("TMUX") == "":
+		check("tmux", DoctorOK, "tmux %s, not running inside tmux, tmuxai starts a session", version)
+	default:
+		check("tmux", DoctorOK, "tmux %s", version)
+	}
+
+	bedrock := cfg.OpenRouter.Provider == "bedrock"
+	var keyErr error
+	if !bedrock {
+		keyErr = cfg.OpenRouter.ResolveAPIKey()
+	}
+	switch {
+	case bedrock:
+		check("api key", DoctorOK, "not needed, bedrock uses the AWS credentials")
+	case keyErr != nil:
+		check("api key", DoctorFailed, "%v", keyErr)
+	case cfg.OpenRouter.APIKey == "":
+		check("api key", DoctorFailed, "missing, set openrouter.api_key_cmd, api_key_file or api_key, TMUXAI_OPENROUTER_API_KEY, or run tmuxai auth set")
+	default:
+		check("api key", DoctorOK, "%s", describeAPIKey(cfg.OpenRouter.APIKey, cfg.OpenRouter.APIKeySource))
+	}
+
+	if cfg.OpenRouter.Model == "" {
+		check("model", DoctorFailed, "openrouter.model is empty")
+	} else {
+		check("model", DoctorOK, "%s", cfg.OpenRouter.Model)
+	}
+
+	if bedrock && endpoint == "" {
+		check("provider", DoctorWarning, "not checked for bedrock, pass --endpoint to check an URL")
+	} else {
+		status, detail := checkProvider(ctx, cfg, endpoint)
+		check("provider", status, "%s", detail)
+	}
+
+	shell, err := system.TmuxDefaultShell()
+	if err != nil || shell == "" {
+		shell = os.Getenv("SHELL")
+	}
+	name := filepath.Base(shell)
+	switch _, ok := shellRecipeFor(name); {
+	case shell == "":
+		check("shell", DoctorWarning, "could not find the default shell of tmux or $SHELL")
+	case ok:
+		check("shell", DoctorOK, "%s supports /prepare", name)
+	default:
+		check("shell", DoctorWarning, "%s does not support /prepare, commands run without exit codes", name)
+	}
+	return checks
+}
+
+// checkProvider requests endpoint with the API key. By default it is the key endpoint of
+// OpenRouter, whose models list is public, or the models list of other providers.
+func checkProvider(ctx context.Context, cfg *config.Config, endpoint string) (DoctorStatus, string) {
+	if endpoint == "" {
+		endpoint = strings.TrimSuffix(cfg.OpenRouter.BaseURL, "/") + "/models"
+		if strings.Contains(cfg.OpenRouter.BaseURL, "openrouter.ai") {
+			endpoint = strings.TrimSuffix(cfg.OpenRouter.BaseURL, "/") + "/auth/key"
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return DoctorFailed, fmt.Sprintf("invalid endpoint %s: %v", endpoint, err)
+	}
+	if cfg.OpenRouter.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.OpenRouter.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return DoctorFailed, fmt.Sprintf("%s is not reachable: %v", endpoint, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return DoctorFailed, fmt.Sprintf("%s rejected the API key (%s)", endpoint, resp.Status)
+	case resp.StatusCode >= 400:
+		return DoctorWarning, fmt.Sprintf("%s answered %s", endpoint, resp.Status)
+	}
+	return DoctorOK, fmt.Sprintf("%s answered %s", endpoint, resp.Status)
+}
+
+// tmuxVersionNumber returns the major.minor number of a tmux version such as "3.3a",
+// 0 for versions such as "master"
+func tmuxVersionNumber(version string) float64 {
+	end := strings.IndexFunc(version, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end >= 0 {
+		version = version[:end]
+	}
+	n, _ := strconv.ParseFloat(version, 64)
+	return n
+}
@@ -0,0 +1,129 @@
+// Tests for tmuxai config doctor in doctor.go and config validation
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+// writeConfigFile writes ~/.config/tmuxai/config.yaml under a temporary HOME
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, ".config", "tmuxai", "config.yaml")
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfigFile(t, `max_capture_lines: 200
+whitelst_patterns: []
+openrouter:
+  modle: x
+risk_rules:
+  - pattern: '^terraform apply'
+    level: dangerous
+    explian: typo
+`)
+	cfg := config.DefaultConfig()
+	cfg.WhitelistPatterns = []string{"^ls", "(unclosed"}
+	cfg.OpenRouter.BaseURL = "openrouter.ai/api/v1"
+	cfg.RiskRules = []config.RiskRule{{Pattern: "^terraform apply", Level: "dangerous"}}
+	cfg.WatchTriggers = []config.WatchTrigger{{Pattern: "ERROR", Literal: "panic"}}
+	cfg.Notify.Error = []string{"ops"}
+	cfg.Commands = map[string]config.CommandConfig{"empty": {Description: "nothing"}}
+	cfg.Limits.MaxSteps = -1
+
+	errs := config.Validate(cfg)
+	got := errs.Error()
+	for _, want := range []string{
+		path + ": whitelst_patterns: unknown key, did you mean whitelist_patterns?",
+		"openrouter.modle: unknown key, did you mean model?",
+		"risk_rules[0].explian: unknown key, did you mean explain?",
+		"whitelist_patterns[1]: invalid regex '(unclosed'",
+		"openrouter.base_url: must be an http or https URL",
+		"risk_rules[0].level: unknown level 'dangerous'",
+		"watch_triggers[0]: set exactly one of pattern, literal, exit or idle",
+		"notify.error: unknown notifier 'ops'",
+		"commands.empty: needs a prompt or a shell command",
+		"limits.max_steps: must not be negative",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if len(errs) != 10 {
+		t.Errorf("expected 10 errors, got %d:\n%s", len(errs), got)
+	}
+}
+
+func TestValidate_DefaultAndExampleConfig(t *testing.T) {
+	example, err := os.ReadFile("../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeConfigFile(t, string(example))
+	if errs := config.Validate(config.DefaultConfig()); errs != nil {
+		t.Errorf("expected the example config to be valid, got:\n%s", errs)
+	}
+}
+
+func TestDoctor_Provider(t *testing.T) {
+	writeConfigFile(t, "openrouter:\n  model: test\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer good-key-123456" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.OpenRouter.BaseURL = server.URL + "/v1/"
+	cfg.OpenRouter.APIKey = "good-key-123456"
+	checks := Doctor(context.Background(), cfg, nil, "")
+	find := func(name string) DoctorCheck {
+		for _, check := range checks {
+			if check.Name == name {
+				return check
+			}
+		}
+		t.Fatalf("no %s check in %+v", name, checks)
+		return DoctorCheck{}
+	}
+	if check := find("provider"); check.Status != DoctorOK {
+		t.Errorf("expected the provider to answer, got %+v", check)
+	}
+	if check := find("api key"); check.Status != DoctorOK || check.Detail != "good...3456" {
+		t.Errorf("expected a masked key, got %+v", check)
+	}
+
+	cfg.OpenRouter.APIKey = ""
+	checks = Doctor(context.Background(), cfg, nil, "")
+	if find("api key").Status != DoctorFailed || find("provider").Status != DoctorFailed {
+		t.Errorf("expected a missing and rejected key, got %+v", checks)
+	}
+
+	checks = Doctor(context.Background(), nil, config.ValidationErrors{{Key: "debug", Reason: "broken"}}, "")
+	if len(checks) != 1 || checks[0].Status != DoctorFailed || checks[0].Detail != "debug: broken" {
+		t.Errorf("expected only the config error, got %+v", checks)
+	}
+}
+
+func TestTmuxVersionNumber(t *testing.T) {
+	for version, want := range map[string]float64{"3.3a": 3.3, "2.9": 2.9, "next-3.4": 0, "master": 0} {
+		if got := tmuxVersionNumber(version); got != want {
+			t.Errorf("tmuxVersionNumber(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -26,6 +27,11 @@ func (m *Manager) GetAvailablePane() system.TmuxPaneDetails {
 }
 
 func (m *Manager) InitExecPane() {
+	if m.Sandbox != nil {
+		m.initSandboxExecPane()
+		return
+	}
+
 	availablePane := m.GetAvailablePane()
 	if availablePane.Id == "" {
 		system.TmuxCreateNewPane(m.PaneId)
@@ -34,6 +40,108 @@ func (m *Manager) InitExecPane() {
 	m.ExecPane = &availablePane
 }
 
+// initSandboxExecPane uses the sandbox pane as exec pane, restarting it if it was closed
+func (m *Manager) initSandboxExecPane() {
+	panes, _ := m.GetTmuxPanes()
+	for _, pane := range panes {
+		if pane.Id == m.Sandbox.PaneId {
+			m.ExecPane = &pane
+			return
+		}
+	}
+
+	logger.Info("Sandbox pane %s is gone, starting a new one", m.Sandbox.PaneId)
+	if err := m.spawnSandboxPane(); err != nil {
+		logger.Error("Failed to restart sandbox pane: %v", err)
+		m.ExecPane = &system.TmuxPaneDetails{}
+		return
+	}
+	panes, _ = m.GetTmuxPanes()
+	for _, pane := range panes {
+		if pane.Id == m.Sandbox.PaneId {
+			m.ExecPane = &pane
+			return
+		}
+	}
+}
+
+// shellRecipe describes how TmuxAI takes over a shell prompt and how it hands
+// the original prompt back. save keeps the user's prompt in a shell variable
+// (only once, so preparing twice does not overwrite it with ours).
+type shellRecipe struct {
+	save    string
+	prepare string
+	restore string
+	clear   string // command clearing the screen, empty means the shell handles C-l
+}
+
+// posixRecipe works for shells which expand parameters in PS1 (ksh, mksh, dash, sh).
+// User and hostname are expanded once when preparing so $? is still the last status.
+// These shells may run without line editing, so C-l would be typed literally.
+var posixRecipe = shellRecipe{
+	save:    `_TMUXAI_PS1="${_TMUXAI_PS1-$PS1}"`,
+	prepare: `PS1="$(id -un)@$(hostname):"'${PWD}[$?]» '`,
+	restore: `PS1="$_TMUXAI_PS1"; unset _TMUXAI_PS1`,
+	clear:   `clear`,
+}
+
+// cshRecipe rebuilds the prompt in precmd since csh expands $status only once.
+// Note: restoring removes any precmd alias the user had defined.
+var cshRecipe = shellRecipe{
+	save:    `if (! $?_tmuxai_prompt) set _tmuxai_prompt="$prompt:q"`,
+	prepare: `alias precmd 'set prompt="%n@%m:%~[%T][$status]» "'`,
+	restore: `unalias precmd; set prompt="$_tmuxai_prompt:q"; unset _tmuxai_prompt`,
+}
+
+var shellRecipes = map[string]shellRecipe{
+	"zsh": {
+		save:    `_TMUXAI_PROMPT="${_TMUXAI_PROMPT-$PROMPT}"`,
+		prepare: `export PROMPT='%n@%m:%~[%T][%?]» '`,
+		restore: `PROMPT="$_TMUXAI_PROMPT"; unset _TMUXAI_PROMPT`,
+	},
+	"bash": {
+		save:    `_TMUXAI_PS1="${_TMUXAI_PS1-$PS1}"`,
+		prepare: `export PS1='\u@\h:\w[\A][$?]» '`,
+		restore: `PS1="$_TMUXAI_PS1"; unset _TMUXAI_PS1`,
+	},
+	"fish": {
+		save:    `functions -q _tmuxai_fish_prompt; or functions -c fish_prompt _tmuxai_fish_prompt`,
+		prepare: `function fish_prompt; set -l s $status; printf '%s@%s:%s[%s][%d]» ' $USER (hostname -s) (prompt_pwd) (date +"%H:%M") $s; end`,
+		restore: `functions -e fish_prompt; functions -c _tmuxai_fish_prompt fish_prompt; functions -e _tmuxai_fish_prompt`,
+	},
+	"nu": {
+		save:    `$env._TMUXAI_PROMPT = ($env._TMUXAI_PROMPT? | default {command: $env.PROMPT_COMMAND?, right: $env.PROMPT_COMMAND_RIGHT?, indicator: $env.PROMPT_INDICATOR?})`,
+		prepare: `$env.PROMPT_COMMAND = {|| $"(whoami)@(sys host | get hostname):(pwd)[(date now | format date '%H:%M')][($env.LAST_EXIT_CODE)]" }; $env.PROMPT_COMMAND_RIGHT = ""; $env.PROMPT_INDICATOR = "» "`,
+		restore: `$env.PROMPT_COMMAND = $env._TMUXAI_PROMPT.command; $env.PROMPT_COMMAND_RIGHT = $env._TMUXAI_PROMPT.right; $env.PROMPT_INDICATOR = $env._TMUXAI_PROMPT.indicator; hide-env _TMUXAI_PROMPT`,
+	},
+	"pwsh": {
+		save:    `if (-not (Test-Path Function:\_TmuxAIPrompt)) { ${function:_TmuxAIPrompt} = ${function:prompt} }`,
+		prepare: `function prompt { $s = if ($?) { 0 } elseif ($LASTEXITCODE) { $LASTEXITCODE } else { 1 }; "$([Environment]::UserName)@$([Environment]::MachineName):$($PWD.Path)[$(Get-Date -Format HH:mm)][$s]» " }`,
+		restore: `${function:prompt} = ${function:_TmuxAIPrompt}; Remove-Item Function:\_TmuxAIPrompt`,
+	},
+	"xonsh": {
+		save:    `_tmuxai_prompt = globals().get('_tmuxai_prompt', ($PROMPT, $RIGHT_PROMPT))`,
+		prepare: `$PROMPT_FIELDS['tmuxai_rtn'] = lambda: str(__xonsh__.history[-1].rtn if len(__xonsh__.history) else 0); $PROMPT = '{user}@{hostname}:{cwd}[{localtime}][{tmuxai_rtn}]» '; $RIGHT_PROMPT = ''`,
+		restore: `$PROMPT = _tmuxai_prompt[0]; $RIGHT_PROMPT = _tmuxai_prompt[1]; del _tmuxai_prompt`,
+	},
+	"ksh":   posixRecipe,
+	"ksh93": posixRecipe,
+	"mksh":  posixRecipe,
+	"dash":  posixRecipe,
+	"sh":    posixRecipe,
+	"tcsh":  cshRecipe,
+	"csh":   cshRecipe,
+}
+
+// shellRecipeFor returns the prepare recipe for the given shell command name
+func shellRecipeFor(shell string) (shellRecipe, bool) {
+	if shell == "powershell" {
+		shell = "pwsh"
+	}
+	recipe, ok := shellRecipes[shell]
+	return recipe, ok
+}
+
 func (m *Manager) PrepareExecPane() {
 	m.ExecPane.Refresh(m.GetMaxCaptureLines())
 	if m.ExecPane.IsPrepared && m.ExecPane.Shell != "" {
@@ -41,25 +149,79 @@ func (m *Manager) PrepareExecPane() {
 	}
 
 	shellCommand := m.ExecPane.CurrentCommand
-	var ps1Command string
-	switch shellCommand {
-	case "zsh":
-		ps1Command = `export PROMPT='%n@%m:%~[%T][%?]» '`
-	case "bash":
-		ps1Command = `export PS1='\u@\h:\w[\A][$?]» '`
-	case "fish":
-		ps1Command = `function fish_prompt; set -l s $status; printf '%s@%s:%s[%s][%d]» ' $USER (hostname -s) (prompt_pwd) (date +"%H:%M") $s; end`
-	default:
+	if m.ExecPane.IsSubShell {
+		probe, err := m.probeSubShell(m.ExecPane)
+		if err != nil {
+			logger.Error("Failed to probe subshell in pane %s: %v", m.ExecPane.Id, err)
+			return
+		}
+		m.SubShells[m.ExecPane.Id] = probe
+		m.applySubShellDetails(m.ExecPane)
+		shellCommand = probe.Shell
+	}
+
+	recipe, ok := shellRecipeFor(shellCommand)
+	if !ok {
 		errMsg := fmt.Sprintf("Shell '%s' in pane %s is recognized but not yet supported for PS1 modification.", shellCommand, m.ExecPane.Id)
 		logger.Info(errMsg)
 		return
 	}
 
-	system.TmuxSendCommandToPane(m.ExecPane.Id, ps1Command, true)
-	system.TmuxSendCommandToPane(m.ExecPane.Id, "C-l", false)
+	system.TmuxSendCommandToPane(m.ExecPane.Id, recipe.save, true)
+	system.TmuxSendCommandToPane(m.ExecPane.Id, recipe.prepare, true)
+	recipe.clearScreen(m.ExecPane.Id)
+}
+
+// clearScreen clears the pane using the shell's preferred method
+func (r shellRecipe) clearScreen(paneId string) {
+	if r.clear != "" {
+		system.TmuxSendCommandToPane(paneId, r.clear, true)
+		return
+	}
+	system.TmuxSendCommandToPane(paneId, "C-l", false)
 }
 
-func (m *Manager) ExecWaitCapture(command string) (CommandExecHistory, error) {
+// UnprepareExecPane restores the prompt saved by PrepareExecPane.
+// It returns false if the pane is not prepared or is busy running a command.
+func (m *Manager) UnprepareExecPane() bool {
+	if m.ExecPane.Id == "" {
+		return false
+	}
+
+	// pane details captured earlier may be stale, ask tmux what is running now
+	panes, err := system.TmuxPanesDetails(m.ExecPane.Id)
+	if err != nil || len(panes) == 0 {
+		return false
+	}
+	pane := panes[0]
+	pane.Refresh(m.GetMaxCaptureLines())
+	m.applySubShellDetails(&pane)
+	if !pane.IsPrepared {
+		return false
+	}
+
+	recipe, ok := shellRecipeFor(pane.Shell)
+	if !ok {
+		logger.Info("Shell '%s' in pane %s has no restore recipe", pane.Shell, pane.Id)
+		return false
+	}
+
+	system.TmuxSendCommandToPane(pane.Id, recipe.restore, true)
+	recipe.clearScreen(pane.Id)
+	m.ExecPane.IsPrepared = false
+	logger.Info("Restored original prompt in pane %s", pane.Id)
+	return true
+}
+
+// promptRegex captures the status code (group 1) and optionally the command (group 2).
+// Making the command part optional handles prompts that only show status (like the last line).
+// The code may be negative (PowerShell and nushell report some failures that way)
+// and ` ?` allows zero or one space after », shells differ in trailing whitespace.
+var promptRegex = regexp.MustCompile(`.*\[(-?\d+)\]» ?(.*)$`)
+
+// ExecWaitCapture runs command in the prepared exec pane and waits for its prompt to
+// return. It stops waiting when ctx is cancelled.
+func (m *Manager) ExecWaitCapture(ctx context.Context, command string) (CommandExecHistory, error) {
 	system.TmuxSendCommandToPane(m.ExecPane.Id, command, true)
 	m.ExecPane.Refresh(m.GetMaxCaptureLines())
 
@@ -67,15 +229,25 @@ func (m *Manager) ExecWaitCapture(command string) (CommandExecHistory, error) {
 
 	animChars := []string{"⋯", "⋱", "⋮", "⋰"}
 	animIndex := 0
-	for !strings.HasSuffix(m.ExecPane.LastLine, "]»") && m.Status != "" {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for !strings.HasSuffix(m.ExecPane.LastLine, "]»") {
 		fmt.Printf("\r%s%s ", m.GetPrompt(), animChars[animIndex])
 		animIndex = (animIndex + 1) % len(animChars)
-		time.Sleep(500 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			fmt.Print("\r\033[K")
+			return CommandExecHistory{}, ctx.Err()
+		case <-ticker.C:
+		}
 		m.ExecPane.Refresh(m.GetMaxCaptureLines())
 	}
 	fmt.Print("\r\033[K")
 
 	m.parseExecPaneCommandHistory()
+	if len(m.ExecHistory) == 0 {
+		return CommandExecHistory{}, fmt.Errorf("no command found in pane %s", m.ExecPane.Id)
+	}
 	cmd := m.ExecHistory[len(m.ExecHistory)-1]
 	logger.Debug("Command: %s\nOutput: %s\nCode: %d\n", cmd.Command, cmd.Output, cmd.Code)
 	return cmd, nil
@@ -83,18 +255,18 @@ func (m *Manager) ExecWaitCapture(command string) (CommandExecHistory, error) {
 
 func (m *Manager) parseExecPaneCommandHistory() {
 	m.ExecPane.Refresh(m.GetMaxCaptureLines())
+	m.ExecHistory = parseCommandHistory(m.ExecPane.Content)
+}
 
+// parseCommandHistory splits prepared pane content into commands, outputs and exit codes.
+// All shell recipes render the exit status as "[code]»" at the end of the prompt.
+func parseCommandHistory(content string) []CommandExecHistory {
 	var history []CommandExecHistory
 
 	var currentCommand *CommandExecHistory
 	var outputBuilder strings.Builder
 
-	// Regex: Capture status code (group 1), optionally capture command (group 2)
-	// Making the command part optional handles prompts that only show status (like the last line).
-	// ` ?` allows zero or one space after »
-	promptRegex := regexp.MustCompile(`.*\[(\d+)\]» ?(.*)$`)
-
-	scanner := bufio.NewScanner(strings.NewReader(m.ExecPane.Content))
+	scanner := bufio.NewScanner(strings.NewReader(content))
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -118,7 +290,7 @@ func (m *Manager) parseExecPaneCommandHistory() {
 				if err != nil {
 					// This shouldn't happen with \d+ regex but check anyway
 					fmt.Printf("Warning: Could not parse status code '%s' for previous command on line: %s\n", statusCodeStr, line)
-					currentCommand.Code = -1 // Indicate parsing error
+					currentCommand.Code = unknownExitCode
 				} else {
 					currentCommand.Code = statusCode // Assign correct status
 				}
@@ -142,7 +314,7 @@ func (m *Manager) parseExecPaneCommandHistory() {
 			if commandStr != "" {
 				currentCommand = &CommandExecHistory{
 					Command: commandStr,
-					Code:    -1, // Default/Unknown: Status code is determined by the *next* prompt
+					Code:    unknownExitCode, // Status code is determined by the *next* prompt
 					// Output will be collected in outputBuilder starting from the next line
 				}
 			} else {
@@ -168,7 +340,7 @@ func (m *Manager) parseExecPaneCommandHistory() {
 	// but without a final terminating prompt line.
 	if currentCommand != nil {
 		currentCommand.Output = strings.TrimSuffix(outputBuilder.String(), "\n")
-		// Status code remains the default (-1) because the log ended before the next prompt
+		// Status code remains unknown because the log ended before the next prompt
 		// could provide the exit status.
 		history = append(history, *currentCommand)
 	}
@@ -177,6 +349,5 @@ func (m *Manager) parseExecPaneCommandHistory() {
 		logger.Error("error reading input: %v", err)
 	}
 
-	// Update the manager's command history
-	m.ExecHistory = history
+	return history
 }
@@ -0,0 +1,180 @@
+// Tests for the shell prepare recipes in exec_pane.go
+package internal
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test: parser handles the prompt formats produced by all recipes, each prompt shows
+// the code of the command before it
+func TestParseCommandHistory_Formats(t *testing.T) {
+	content := strings.Join([]string{
+		"user@host:~[12:00][0]» ls",
+		"a.txt",
+		"b.txt",
+		"user@host:/tmp[12:00:01][0]»ls missing",
+		"ls: cannot access 'missing'",
+		"user@host:/home/user[12:01][2]» Get-Item nope",
+		"Get-Item: Cannot find path",
+		"user@host:~[12:01][-1]» echo done",
+		"done",
+		"user@host:~[12:02][0]»",
+	}, "\n")
+
+	got := parseCommandHistory(content)
+	want := []CommandExecHistory{
+		{Command: "ls", Output: "a.txt\nb.txt", Code: 0},
+		{Command: "ls missing", Output: "ls: cannot access 'missing'", Code: 2},
+		{Command: "Get-Item nope", Output: "Get-Item: Cannot find path", Code: -1},
+		{Command: "echo done", Output: "done", Code: 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d commands, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("command %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// Test: a command whose prompt has not returned yet has an unknown code, not a negative one
+func TestParseCommandHistory_UnknownCode(t *testing.T) {
+	got := parseCommandHistory("user@host:~[12:00][0]» sleep 10\nwaiting")
+	if len(got) != 1 || got[0].Command != "sleep 10" || got[0].Output != "waiting" || got[0].Code != unknownExitCode {
+		t.Errorf("expected sleep 10 with an unknown code, got %+v", got)
+	}
+}
+
+// recipeShells maps recipe names to a command line starting the shell without user rc files
+var recipeShells = map[string][]string{
+	"bash":  {"bash", "--norc", "--noprofile"},
+	"zsh":   {"zsh", "-f"},
+	"fish":  {"fish", "--no-config"},
+	"nu":    {"nu", "--no-config-file"},
+	"pwsh":  {"pwsh", "-NoProfile", "-NoLogo"},
+	"xonsh": {"xonsh", "--no-rc"},
+	"ksh":   {"ksh"},
+	"ksh93": {"ksh93"},
+	"mksh":  {"mksh"},
+	"dash":  {"dash", "-i"},
+	"sh":    {"sh", "-i"},
+	"tcsh":  {"tcsh", "-f"},
+	"csh":   {"csh", "-f"},
+}
+
+// Test: every recipe prepares, reports exit codes and restores a real shell
+func TestShellRecipes_RealShell(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not available")
+	}
+
+	for name, recipe := range shellRecipes {
+		t.Run(name, func(t *testing.T) {
+			argv, ok := recipeShells[name]
+			if !ok {
+				t.Fatalf("no test command line for recipe %s", name)
+			}
+			if _, err := exec.LookPath(argv[0]); err != nil {
+				t.Skipf("%s not available", argv[0])
+			}
+
+			tm := newTestTmux(t, argv)
+			tm.send(recipe.save)
+			tm.send(recipe.prepare)
+			tm.clear(recipe)
+			tm.waitFor(func(last string) bool { return strings.HasSuffix(last, "]»") })
+
+			tm.send("false")
+			tm.send("echo tmuxai-ok")
+			content := tm.waitFor(func(last string) bool {
+				return strings.HasSuffix(last, "[0]»")
+			})
+
+			history := parseCommandHistory(content)
+			if len(history) < 2 {
+				t.Fatalf("expected at least 2 commands, got %+v in:\n%s", history, content)
+			}
+			failed, echoed := history[len(history)-2], history[len(history)-1]
+			if failed.Command != "false" || failed.Code == 0 {
+				t.Errorf("false: got %+v", failed)
+			}
+			if echoed.Command != "echo tmuxai-ok" || echoed.Output != "tmuxai-ok" || echoed.Code != 0 {
+				t.Errorf("echo: got %+v", echoed)
+			}
+
+			tm.send(recipe.restore)
+			tm.clear(recipe)
+			tm.waitFor(func(last string) bool { return last != "" && !strings.HasSuffix(last, "»") })
+		})
+	}
+}
+
+// testTmux drives a shell in a private tmux server. The server uses the default socket
+// in a private TMUX_TMPDIR, so the system package talks to it as well.
+type testTmux struct {
+	t    *testing.T
+	pane string // id of the pane running the shell
+}
+
+func newTestTmux(t *testing.T, argv []string) *testTmux {
+	t.Helper()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not available")
+	}
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	tm := &testTmux{t: t}
+	args := append([]string{"new-session", "-d", "-x", "200", "-y", "50", "-P", "-F", "#{pane_id}"}, argv...)
+	out, err := tm.tmux(args...)
+	if err != nil {
+		t.Skipf("cannot start tmux: %v: %s", err, out)
+	}
+	tm.pane = strings.TrimSpace(out)
+	t.Cleanup(func() { tm.tmux("kill-server") })
+	// give the shell a moment to print its first prompt
+	time.Sleep(500 * time.Millisecond)
+	return tm
+}
+
+func (tm *testTmux) tmux(args ...string) (string, error) {
+	args = append([]string{"-f", "/dev/null"}, args...)
+	out, err := exec.Command("tmux", args...).CombinedOutput()
+	return string(out), err
+}
+
+func (tm *testTmux) clear(recipe shellRecipe) {
+	if recipe.clear != "" {
+		tm.send(recipe.clear)
+		return
+	}
+	tm.tmux("send-keys", "C-l")
+}
+
+func (tm *testTmux) send(keys string) {
+	if _, err := tm.tmux("send-keys", "-l", keys); err != nil {
+		tm.t.Fatalf("send-keys failed: %v", err)
+	}
+	tm.tmux("send-keys", "Enter")
+	time.Sleep(200 * time.Millisecond)
+}
+
+// waitFor polls the pane until the last line satisfies done and returns the pane content
+func (tm *testTmux) waitFor(done func(lastLine string) bool) string {
+	deadline := time.Now().Add(10 * time.Second)
+	var content string
+	for time.Now().Before(deadline) {
+		out, _ := tm.tmux("capture-pane", "-p")
+		content = strings.TrimSpace(out)
+		lines := strings.Split(content, "\n")
+		if done(strings.TrimSpace(lines[len(lines)-1])) {
+			return content
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	tm.t.Fatalf("timed out waiting for pane, content:\n%s", content)
+	return ""
+}
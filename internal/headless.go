@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// HeadlessApprove decides the actions of a headless run, nobody is asked to confirm them.
+// exec_confirm, send_keys_confirm and paste_multiline_confirm do not apply.
+type HeadlessApprove string
+
+const (
+	HeadlessApproveNone   HeadlessApprove = "none"   // nothing runs, the AI can only answer
+	HeadlessApprovePolicy HeadlessApprove = "policy" // only commands the policy approves run
+	HeadlessApproveAll    HeadlessApprove = "all"    // everything runs but privileged, destructive and irreversible commands and those the risk classifier can not see into
+)
+
+// ParseHeadlessApprove validates the --approve flag
+func ParseHeadlessApprove(value string) (HeadlessApprove, error) {
+	switch approve := HeadlessApprove(value); approve {
+	case HeadlessApproveNone, HeadlessApprovePolicy, HeadlessApproveAll:
+		return approve, nil
+	}
+	return "", fmt.Errorf("invalid approval policy %q, use none, policy or all", value)
+}
+
+// HeadlessStatus is how a headless run ended
+type HeadlessStatus string
+
+const (
+	HeadlessAccomplished   HeadlessStatus = "accomplished"
+	HeadlessError          HeadlessStatus = "error"
+	HeadlessWaitingForUser HeadlessStatus = "waiting_for_user" // the AI asked a question
+	HeadlessRejected       HeadlessStatus = "rejected"         // an action was refused by the approval policy
+	HeadlessLimit          HeadlessStatus = "limit"            // stopped at a limit
+	HeadlessCancelled      HeadlessStatus = "cancelled"
+)
+
+// ExitCode is the exit status of tmuxai ask for s
+func (s HeadlessStatus) ExitCode() int {
+	switch s {
+	case HeadlessAccomplished:
+		return 0
+	case HeadlessWaitingForUser:
+		return 3
+	case HeadlessRejected:
+		return 4
+	case HeadlessLimit:
+		return 5
+	case HeadlessCancelled:
+		return 130
+	}
+	return 1
+}
+
+// HeadlessUsage is what a headless run consumed
+type HeadlessUsage struct {
+	Steps      int     `json:"steps"`
+	Commands   int     `json:"commands"`
+	Tokens     int     `json:"tokens"`
+	Cost       float64 `json:"cost"`
+	DurationMs int64   `json:"duration_ms"`
+}
+
+// HeadlessResult is the outcome of a headless run, printed by tmuxai ask --output json
+type HeadlessResult struct {
+	Status    HeadlessStatus `json:"status"`
+	ExitCode  int            `json:"exit_code"`
+	Answer    string         `json:"answer"`
+	Error     string         `json:"error,omitempty"`
+	Actions   []AuditEntry   `json:"actions"` // commands, keys and pastes, run or rejected
+	Usage     HeadlessUsage  `json:"usage"`
+	SessionId string         `json:"session_id"`
+	Model     string         `json:"model"`
+}
+
+// headlessRun is the state of a manager created by NewHeadlessManager
+type headlessRun struct {
+	approve HeadlessApprove
+	actions []AuditEntry
+}
+
+// NewHeadlessManager creates a manager which runs one request without the chat interface.
+// Unlike NewManager it never starts a tmux session, it must run inside tmux.
+// With HeadlessApproveNone no exec pane is created since nothing runs.
+func NewHeadlessManager(cfg *config.Config, approve HeadlessApprove) (*Manager, error) {
+	if err := cfg.OpenRouter.ResolveAPIKey(); err != nil {
+		return nil, err
+	}
+	if cfg.OpenRouter.APIKey == "" {
+		return nil, fmt.Errorf("%s", apiKeyRequired)
+	}
+	paneId, err := system.TmuxCurrentPaneId()
+	if err != nil {
+		return nil, fmt.Errorf("tmuxai ask must run inside tmux: %w", err)
+	}
+
+	m := newManager(cfg, paneId)
+	m.headless = &headlessRun{approve: approve}
+	if approve == HeadlessApproveNone {
+		// the sandbox only matters when commands run
+		return m, nil
+	}
+	if cfg.Sandbox.Enabled {
+		if err := m.startSandbox(); err != nil {
+			return nil, fmt.Errorf("failed to start sandbox: %w", err)
+		}
+	}
+	m.InitExecPane()
+	return m, nil
+}
+
+// RunHeadless runs message to completion with the approval policy of the manager and
+// returns the result. Progress is printed to stdout as in the chat, callers which want
+// only the answer on stdout redirect it.
+func (m *Manager) RunHeadless(ctx context.Context, message string) HeadlessResult {
+	var (
+		mu   sync.Mutex
+		last AgentEvent
+	)
+	m.OnEvent(func(e AgentEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = e
+	})
+
+	if m.headless.approve == HeadlessApproveNone {
+		message += "\n\nThis request runs without a user to confirm actions: do not execute commands, send keys or paste content, only answer."
+	}
+
+	logger.Info("Headless run (approve %s): %s", m.headless.approve, message)
+	m.attachMentions(message)
+	m.startRequestUsage()
+	m.ProcessUserMessage(ctx, message)
+
+	mu.Lock()
+	event := last
+	mu.Unlock()
+
+	result := HeadlessResult{
+		Actions:   m.headless.actions,
+		SessionId: m.SessionId,
+		Model:     m.GetOpenRouterModel(),
+		Usage: HeadlessUsage{
+			Steps:      m.Usage.Steps,
+			Commands:   m.Usage.Commands,
+			Tokens:     m.Usage.Tokens,
+			Cost:       m.Usage.Cost,
+			DurationMs: time.Since(m.Usage.StartedAt).Milliseconds(),
+		},
+	}
+	switch {
+	case ctx.Err() != nil || event.Detail == "cancelled":
+		result.Status = HeadlessCancelled
+	case event.To == StateDone:
+		result.Status = HeadlessAccomplished
+		result.Answer = event.Detail
+	case event.To == StateWaitingForUser:
+		result.Status = HeadlessWaitingForUser
+		result.Answer = event.Detail
+	case event.To == StateError:
+		result.Status = HeadlessError
+		result.Error = event.Detail
+	case event.Detail == "stopped at limit":
+		result.Status = HeadlessLimit
+		result.Error = "stopped at a limit, raise it under limits in the config"
+	default:
+		result.Status = HeadlessRejected
+		result.Error = fmt.Sprintf("%s by the approval policy %q", event.Detail, m.headless.approve)
+	}
+	if result.Answer == "" {
+		result.Answer = m.lastAnswer()
+	}
+	result.ExitCode = result.Status.ExitCode()
+	if result.Actions == nil {
+		result.Actions = []AuditEntry{}
+	}
+	return result
+}
+
+// lastAnswer returns the message of the latest AI response in the history
+func (m *Manager) lastAnswer() string {
+	for i := len(m.Messages) - 1; i >= 0; i-- {
+		if m.Messages[i].FromUser {
+			continue
+		}
+		if r, err := m.parseAIResponse(m.Messages[i].Content); err == nil && r.Message != "" {
+			return r.Message
+		}
+	}
+	return ""
+}
+
+// headlessApproval decides an action a headless run cannot ask about. --approve all
+// approves neither actions which need a typed "yes", nor privileged commands, nor commands
+// the risk classifier can not see into, e.g. bash -c "$CMD".
+func (m *Manager) headlessApproval(opts confirmOptions) Approval {
+	if opts.Unseen != "" {
+		fmt.Printf("Rejected, the command %s\n", opts.Unseen)
+		return ApprovalRejected
+	}
+	if m.headless.approve == HeadlessApproveAll && !opts.TypedYes && opts.Risk < RiskPrivileged {
+		fmt.Println("Approved by --approve all")
+		return ApprovalHeadless
+	}
+	fmt.Printf("Rejected, nobody can confirm it with --approve %s\n", m.headless.approve)
+	return ApprovalRejected
+}
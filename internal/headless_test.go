@@ -0,0 +1,146 @@
+// Tests for headless runs in headless.go
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestRunHeadless_Statuses(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		approve   HeadlessApprove
+		responses []string
+		status    HeadlessStatus
+		answer    string
+		actions   []Approval
+	}{
+		{
+			name:      "accomplished",
+			approve:   HeadlessApprovePolicy,
+			responses: []string{"The disk is 40% full <RequestAccomplished>1</RequestAccomplished>"},
+			status:    HeadlessAccomplished,
+			answer:    "The disk is 40% full",
+		},
+		{
+			name:      "question",
+			approve:   HeadlessApprovePolicy,
+			responses: []string{"Which disk? <WaitingForUserResponse>1</WaitingForUserResponse>"},
+			status:    HeadlessWaitingForUser,
+			answer:    "Which disk?",
+		},
+		{
+			name:      "command outside the policy",
+			approve:   HeadlessApprovePolicy,
+			responses: []string{"Cleaning up <ExecCommand>rm -rf build</ExecCommand>"},
+			status:    HeadlessRejected,
+			answer:    "Cleaning up",
+			actions:   []Approval{ApprovalRejected},
+		},
+		{
+			name:      "whitelisted command without approvals",
+			approve:   HeadlessApproveNone,
+			responses: []string{"Checking <ExecCommand>df -h</ExecCommand>"},
+			status:    HeadlessRejected,
+			actions:   []Approval{ApprovalRejected},
+		},
+		{
+			name:      "keys without approvals",
+			approve:   HeadlessApproveNone,
+			responses: []string{"<TmuxSendKeys>q</TmuxSendKeys>"},
+			status:    HeadlessRejected,
+			actions:   []Approval{ApprovalRejected},
+		},
+		{
+			name:      "failed request",
+			approve:   HeadlessApprovePolicy,
+			responses: nil,
+			status:    HeadlessError,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _ := newTestAgent(t, tc.responses...)
+			m.Config.WhitelistPatterns = []string{`^df\b`}
+			m.Config.ExecConfirm = false // does not apply to headless runs
+			m.headless = &headlessRun{approve: tc.approve}
+
+			result := m.RunHeadless(context.Background(), "check the disk")
+			if result.Status != tc.status || result.ExitCode != tc.status.ExitCode() {
+				t.Fatalf("expected %s, got %+v", tc.status, result)
+			}
+			if tc.answer != "" && result.Answer != tc.answer {
+				t.Errorf("expected answer %q, got %q", tc.answer, result.Answer)
+			}
+			if len(result.Actions) != len(tc.actions) {
+				t.Fatalf("expected actions %v, got %+v", tc.actions, result.Actions)
+			}
+			for i, action := range result.Actions {
+				if action.Approval != tc.actions[i] {
+					t.Errorf("expected action %d to be %s, got %s", i, tc.actions[i], action.Approval)
+				}
+			}
+		})
+	}
+}
+
+func TestRunHeadless_StopsAtLimit(t *testing.T) {
+	m, _ := newTestAgent(t, "Looking <ExecPaneSeemsBusy>1</ExecPaneSeemsBusy>")
+	m.Config.Limits = config.LimitsConfig{MaxSteps: 1}
+	m.SessionOverrides["wait_interval"] = 0
+	m.headless = &headlessRun{approve: HeadlessApprovePolicy}
+
+	if result := m.RunHeadless(context.Background(), "watch the build"); result.Status != HeadlessLimit || result.Usage.Steps != 1 {
+		t.Errorf("expected to stop at the step limit, got %+v", result)
+	}
+}
+
+func TestRunHeadless_Cancelled(t *testing.T) {
+	m, _ := newTestAgent(t, "Done <RequestAccomplished>1</RequestAccomplished>")
+	m.headless = &headlessRun{approve: HeadlessApprovePolicy}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if result := m.RunHeadless(ctx, "anything"); result.Status != HeadlessCancelled || result.ExitCode != 130 {
+		t.Errorf("expected a cancelled run, got %+v", result)
+	}
+}
+
+func TestHeadlessApproval(t *testing.T) {
+	m := &Manager{headless: &headlessRun{approve: HeadlessApproveAll}}
+	if got := m.headlessApproval(confirmOptions{Risk: RiskNetwork}); got != ApprovalHeadless {
+		t.Errorf("--approve all should approve, got %s", got)
+	}
+	if got := m.headlessApproval(confirmOptions{TypedYes: true, Risk: RiskDestructive}); got.Approved() {
+		t.Error("--approve all should not approve destructive actions")
+	}
+	if got := m.headlessApproval(confirmOptions{Risk: RiskPrivileged}); got.Approved() {
+		t.Error("--approve all should not approve privileged commands")
+	}
+	m2, _ := newTestAgent(t)
+	m2.headless = &headlessRun{approve: HeadlessApproveAll}
+	for _, command := range []string{
+		"sudo rm -rf /", "sudo apt-get install curl",
+		"bash -c 'rm -rf ~'", "find / -delete", "find . -exec rm -rf {} +", "timeout 5 rm -rf /",
+		`bash -c "$CMD"`, "eval $CMD", "$EDITOR notes.txt", "env $TOOL --all", `find . -exec "$TOOL" {} \;`,
+	} {
+		if got, _ := m2.confirmedToExec(command, "Execute?", false); got.Approved() {
+			t.Errorf("--approve all should not run %q", command)
+		}
+	}
+	if got, _ := m2.confirmedToExec("bash -c 'make build'", "Execute?", false); got != ApprovalHeadless {
+		t.Errorf("--approve all should run a literal script, got %s", got)
+	}
+	if got := m.headlessApproval(confirmOptions{Risk: RiskLocalWrite, Unseen: "runs a program only known when it runs"}); got.Approved() {
+		t.Error("--approve all should not approve commands the classifier can not see into")
+	}
+	m.headless.approve = HeadlessApprovePolicy
+	if got := m.headlessApproval(confirmOptions{}); got.Approved() {
+		t.Error("--approve policy should reject what the policy did not approve")
+	}
+
+	if _, err := ParseHeadlessApprove("sometimes"); err == nil {
+		t.Error("expected an invalid approval policy to be rejected")
+	}
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+)
+
+// RequestUsage tracks what the agent consumed for the current request
+type RequestUsage struct {
+	StartedAt time.Time
+	Steps     int // AI responses
+	Commands  int // commands and pastes sent to the exec pane
+	Tokens    int
+	Cost      float64 // USD
+}
+
+// limitCheck is one autonomy limit compared against the current usage
+type limitCheck struct {
+	Name   string
+	Used   float64
+	Max    float64
+	Format func(float64) string
+	Parse  func(string) (float64, error)
+	Set    func(float64)
+}
+
+func (l limitCheck) exceeded() bool {
+	return l.Max > 0 && l.Used >= l.Max
+}
+
+func (l limitCheck) String() string {
+	return l.Format(l.Used) + "/" + l.Format(l.Max)
+}
+
+// startRequestUsage resets usage and the effective limits when the user sends a new request
+func (m *Manager) startRequestUsage() {
+	m.Usage = RequestUsage{StartedAt: time.Now()}
+	m.Limits = m.GetLimits()
+}
+
+// recordUsage adds one AI response to the request usage
+func (m *Manager) recordUsage(usage Usage) {
+	m.Usage.Steps++
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		tokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	m.Usage.Tokens += tokens
+
+	cost := usage.Cost
+	if cost == 0 {
+		cost = (float64(usage.PromptTokens)*m.Limits.InputPrice + float64(usage.CompletionTokens)*m.Limits.OutputPrice) / 1e6
+	}
+	m.Usage.Cost += cost
+}
+
+// limitChecks returns the limits for the current request, commands is only
+// included right before a command would be executed
+func (m *Manager) limitChecks(commands bool) []limitCheck {
+	count := func(v float64) string { return strconv.Itoa(int(v)) }
+	parseFloat := func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+
+	checks := []limitCheck{
+		{
+			Name: "steps", Used: float64(m.Usage.Steps), Max: float64(m.Limits.MaxSteps),
+			Format: count, Parse: parseFloat,
+			Set: func(v float64) { m.Limits.MaxSteps = int(v) },
+		},
+		{
+			Name: "time", Used: time.Since(m.Usage.StartedAt).Seconds(), Max: float64(m.Limits.MaxDuration),
+			Format: func(v float64) string {
+				return (time.Duration(v) * time.Second).Round(time.Second).String()
+			},
+			Parse: func(s string) (float64, error) {
+				if d, err := time.ParseDuration(s); err == nil {
+					return d.Seconds(), nil
+				}
+				return strconv.ParseFloat(s, 64)
+			},
+			Set: func(v float64) { m.Limits.MaxDuration = int(v) },
+		},
+		{
+			Name: "tokens", Used: float64(m.Usage.Tokens), Max: float64(m.Limits.MaxTokens),
+			Format: formatTokens, Parse: parseFloat,
+			Set: func(v float64) { m.Limits.MaxTokens = int(v) },
+		},
+		{
+			Name: "cost", Used: m.Usage.Cost, Max: m.Limits.MaxCost,
+			Format: func(v float64) string { return fmt.Sprintf("$%.2f", v) },
+			Parse:  func(s string) (float64, error) { return strconv.ParseFloat(strings.TrimPrefix(s, "$"), 64) },
+			Set:    func(v float64) { m.Limits.MaxCost = v },
+		},
+	}
+	if commands {
+		checks = append(checks, limitCheck{
+			Name: "commands", Used: float64(m.Usage.Commands), Max: float64(m.Limits.MaxCommands),
+			Format: count, Parse: parseFloat,
+			Set: func(v float64) { m.Limits.MaxCommands = int(v) },
+		})
+	}
+	return checks
+}
+
+// withinLimits returns true if the agent may continue. When a limit is reached it pauses
+// and asks the user to continue (raising the limit by its configured amount), enter a
+// new limit, or stop.
+func (m *Manager) withinLimits(commands bool) bool {
+	if m.Usage.StartedAt.IsZero() {
+		m.startRequestUsage()
+	}
+
+	configured := m.GetLimits()
+	for {
+		var reached *limitCheck
+		for _, check := range m.limitChecks(commands) {
+			if check.exceeded() {
+				reached = &check
+				break
+			}
+		}
+		if reached == nil {
+			return true
+		}
+
+		logger.Info("Limit reached: %s %s", reached.Name, reached)
+		increment := limitIncrement(reached.Name, configured)
+
+		answer := m.askLimit(fmt.Sprintf("Limit reached: %s %s. [C]ontinue for %s more, enter a new limit, or [S]top:",
+			reached.Name, reached, reached.Format(increment)))
+		switch answer {
+		case "c", "continue":
+			reached.Set(reached.Max + increment)
+		case "", "s", "stop":
+			m.Println("Stopped at the " + reached.Name + " limit")
+			return false
+		default:
+			value, err := reached.Parse(answer)
+			if err != nil || value <= reached.Used {
+				m.Println(fmt.Sprintf("Enter a %s limit above %s", reached.Name, reached.Format(reached.Used)))
+				continue
+			}
+			reached.Set(value)
+		}
+	}
+}
+
+// limitIncrement is how much "continue" raises a limit: its configured value
+func limitIncrement(name string, cfg config.LimitsConfig) float64 {
+	switch name {
+	case "steps":
+		return float64(cfg.MaxSteps)
+	case "time":
+		return float64(cfg.MaxDuration)
+	case "tokens":
+		return float64(cfg.MaxTokens)
+	case "cost":
+		return cfg.MaxCost
+	case "commands":
+		return float64(cfg.MaxCommands)
+	}
+	return 0
+}
+
+// askLimit reads the answer to a limit prompt, an interrupt counts as stop
+func (m *Manager) askLimit(prompt string) string {
+	if m.headless != nil {
+		fmt.Println(prompt + " stopping, nobody can answer in a headless run")
+		return ""
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          color.New(color.FgHiYellow).Sprint(prompt + " "),
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		return ""
+	}
+	defer rl.Close()
+	answer, err := rl.Readline()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ToLower(answer))
+}
+
+// formatUsage renders usage against the configured limits for the prompt, e.g. "3/30 steps 1m5s/15m0s"
+func (m *Manager) formatUsage() string {
+	if m.Usage.StartedAt.IsZero() {
+		return ""
+	}
+	var parts []string
+	for _, check := range m.limitChecks(true) {
+		if check.Max <= 0 {
+			continue
+		}
+		part := check.String()
+		switch check.Name {
+		case "steps", "commands", "tokens":
+			part += " " + check.Name
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatTokens abbreviates token counts, e.g. 12300 as 12.3k
+func formatTokens(v float64) string {
+	switch {
+	case v >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'f', 1, 64) + "M"
+	case v >= 1e3:
+		return strconv.FormatFloat(v/1e3, 'f', 1, 64) + "k"
+	}
+	return strconv.Itoa(int(v))
+}
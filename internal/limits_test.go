@@ -0,0 +1,59 @@
+// Tests for per request autonomy limits in limits.go
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestLimits_UsageAndFormatting(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Limits = config.LimitsConfig{MaxSteps: 3, MaxDuration: 600, MaxTokens: 20000, MaxCost: 0.5, MaxCommands: 2, InputPrice: 1, OutputPrice: 4}
+	m := &Manager{Config: cfg, SessionOverrides: map[string]interface{}{"limits.max_steps": 5}}
+	m.startRequestUsage()
+
+	if m.Limits.MaxSteps != 5 {
+		t.Errorf("expected session override of max_steps, got %d", m.Limits.MaxSteps)
+	}
+
+	m.recordUsage(Usage{PromptTokens: 10000, CompletionTokens: 1000})
+	m.recordUsage(Usage{PromptTokens: 1000, CompletionTokens: 200, TotalTokens: 1200, Cost: 0.01})
+	if m.Usage.Steps != 2 || m.Usage.Tokens != 12200 {
+		t.Errorf("unexpected usage: %+v", m.Usage)
+	}
+	// 10000 * $1/M + 1000 * $4/M from prices, plus the reported $0.01
+	if cost := m.Usage.Cost; cost < 0.0239 || cost > 0.0241 {
+		t.Errorf("expected cost 0.024, got %f", cost)
+	}
+
+	if got, want := m.formatUsage(), "2/5 steps 0s/10m0s 12.2k/20.0k tokens $0.02/$0.50 0/2 commands"; got != want {
+		t.Errorf("formatUsage() = %q, want %q", got, want)
+	}
+
+	if !m.withinLimits(true) {
+		t.Error("expected usage within limits")
+	}
+
+	m.Usage.Commands = 2
+	reached := ""
+	for _, check := range m.limitChecks(true) {
+		if check.exceeded() {
+			reached = check.Name
+		}
+	}
+	if reached != "commands" {
+		t.Errorf("expected commands limit reached, got %q", reached)
+	}
+	for _, check := range m.limitChecks(false) {
+		if check.exceeded() {
+			t.Errorf("commands limit should only apply before running a command, got %s", check.Name)
+		}
+	}
+
+	m.Usage.StartedAt = time.Now().Add(-11 * time.Minute)
+	if checks := m.limitChecks(false); !checks[1].exceeded() {
+		t.Error("expected time limit reached")
+	}
+}
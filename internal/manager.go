@@ -1,9 +1,16 @@
 package internal
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alvinunreal/tmuxai/config"
@@ -27,27 +34,60 @@ type AIResponse struct {
 type CommandExecHistory struct {
 	Command string
 	Output  string
-	Code    int
+	Code    int // unknownExitCode until the next prompt shows it
 }
 
+// unknownExitCode marks a command whose exit code is not known, real codes may be
+// negative so -1 can not be used
+const unknownExitCode = math.MinInt32
+
 // Manager represents the TmuxAI manager agent
 type Manager struct {
 	Config           *config.Config
 	AiClient         *AiClient
-	Status           string // running, waiting, done
 	PaneId           string
 	ExecPane         *system.TmuxPaneDetails
 	Messages         []ChatMessage
 	ExecHistory      []CommandExecHistory
-	WatchMode        bool
 	OS               string
 	SessionOverrides map[string]interface{} // session-only config overrides
+	SessionId        string
+	StartedAt        time.Time
+	SubShells        map[string]subShellProbe // probed subshells by pane id
+	Sandbox          *Sandbox                 // set when the exec pane runs sandboxed
+	Checkpoints      []Checkpoint
+	SessionApprovals []SessionApproval   // "always allow" rules until exit
+	Usage            RequestUsage        // consumed by the current request
+	Limits           config.LimitsConfig // limits of the current request, raised when the user continues
+	Attachments      []Attachment        // files and piped input sent with the next message
+
+	shutdownOnce sync.Once
+	notifying    sync.WaitGroup // notifications being delivered
+	pipes        panePipes      // pane output followed by watchers
+	headless     *headlessRun   // set by NewHeadlessManager
+
+	configOriginals map[string]any // config values replaced by SessionOverrides, for /config unset
+
+	// mu guards the fields below, they are also used by the Ctrl+C and signal handlers
+	// and by watchers
+	mu            sync.Mutex
+	status        AgentState
+	observers     []func(AgentEvent)
+	runCtx        context.Context // cancelled by Cancel
+	cancelRun     context.CancelFunc
+	watchers      []*Watcher
+	nextWatcherId int
+	output        io.Writer // where watchers print, see SetOutput
 }
 
 // NewManager creates a new manager agent
 func NewManager(cfg *config.Config) (*Manager, error) {
+	if err := cfg.OpenRouter.ResolveAPIKey(); err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
 	if cfg.OpenRouter.APIKey == "" {
-		fmt.Println("OpenRouter API key is required. Set it in the config file or as an environment variable: TMUXAI_OPENROUTER_API_KEY")
+		fmt.Println(apiKeyRequired)
 		return nil, fmt.Errorf("OpenRouter API key is required")
 	}
 
@@ -71,25 +111,53 @@ func NewManager(cfg *config.Config) (*Manager, error) {
 		os.Exit(0)
 	}
 
-	aiClient := NewAiClient(&cfg.OpenRouter)
-	os := system.GetOSDetails()
+	manager := newManager(cfg, paneId)
+
+	if cfg.Sandbox.Enabled {
+		if err := manager.startSandbox(); err != nil {
+			fmt.Println("Failed to start sandbox: " + err.Error())
+			return nil, fmt.Errorf("failed to start sandbox: %w", err)
+		}
+	}
 
+	manager.InitExecPane()
+	manager.refreshProjectConfig()
+	return manager, nil
+}
+
+// newManager creates a manager for the TmuxAI pane paneId without an exec pane yet
+func newManager(cfg *config.Config, paneId string) *Manager {
+	startedAt := time.Now()
 	manager := &Manager{
 		Config:           cfg,
-		AiClient:         aiClient,
+		AiClient:         NewAiClient(&cfg.OpenRouter),
 		PaneId:           paneId,
 		Messages:         []ChatMessage{},
 		ExecPane:         &system.TmuxPaneDetails{},
-		OS:               os,
+		OS:               system.GetOSDetails(),
 		SessionOverrides: make(map[string]interface{}),
+		SubShells:        make(map[string]subShellProbe),
+		SessionId:        startedAt.Format("20060102-150405"),
+		StartedAt:        startedAt,
 	}
-
-	manager.InitExecPane()
-	return manager, nil
+	manager.OnEvent(manager.notifyStateChange)
+	return manager
 }
 
 // Start starts the manager agent
 func (m *Manager) Start(initMessage string) error {
+	defer m.Shutdown()
+
+	// restore the exec pane when the terminal goes away or we are asked to stop
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received %s, shutting down", sig)
+		m.Shutdown()
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+
 	cliInterface := NewCLIInterface(m)
 	if initMessage != "" {
 		logger.Info("Initial task provided: %s", initMessage)
@@ -116,22 +184,32 @@ func (m *Manager) GetPrompt() string {
 	arrowColor := color.New(color.FgHiYellow)
 	stateColor := color.New(color.FgHiWhite)
 
+	status := m.State()
 	var stateSymbol string
-	switch m.Status {
-	case "running":
+	switch status {
+	case StateThinking, StateAwaitingConfirmation, StateExecuting, StateWaitingForPane:
 		stateSymbol = "▶"
-	case "waiting":
+	case StateWaitingForUser:
 		stateSymbol = "?"
-	case "done":
+	case StateDone:
 		stateSymbol = "✓"
+	case StateError:
+		stateSymbol = "✗"
 	default:
 		stateSymbol = ""
 	}
-	if m.WatchMode {
-		stateSymbol = "∞"
+	if usage := m.formatUsage(); usage != "" && status.Active() {
+		stateSymbol += " " + usage
+	}
+	// ∞ and the number of background watchers
+	if watchers := len(m.Watchers()); watchers > 0 {
+		stateSymbol = strings.TrimSpace(stateSymbol + " ∞" + strconv.Itoa(watchers))
 	}
 
 	prompt := tmuxaiColor.Sprint("TmuxAI")
+	if m.Sandbox != nil {
+		prompt += color.New(color.FgHiMagenta).Sprint(" (sandbox)")
+	}
 	if stateSymbol != "" {
 		prompt += " " + stateColor.Sprint("["+stateSymbol+"]")
 	}
@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// Notification is what notifiers deliver, webhooks and commands receive it as JSON
+type Notification struct {
+	Event     string    `json:"event"` // accomplished, waiting_for_user, confirmation, error, watch or trigger
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	SessionId string    `json:"session_id"`
+	PaneId    string    `json:"pane_id,omitempty"` // pane the event is about
+	Host      string    `json:"host"`
+	Time      time.Time `json:"time"`
+}
+
+var notificationTitles = map[string]string{
+	"accomplished":     "Request accomplished",
+	"waiting_for_user": "Waiting for your answer",
+	"confirmation":     "Confirmation needed",
+	"error":            "Request failed",
+	"watch":            "Watch",
+	"trigger":          "Watch trigger",
+}
+
+// Notifier delivers notifications outside the chat pane
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// newNotifier returns the notifier declared by cfg, paneId is the TmuxAI pane
+func newNotifier(cfg config.NotifierConfig, paneId string) (Notifier, error) {
+	switch cfg.Type {
+	case "tmux":
+		return tmuxNotifier{paneId: paneId}, nil
+	case "desktop":
+		return desktopNotifier{}, nil
+	case "bell":
+		return bellNotifier{}, nil
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook notifier needs a url")
+		}
+		return webhookNotifier{url: cfg.URL, headers: cfg.Headers}, nil
+	case "command":
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("command notifier needs a command")
+		}
+		return commandNotifier{command: cfg.Command}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q, use tmux, desktop, bell, webhook or command", cfg.Type)
+}
+
+// summary shortens the message to its first line for status lines and desktop popups
+func (n Notification) summary(max int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(n.Message), "\n")
+	if len(line) > max {
+		line = line[:max-3] + "..."
+	}
+	return line
+}
+
+// tmuxNotifier flashes the message in the status line of the clients and rings the
+// bell in the TmuxAI pane, which flags its window in the window list
+type tmuxNotifier struct {
+	paneId string
+}
+
+func (t tmuxNotifier) Notify(n Notification) error {
+	text := "TmuxAI: " + n.Title
+	if summary := n.summary(120); summary != "" {
+		text += ": " + summary
+	}
+	fmt.Print("\a")
+	return system.TmuxDisplayMessage(t.paneId, text)
+}
+
+// desktopNotifier shows a desktop notification with notify-send, D-Bus or osascript on macOS
+type desktopNotifier struct{}
+
+func (desktopNotifier) Notify(n Notification) error {
+	title, body := "TmuxAI: "+n.Title, n.summary(300)
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", body, title)
+		cmd = exec.Command("osascript", "-e", script)
+	case commandExists("notify-send"):
+		cmd = exec.Command("notify-send", "--app-name=TmuxAI", title, body)
+	case commandExists("gdbus"):
+		cmd = exec.Command("gdbus", "call", "--session",
+			"--dest", "org.freedesktop.Notifications",
+			"--object-path", "/org/freedesktop/Notifications",
+			"--method", "org.freedesktop.Notifications.Notify",
+			"TmuxAI", "0", "", title, body, "[]", "{}", "-1")
+	default:
+		return fmt.Errorf("no notify-send or gdbus found for desktop notifications")
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// bellNotifier rings the terminal bell
+type bellNotifier struct{}
+
+func (bellNotifier) Notify(Notification) error {
+	fmt.Print("\a")
+	return nil
+}
+
+// webhookNotifier POSTs the notification as JSON
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+}
+
+func (w webhookNotifier) Notify(n Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// commandNotifier runs a shell command with the notification as JSON on stdin
+// and its fields in TMUXAI_EVENT, TMUXAI_TITLE and TMUXAI_MESSAGE
+type commandNotifier struct {
+	command string
+}
+
+func (c commandNotifier) Notify(n Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"TMUXAI_EVENT="+n.Event,
+		"TMUXAI_TITLE="+n.Title,
+		"TMUXAI_MESSAGE="+n.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// notifier returns the notifier declared under notify.notifiers of cfg, or the built-in one called name
+func (m *Manager) notifier(cfg *config.Config, name string) (Notifier, error) {
+	if cfg, ok := cfg.Notify.Notifiers[name]; ok {
+		return newNotifier(cfg, m.PaneId)
+	}
+	return newNotifier(config.NotifierConfig{Type: name}, m.PaneId)
+}
+
+// notify delivers n with each of the named notifiers in the background
+func (m *Manager) notify(names []string, n Notification) {
+	m.notifyWith(m.Config, names, n)
+}
+
+// notifyWith is notify with the notifiers declared in cfg, watchers pass their snapshot
+func (m *Manager) notifyWith(cfg *config.Config, names []string, n Notification) {
+	if len(names) == 0 {
+		return
+	}
+	n.SessionId = m.SessionId
+	n.Time = time.Now()
+	n.Host, _ = os.Hostname()
+	if n.Title == "" {
+		n.Title = notificationTitles[n.Event]
+	}
+
+	for _, name := range names {
+		notifier, err := m.notifier(cfg, strings.TrimSpace(name))
+		if err != nil {
+			logger.Error("Notifier %s: %v", name, err)
+			continue
+		}
+		m.notifying.Add(1)
+		go func() {
+			defer m.notifying.Done()
+			if err := notifier.Notify(n); err != nil {
+				logger.Error("Notifier %s failed for %s: %v", name, n.Event, err)
+			}
+		}()
+	}
+}
+
+// notifyStateChange notifies about states which need the user, it is registered with OnEvent
+func (m *Manager) notifyStateChange(e AgentEvent) {
+	cfg := m.Config.Notify
+	long := m.Usage.StartedAt.IsZero() || time.Since(m.Usage.StartedAt) >= time.Duration(cfg.MinDuration)*time.Second
+	switch e.To {
+	case StateDone:
+		if long {
+			m.notify(cfg.Accomplished, Notification{Event: "accomplished", Message: e.Detail})
+		}
+	case StateWaitingForUser:
+		if long {
+			m.notify(cfg.WaitingForUser, Notification{Event: "waiting_for_user", Message: e.Detail})
+		}
+	case StateAwaitingConfirmation:
+		m.notify(cfg.Confirmation, Notification{Event: "confirmation", Message: e.Detail, PaneId: m.ExecPane.Id})
+	case StateError:
+		m.notify(cfg.Error, Notification{Event: "error", Message: e.Detail})
+	}
+}
@@ -0,0 +1,132 @@
+// Tests for notifiers in notify.go
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// newNotifyTestManager returns a manager with a webhook notifier called hook and the payloads it received
+func newNotifyTestManager(t *testing.T) (*Manager, func() []Notification) {
+	var mu sync.Mutex
+	var received []Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var n Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		mu.Lock()
+		received = append(received, n)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Notify.Notifiers = map[string]config.NotifierConfig{
+		"hook": {Type: "webhook", URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}},
+	}
+	m := &Manager{Config: cfg, SessionId: "20250101-120000", ExecPane: &system.TmuxPaneDetails{}}
+	return m, func() []Notification {
+		m.notifying.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Notification(nil), received...)
+	}
+}
+
+func TestNotify_Webhook(t *testing.T) {
+	m, received := newNotifyTestManager(t)
+	m.notify([]string{"hook"}, Notification{Event: "trigger", Message: "OOMKilled", PaneId: "%3"})
+
+	got := received()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(got))
+	}
+	n := got[0]
+	if n.Event != "trigger" || n.Title != "Watch trigger" || n.Message != "OOMKilled" || n.PaneId != "%3" || n.SessionId != "20250101-120000" || n.Time.IsZero() {
+		t.Errorf("unexpected payload %+v", n)
+	}
+}
+
+func TestNotify_Command(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "notification")
+	m, _ := newNotifyTestManager(t)
+	m.Config.Notify.Notifiers["script"] = config.NotifierConfig{
+		Type:    "command",
+		Command: `{ echo "$TMUXAI_EVENT|$TMUXAI_MESSAGE"; cat; } > ` + out,
+	}
+	m.notify([]string{"script"}, Notification{Event: "watch", Message: "disk almost full"})
+	m.notifying.Wait()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, payload, _ := strings.Cut(string(data), "\n")
+	if env != "watch|disk almost full" {
+		t.Errorf("unexpected environment %q", env)
+	}
+	var n Notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil || n.Message != "disk almost full" {
+		t.Errorf("expected the JSON payload on stdin, got %q (%v)", payload, err)
+	}
+}
+
+func TestNotify_StateChanges(t *testing.T) {
+	m, received := newNotifyTestManager(t)
+	m.Config.Notify.Accomplished = []string{"hook"}
+	m.Config.Notify.Confirmation = []string{"hook"}
+	m.Config.Notify.MinDuration = 60
+	m.OnEvent(m.notifyStateChange)
+
+	// a quick request does not notify, confirmations always do
+	m.Usage.StartedAt = time.Now()
+	m.setState(StateDone, "quick answer")
+	m.setState(StateAwaitingConfirmation, "rm -rf build")
+	m.Usage.StartedAt = time.Now().Add(-2 * time.Minute)
+	m.setState(StateWaitingForUser, "which disk?")
+	m.setState(StateDone, "disk cleaned")
+
+	got := received()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 notifications, got %+v", got)
+	}
+	if got := map[string]string{got[0].Event: got[0].Message, got[1].Event: got[1].Message}; got["confirmation"] != "rm -rf build" || got["accomplished"] != "disk cleaned" {
+		t.Errorf("unexpected notifications %v", got)
+	}
+}
+
+func TestNotify_WatchOverride(t *testing.T) {
+	w := &Watcher{}
+	if got := w.notifiers([]string{"tmux"}); len(got) != 1 || got[0] != "tmux" {
+		t.Errorf("expected the configured notifiers, got %v", got)
+	}
+	w.Notify = []string{"desktop", "hook"}
+	if got := w.notifiers([]string{"tmux"}); len(got) != 2 || got[1] != "hook" {
+		t.Errorf("expected the /watch --notify notifiers, got %v", got)
+	}
+}
+
+func TestNewNotifier_Errors(t *testing.T) {
+	for _, cfg := range []config.NotifierConfig{
+		{Type: "pager"},
+		{Type: "webhook"},
+		{Type: "command"},
+	} {
+		if _, err := newNotifier(cfg, "%1"); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
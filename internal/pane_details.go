@@ -19,6 +19,7 @@ func (m *Manager) GetTmuxPanes() ([]system.TmuxPaneDetails, error) {
 		currentPanes[i].IsPrepared = currentPanes[i].Id == m.ExecPane.Id
 		if currentPanes[i].IsSubShell {
 			currentPanes[i].OS = "OS Unknown (subshell)"
+			m.applySubShellDetails(&currentPanes[i])
 		} else {
 			currentPanes[i].OS = m.OS
 		}
@@ -67,6 +68,13 @@ func (m *Manager) GetTmuxPanesInXml(config *config.Config) string {
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - IsTmuxAiExecPane: %t\n", pane.IsTmuxAiExecPane))
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - IsPrepared: %t\n", pane.IsPrepared))
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - IsSubShell: %t\n", pane.IsSubShell))
+		if pane.RemoteHost != "" {
+			currentTmuxWindow.WriteString(fmt.Sprintf(" - RemoteHost: %s\n", pane.RemoteHost))
+			currentTmuxWindow.WriteString(fmt.Sprintf(" - RemoteUser: %s\n", pane.RemoteUser))
+		}
+		if pane.ContainerId != "" {
+			currentTmuxWindow.WriteString(fmt.Sprintf(" - ContainerId: %s\n", pane.ContainerId))
+		}
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - HistorySize: %d\n", pane.HistorySize))
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - HistoryLimit: %d\n", pane.HistoryLimit))
 
@@ -0,0 +1,349 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// commandStage is one simple command found in a shell command line,
+// e.g. "ps aux | grep node" has the stages "ps aux" and "grep node".
+type commandStage struct {
+	Text       string // normalized source of the simple command, matched against patterns
+	Program    string // empty when the program name is not a literal (e.g. $EDITOR)
+	Dynamic    bool   // the program is chosen by an expansion, e.g. $EDITOR
+	Subcommand string // first non-flag argument, e.g. "get" in "kubectl get pods"
+	Flags      []string
+	Args       []string
+	Expanded   []bool   // whether each of Args depends on expansions, e.g. "$1"
+	Assigns    []string // variables assigned by the stage, e.g. PATH in "PATH=/x ls"
+	Writes     []string // paths written by redirections, "" for non-literal targets
+	Nested     bool     // runs inside a command substitution or subshell
+	Construct  string   // what a stage which is not a simple command does, e.g. "declares variables with export"
+}
+
+// PolicyDecision explains whether a command can run without confirmation
+type PolicyDecision struct {
+	Approved    bool
+	SessionRule bool   // approved by an "always allow" rule of this session
+	Stage       string // the stage which needs a manual check
+	Reason      string
+
+	rules []*SessionApproval // session rules which approved the command, see useSessionApprovals
+}
+
+func (d PolicyDecision) String() string {
+	if d.Approved {
+		return "auto-approved"
+	}
+	if d.Stage == "" {
+		return d.Reason
+	}
+	return fmt.Sprintf("`%s` %s", d.Stage, d.Reason)
+}
+
+// parseCommandStages parses command with a POSIX/bash parser and returns every simple command,
+// including the ones nested in substitutions, subshells, loops and conditionals.
+func parseCommandStages(command string) ([]commandStage, error) {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, err
+	}
+
+	var stages []commandStage
+	var visit func(node syntax.Node, nested bool)
+	visit = func(node syntax.Node, nested bool) {
+		syntax.Walk(node, func(n syntax.Node) bool {
+			switch n := n.(type) {
+			case *syntax.CmdSubst:
+				for _, stmt := range n.Stmts {
+					visit(stmt, true)
+				}
+				return false
+			case *syntax.ProcSubst:
+				for _, stmt := range n.Stmts {
+					visit(stmt, true)
+				}
+				return false
+			case *syntax.Subshell:
+				for _, stmt := range n.Stmts {
+					visit(stmt, true)
+				}
+				return false
+			case *syntax.Stmt:
+				call, ok := n.Cmd.(*syntax.CallExpr)
+				if !ok {
+					// redirections on compound commands still write files
+					stage := commandStage{Text: printNode(n), Writes: redirectWrites(n.Redirs), Nested: nested, Construct: shellConstruct(n.Cmd)}
+					if len(stage.Writes) > 0 || stage.Construct != "" {
+						stages = append(stages, stage)
+					}
+					return true
+				}
+				// substitutions like $(...) run first, so list their stages before this one
+				for _, word := range call.Args {
+					visit(word, true)
+				}
+				for _, assign := range call.Assigns {
+					visit(assign, true)
+				}
+				for _, redir := range n.Redirs {
+					visit(redir, true)
+				}
+				stages = append(stages, newCommandStage(call, n.Redirs, nested))
+				return false
+			}
+			return true
+		})
+	}
+	visit(file, false)
+	return stages, nil
+}
+
+// shellConstruct describes what cmd does when it is shell syntax the policy can not check
+// like a program, e.g. export, and returns "" for simple commands, lists, pipelines, loops,
+// conditionals and blocks, whose commands are stages of their own
+func shellConstruct(cmd syntax.Command) string {
+	switch cmd := cmd.(type) {
+	case *syntax.DeclClause:
+		return "declares variables with " + cmd.Variant.Value
+	case *syntax.LetClause:
+		return "evaluates arithmetic with let"
+	case *syntax.ArithmCmd:
+		return "evaluates arithmetic"
+	case *syntax.TestClause:
+		return "runs a [[ ]] test"
+	case *syntax.FuncDecl:
+		return "defines a function"
+	case *syntax.CoprocClause:
+		return "starts a coprocess"
+	case *syntax.TestDecl:
+		return "declares a test"
+	}
+	return ""
+}
+
+func newCommandStage(call *syntax.CallExpr, redirs []*syntax.Redirect, nested bool) commandStage {
+	stage := commandStage{
+		Text:   printNode(call),
+		Writes: redirectWrites(redirs),
+		Nested: nested,
+	}
+	for _, assign := range call.Assigns {
+		if assign.Name != nil {
+			stage.Assigns = append(stage.Assigns, assign.Name.Value)
+		}
+	}
+	for i, word := range call.Args {
+		value, static := wordValue(word)
+		if i == 0 {
+			if static {
+				stage.Program = value
+			}
+			stage.Dynamic = !static
+			continue
+		}
+		if !static {
+			value = printNode(word)
+		}
+		stage.Args = append(stage.Args, value)
+		stage.Expanded = append(stage.Expanded, !static)
+		switch {
+		case strings.HasPrefix(value, "-"):
+			stage.Flags = append(stage.Flags, value)
+		case stage.Subcommand == "":
+			stage.Subcommand = value
+		}
+	}
+	return stage
+}
+
+// redirectWrites returns the targets of redirections which write to files
+func redirectWrites(redirs []*syntax.Redirect) []string {
+	var writes []string
+	for _, r := range redirs {
+		switch r.Op {
+		case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut, syntax.RdrInOut:
+		case syntax.DplOut:
+			// ">&2" duplicates a descriptor, ">& file" writes to a file
+			if target, _ := wordValue(r.Word); target == "-" || isDigits(target) {
+				continue
+			}
+		default:
+			continue
+		}
+		target, static := wordValue(r.Word)
+		if !static {
+			target = ""
+		}
+		writes = append(writes, target)
+	}
+	return writes
+}
+
+// wordValue returns the literal value of word, and false if it depends on expansions
+func wordValue(word *syntax.Word) (string, bool) {
+	if word == nil {
+		return "", false
+	}
+	var sb strings.Builder
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range p.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+func printNode(node syntax.Node) string {
+	var buf bytes.Buffer
+	syntax.NewPrinter(syntax.SingleLine(true)).Print(&buf, node)
+	return strings.TrimSpace(buf.String())
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPolicy decides if command can run without confirmation. Every stage of the command
+// must match a whitelist pattern or a session approval and no blacklist pattern, and
+// redirections may only write inside allowed_write_paths.
+func (m *Manager) checkPolicy(command string) PolicyDecision {
+	stages, err := parseCommandStages(command)
+	if err != nil {
+		return PolicyDecision{Reason: fmt.Sprintf("could not be parsed: %v", err)}
+	}
+	if len(stages) == 0 {
+		return PolicyDecision{Reason: "contains no command"}
+	}
+
+	// an exact command approval skips the whitelist and write checks, not the blacklist
+	exact := m.sessionApprovalFor(command)
+	approved := PolicyDecision{Approved: true}
+	if exact != nil {
+		approved.rules = append(approved.rules, exact)
+	}
+	for _, stage := range stages {
+		decision := m.checkStage(stage, exact != nil)
+		if !decision.Approved {
+			return decision
+		}
+		approved.rules = append(approved.rules, decision.rules...)
+	}
+	approved.SessionRule = len(approved.rules) > 0
+	return approved
+}
+
+// checkStage applies the policy to a single simple command. When exactApproved is set
+// the user allowed the whole command line for this session and only the blacklist applies.
+func (m *Manager) checkStage(stage commandStage, exactApproved bool) PolicyDecision {
+	manual := func(format string, args ...any) PolicyDecision {
+		reason := fmt.Sprintf(format, args...)
+		if stage.Nested {
+			reason += " (inside a substitution or subshell)"
+		}
+		return PolicyDecision{Stage: stage.Text, Reason: reason}
+	}
+
+	if !exactApproved {
+		for _, target := range stage.Writes {
+			if target == "" {
+				return manual("redirects to a path that depends on expansions")
+			}
+			if !m.isWriteAllowed(target) {
+				return manual("writes to %s which is outside allowed_write_paths", target)
+			}
+		}
+
+		if stage.Construct != "" {
+			return manual("%s", stage.Construct)
+		}
+		if stage.Program == "" && len(stage.Args) == 0 {
+			if len(stage.Assigns) > 0 {
+				return manual("assigns shell variables %s", strings.Join(stage.Assigns, ", "))
+			}
+			// a bare redirection such as "> file" or a redirected compound command
+			return PolicyDecision{Approved: true}
+		}
+		if stage.Program == "" {
+			return manual("runs a program chosen by an expansion")
+		}
+	}
+
+	for _, pattern := range m.Config.BlacklistPatterns {
+		if pattern == "" {
+			continue
+		}
+		match, err := regexp.MatchString(pattern, stage.Text)
+		if err != nil {
+			return manual("could not be checked, invalid blacklist pattern '%s': %v", pattern, err)
+		}
+		if match {
+			return manual("matches blacklist pattern '%s'", pattern)
+		}
+	}
+
+	if exactApproved {
+		return PolicyDecision{Approved: true}
+	}
+	if rule := m.sessionApprovalForStage(stage); rule != nil {
+		return PolicyDecision{Approved: true, rules: []*SessionApproval{rule}}
+	}
+
+	for _, pattern := range m.Config.WhitelistPatterns {
+		if pattern == "" {
+			continue
+		}
+		match, err := regexp.MatchString(pattern, stage.Text)
+		if err != nil {
+			return manual("could not be checked, invalid whitelist pattern '%s': %v", pattern, err)
+		}
+		if match {
+			return PolicyDecision{Approved: true}
+		}
+	}
+
+	return manual("matches no whitelist pattern")
+}
+
+// isWriteAllowed reports whether target is inside one of the allowed_write_paths
+func (m *Manager) isWriteAllowed(target string) bool {
+	target = expandHome(target)
+	if !filepath.IsAbs(target) && m.ExecPane != nil && m.ExecPane.CurrentPath != "" {
+		target = filepath.Join(m.ExecPane.CurrentPath, target)
+	}
+	target = filepath.Clean(target)
+
+	for _, allowed := range m.Config.AllowedWritePaths {
+		allowed = filepath.Clean(expandHome(allowed))
+		if rel, err := filepath.Rel(allowed, target); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+// Tests for the per stage command policy in policy.go
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+func TestParseCommandStages(t *testing.T) {
+	stages, err := parseCommandStages(`FOO=1 kubectl get pods -n prod | grep api > /tmp/out; echo "$(date)"`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(stages) != 4 {
+		t.Fatalf("expected 4 stages, got %d: %+v", len(stages), stages)
+	}
+	kubectl := stages[0]
+	if kubectl.Program != "kubectl" || kubectl.Subcommand != "get" || strings.Join(kubectl.Flags, " ") != "-n" {
+		t.Errorf("unexpected kubectl stage: %+v", kubectl)
+	}
+	if strings.Join(kubectl.Assigns, ",") != "FOO" {
+		t.Errorf("expected FOO assignment, got %v", kubectl.Assigns)
+	}
+	if grep := stages[1]; grep.Program != "grep" || strings.Join(grep.Writes, ",") != "/tmp/out" {
+		t.Errorf("unexpected grep stage: %+v", grep)
+	}
+	if date := stages[2]; date.Program != "date" || !date.Nested {
+		t.Errorf("expected nested date stage, got %+v", date)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WhitelistPatterns = []string{`^ps\b`, `^grep\b`, `^echo\b`, `^ls\b`, `^cat\b`}
+	cfg.BlacklistPatterns = []string{`\brm\s+`}
+	m := &Manager{Config: cfg, ExecPane: &system.TmuxPaneDetails{CurrentPath: "/home/user/project"}}
+
+	tests := []struct {
+		command  string
+		approved bool
+		stage    string
+	}{
+		{"ps aux | grep node", true, ""},
+		{"ls -la && cat README.md", true, ""},
+		{"echo hi > /dev/null 2>&1", true, ""},
+		{"ls > out.txt", false, "ls"},
+		{"ps aux | sort", false, "sort"},
+		{"echo $(rm -rf x)", false, "rm -rf x"},
+		{"(cd /tmp; ls)", false, "cd /tmp"},
+		{"$EDITOR file", false, "$EDITOR file"},
+		{"echo hi > $TARGET", false, "echo hi"},
+		{"PATH=/tmp ls", false, "PATH=/tmp ls"},
+		{"export PATH=/tmp/evil:$PATH; ls", false, "export PATH=/tmp/evil:$PATH"},
+		{"declare -x PATH=/x; ls", false, "declare -x PATH=/x"},
+		{"let x=1; ls", false, "let x=1"},
+		{"FOO=1; ls", false, "FOO=1"},
+		{"ls() { cat /etc/shadow; }; ls", false, "ls() { cat /etc/shadow; }"},
+		{"echo 'unterminated", false, ""},
+	}
+	for _, tt := range tests {
+		decision := m.checkPolicy(tt.command)
+		if decision.Approved != tt.approved {
+			t.Errorf("%q: expected approved=%v, got %v (%s)", tt.command, tt.approved, decision.Approved, decision)
+			continue
+		}
+		if tt.stage != "" && decision.Stage != tt.stage {
+			t.Errorf("%q: expected stage %q, got %q (%s)", tt.command, tt.stage, decision.Stage, decision)
+		}
+	}
+
+	m.Config.AllowedWritePaths = append(m.Config.AllowedWritePaths, "/home/user/project/build")
+	if decision := m.checkPolicy("ls > build/files.txt"); !decision.Approved {
+		t.Errorf("expected relative write inside allowed path to be approved: %s", decision)
+	}
+	if decision := m.checkPolicy("ls > build/../secret"); decision.Approved {
+		t.Errorf("expected write escaping allowed path to need a manual check")
+	}
+}
@@ -10,43 +10,75 @@ import (
 	"github.com/briandowns/spinner"
 )
 
+// stepOutcome tells the agent loop what to do after one AI response
+type stepOutcome int
+
+const (
+	stepContinue     stepOutcome = iota // send the next message to the AI
+	stepAccomplished                    // the request is accomplished
+	stepStop                            // waiting for the user, cancelled, rejected or failed
+)
+
 // Main function to process regular user messages
 // Returns true if the request was accomplished and no further processing should happen
 func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
+	ctx, done := m.beginRun(ctx)
+	defer done()
+
+	for {
+		outcome, next := m.agentStep(ctx, message)
+		switch outcome {
+		case stepAccomplished:
+			return true
+		case stepStop:
+			return false
+		}
+		message = next
+	}
+}
+
+// agentStep sends message with the current pane context to the AI and acts on its response.
+// It returns the outcome and, for stepContinue, the next message to send.
+func (m *Manager) agentStep(ctx context.Context, message string) (stepOutcome, string) {
+	if ctx.Err() != nil {
+		return stepStop, ""
+	}
+
 	// Check if context management is needed before sending
 	if m.needSquash() {
 		m.Println("Exceeded context size, squashing history...")
 		m.squashHistory()
 	}
 
+	if !m.withinLimits(false) {
+		m.setState(StateIdle, "stopped at limit")
+		return stepStop, ""
+	}
+
+	m.setState(StateThinking, "")
 	s := spinner.New(spinner.CharSets[26], 100*time.Millisecond)
 	s.Start()
 
-	// check for status change before processing
-	if m.Status == "" {
-		s.Stop()
-		return false
-	}
-
 	currentTmuxWindow := m.GetTmuxPanesInXml(m.Config)
 	execPaneEnv := ""
-	if !m.ExecPane.IsSubShell {
+	switch {
+	case !m.ExecPane.IsSubShell:
 		execPaneEnv = fmt.Sprintf("Keep in mind, you are working within the shell: %s and OS: %s", m.ExecPane.Shell, m.ExecPane.OS)
+	case m.ExecPane.RemoteHost != "":
+		execPaneEnv = fmt.Sprintf("Keep in mind, you are working within %s on host %s as %s, the shell is: %s and OS: %s", m.ExecPane.CurrentCommand, m.ExecPane.RemoteHost, m.ExecPane.RemoteUser, m.ExecPane.Shell, m.ExecPane.OS)
 	}
 	currentMessage := ChatMessage{
-		Content:   currentTmuxWindow + "\n\n" + execPaneEnv + "\n\n" + message,
-		FromUser:  true,
-		Timestamp: time.Now(),
+		Content:     currentTmuxWindow + "\n\n" + execPaneEnv + "\n\n" + message,
+		FromUser:    true,
+		Timestamp:   time.Now(),
+		Attachments: m.Attachments,
 	}
 
 	// build current chat history
 	var history []ChatMessage
-	switch {
-	case m.WatchMode:
-		history = []ChatMessage{m.watchPrompt()}
-	case m.ExecPane.IsPrepared:
+	if m.ExecPane.IsPrepared {
 		history = []ChatMessage{m.chatAssistantPrompt(true)}
-	default:
+	} else {
 		history = []ChatMessage{m.chatAssistantPrompt(false)}
 	}
 
@@ -57,10 +89,9 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 	response, err := m.AiClient.GetResponseFromChatMessages(ctx, sending, m.GetOpenRouterModel())
 	if err != nil {
 		s.Stop()
-		m.Status = ""
 
-		if ctx.Err() == context.Canceled {
-			return false
+		if ctx.Err() != nil {
+			return stepStop, ""
 		}
 
 		// Log both to console and debug file to capture error context
@@ -72,19 +103,21 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 			debugChatMessages(append(history, currentMessage), "ERROR: "+err.Error())
 		}
 
-		return false
+		m.setState(StateError, errMsg)
+		return stepStop, ""
 	}
 
-	// check for status change again
-	if m.Status == "" {
+	m.recordUsage(m.AiClient.LastUsage())
+
+	// check for cancellation again
+	if ctx.Err() != nil {
 		s.Stop()
-		return false
+		return stepStop, ""
 	}
 
 	r, err := m.parseAIResponse(response)
 	if err != nil {
 		s.Stop()
-		m.Status = ""
 
 		// Log both to console and debug file
 		errMsg := "Failed to parse AI response: " + err.Error()
@@ -95,7 +128,8 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 			debugChatMessages(append(history, currentMessage), "PARSE ERROR: "+response)
 		}
 
-		return false
+		m.setState(StateError, errMsg)
+		return stepStop, ""
 	}
 
 	if m.Config.Debug {
@@ -117,8 +151,8 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 	if !validResponse {
 		m.Println("AI didn't follow guidelines, trying again...")
 		m.Messages = append(m.Messages, currentMessage, responseMsg)
-		return m.ProcessUserMessage(ctx, guidelineError)
-
+		m.Attachments = nil
+		return stepContinue, guidelineError
 	}
 
 	// colorize code blocks in the response
@@ -126,10 +160,12 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		fmt.Println(system.Cosmetics(r.Message))
 	}
 
-	// Don't append to history if AI is waiting for the pane or is watch mode no comment
+	// Don't append to history if AI is waiting for the pane or had no comment
 	if r.ExecPaneSeemsBusy || r.NoComment {
 	} else {
+		// attachments are sent until a message carrying them is in the history
 		m.Messages = append(m.Messages, currentMessage, responseMsg)
+		m.Attachments = nil
 	}
 
 	// observe/prepared mode
@@ -137,24 +173,55 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		code, _ := system.HighlightCode("sh", execCommand)
 		m.Println(code)
 
-		isSafe := false
+		if !m.withinLimits(true) {
+			m.setState(StateIdle, "stopped at limit")
+			return stepStop, ""
+		}
+
+		approval := ApprovalNoConfirm
 		command := execCommand
 		if m.GetExecConfirm() {
-			isSafe, command = m.confirmedToExec(execCommand, "Execute this command?", true)
-		} else {
-			isSafe = true
+			approval, command = m.confirmedToExec(execCommand, "Execute this command?", true)
 		}
-		if isSafe {
-			m.Println("Executing command: " + command)
-			if m.ExecPane.IsPrepared {
-				m.ExecWaitCapture(command)
-			} else {
-				system.TmuxSendCommandToPane(m.ExecPane.Id, command, true)
-				time.Sleep(1 * time.Second)
+		// the risk of what runs, which the user may have edited
+		assessed := command
+		if !approval.Approved() {
+			assessed = execCommand
+		}
+		entry := AuditEntry{
+			Action:     "exec",
+			Text:       execCommand,
+			EditedText: command,
+			Approval:   approval,
+			Risk:       m.assessRisk(assessed).Level.String(),
+		}
+		if !approval.Approved() {
+			m.audit(entry)
+			m.setState(StateIdle, "command rejected")
+			return stepStop, ""
+		}
+
+		m.useSessionApprovals(approval, command)
+		m.Usage.Commands++
+		m.createCheckpoint(command)
+		m.setState(StateExecuting, command)
+		m.Println("Executing command: " + command)
+		entry.Status = AuditStarted
+		m.audit(entry)
+		started := time.Now()
+		if m.ExecPane.IsPrepared {
+			if result, err := m.ExecWaitCapture(ctx, command); err == nil && result.Code != unknownExitCode {
+				entry.ExitCode = &result.Code
 			}
 		} else {
-			m.Status = ""
-			return false
+			system.TmuxSendCommandToPane(m.ExecPane.Id, command, true)
+			time.Sleep(1 * time.Second)
+		}
+		entry.Status = AuditFinished
+		entry.DurationMs = time.Since(started).Milliseconds()
+		m.audit(entry)
+		if ctx.Err() != nil {
+			return stepStop, ""
 		}
 	}
 
@@ -180,31 +247,29 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		}
 
 		// Get confirmation if required
-		allConfirmed := true
+		approval := ApprovalNoConfirm
 		if m.GetSendKeysConfirm() {
-			allConfirmed, _ = m.confirmedToExec("keys shown above", confirmMessage, true)
-			if !allConfirmed {
-				m.Status = ""
-				return false
+			if approval, _ = m.confirmPrompt("keys shown above", confirmMessage, confirmOptions{Edit: true}); !approval.Approved() {
+				for _, sendKey := range r.SendKeys {
+					m.audit(AuditEntry{Action: "send_keys", Text: sendKey, Approval: ApprovalRejected})
+				}
+				m.setState(StateIdle, "keys rejected")
+				return stepStop, ""
 			}
 		}
 
 		// Send each key with delay
+		m.setState(StateExecuting, "sending keys")
 		for _, sendKey := range r.SendKeys {
 			m.Println("Sending keys: " + sendKey)
+			entry := AuditEntry{Action: "send_keys", Text: sendKey, Approval: approval, Status: AuditStarted}
+			m.audit(entry)
+			started := time.Now()
 			system.TmuxSendCommandToPane(m.ExecPane.Id, sendKey, false)
 			time.Sleep(1 * time.Second)
-		}
-	}
-
-	if r.ExecPaneSeemsBusy {
-		m.Countdown(m.GetWaitInterval())
-		// Create a new context for this recursive call
-		newCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		accomplished := m.ProcessUserMessage(newCtx, "waited for 5 more seconds, here is the current pane(s) content")
-		if accomplished {
-			return true
+			entry.Status = AuditFinished
+			entry.DurationMs = time.Since(started).Milliseconds()
+			m.audit(entry)
 		}
 	}
 
@@ -213,70 +278,60 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		code, _ := system.HighlightCode("txt", r.PasteMultilineContent)
 		fmt.Println(code)
 
-		isSafe := false
-		if m.GetPasteMultilineConfirm() {
-			isSafe, _ = m.confirmedToExec(r.PasteMultilineContent, "Paste multiline content?", false)
-		} else {
-			isSafe = true
+		if !m.withinLimits(true) {
+			m.setState(StateIdle, "stopped at limit")
+			return stepStop, ""
 		}
 
-		if isSafe {
-			m.Println("Pasting...")
-			system.TmuxSendCommandToPane(m.ExecPane.Id, r.PasteMultilineContent, true)
-			time.Sleep(1 * time.Second)
-		} else {
-			m.Status = ""
-			return false
+		approval := ApprovalNoConfirm
+		if m.GetPasteMultilineConfirm() {
+			approval, _ = m.confirmedToExec(r.PasteMultilineContent, "Paste multiline content?", false)
+		}
+		entry := AuditEntry{
+			Action:   "paste",
+			Text:     r.PasteMultilineContent,
+			Approval: approval,
+			Risk:     m.assessRisk(r.PasteMultilineContent).Level.String(),
+		}
+		if !approval.Approved() {
+			m.audit(entry)
+			m.setState(StateIdle, "paste rejected")
+			return stepStop, ""
 		}
-	}
-
-	if r.RequestAccomplished {
-		m.Status = ""
-		return true
-	}
-
-	if r.WaitingForUserResponse {
-		m.Status = "waiting"
-		return false
-	}
 
-	// watch mode only
-	if r.NoComment {
-		return false
+		m.useSessionApprovals(approval, r.PasteMultilineContent)
+		m.Usage.Commands++
+		m.setState(StateExecuting, "pasting")
+		m.Println("Pasting...")
+		entry.Status = AuditStarted
+		m.audit(entry)
+		started := time.Now()
+		system.TmuxSendCommandToPane(m.ExecPane.Id, r.PasteMultilineContent, true)
+		time.Sleep(1 * time.Second)
+		entry.Status = AuditFinished
+		entry.DurationMs = time.Since(started).Milliseconds()
+		m.audit(entry)
 	}
 
-	if !m.WatchMode {
-		accomplished := m.ProcessUserMessage(ctx, "sending updated pane(s) content")
-		if accomplished {
-			return true
+	if r.ExecPaneSeemsBusy {
+		m.setState(StateWaitingForPane, "")
+		if !m.Countdown(ctx, m.GetWaitInterval()) {
+			return stepStop, ""
 		}
+		return stepContinue, "waited for 5 more seconds, here is the current pane(s) content"
 	}
-	return false
-}
 
-func (m *Manager) startWatchMode(desc string) {
-
-	// check status
-	if m.Status == "" {
-		return
+	if r.RequestAccomplished {
+		m.setState(StateDone, r.Message)
+		return stepAccomplished, ""
 	}
 
-	m.Countdown(m.GetWaitInterval())
-
-	// Create a new background context since this is a separate process
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	accomplished := m.ProcessUserMessage(ctx, desc)
-	if accomplished {
-		m.WatchMode = false
-		m.Status = ""
+	if r.WaitingForUserResponse {
+		m.setState(StateWaitingForUser, r.Message)
+		return stepStop, ""
 	}
 
-	// we continue running if status is still set
-	if m.Status != "" && m.WatchMode {
-		m.startWatchMode("")
-	}
+	return stepContinue, "sending updated pane(s) content"
 }
 
 func (m *Manager) aiFollowedGuidelines(r AIResponse) (string, bool) {
@@ -312,8 +367,8 @@ func (m *Manager) aiFollowedGuidelines(r AIResponse) (string, bool) {
 		return "You didn't follow the guidelines. You can only use one type of XML tag in your response. Pay attention!", false
 	}
 
-	// watch mode has no xml tags, otherwise should be at least 1 xml tag in response
-	if !m.WatchMode && count+boolCount == 0 {
+	// should be at least 1 xml tag in response
+	if count+boolCount == 0 {
 		return "You didn't follow the guidelines. You must use at least one XML tag in your response. Pay attention!", false
 	}
 
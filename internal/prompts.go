@@ -38,6 +38,9 @@ DO NOT WRITE MORE TEXT AFTER THE TOOL CALLS IN A RESPONSE. You can wait until th
 	if m.Config.Prompts.BaseSystem != "" {
 		basePrompt = m.Config.Prompts.BaseSystem
 	}
+	if context := strings.TrimSpace(m.Config.Context); context != "" {
+		basePrompt += "\n==== Context given by the user about their environment and project ====\n" + context + "\n"
+	}
 	return basePrompt
 
 }
@@ -145,11 +148,13 @@ I'll wait for it to complete before proceeding.
 	}
 }
 
-func (m *Manager) watchPrompt() ChatMessage {
+// watchPrompt is the system prompt of watchers, act adds the exec action of /watch --act
+func (m *Manager) watchPrompt(act bool) ChatMessage {
 	chatPrompt := fmt.Sprintf(`
 %s
 You are current in watch mode and assisting user by watching the pane content.
 Use your common sense to decide if when it's actually valuable and needed to respond for the given watch goal.
+You are only asked when the watched panes printed new output, it is included in <new_output> tags.
 
 If you respond:
 Provide your response based on the current pane content.
@@ -160,6 +165,15 @@ If no response is needed, output:
 
 `, m.baseSystemPrompt())
 
+	if act {
+		chatPrompt += `
+You may also act when the watch goal asks for it and the fix is obvious, e.g. restarting a crashed dev server or re-running a flaky test:
+<ExecCommand>: Use this to run one shell command in the watched pane the new output came from, once its shell prompt is back. Explain why in one short sentence before it.
+Only act when the watch goal asks for it. The user's whitelist restricts the commands and the user usually approves them first, you are told if a command ran or was refused.
+Never use <TmuxSendKeys> or <PasteMultilineContent> in watch mode.
+`
+	}
+
 	if m.Config.Prompts.Watch != "" {
 		chatPrompt = chatPrompt + "\n\n" + m.Config.Prompts.Watch
 	}
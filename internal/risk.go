@@ -0,0 +1,499 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/fatih/color"
+)
+
+// RiskLevel classifies what a command can do, from harmless to impossible to undo
+type RiskLevel int
+
+const (
+	RiskReadOnly RiskLevel = iota
+	RiskLocalWrite
+	RiskNetwork
+	RiskPrivileged
+	RiskDestructive
+	RiskIrreversible
+)
+
+var riskLevelNames = map[RiskLevel]string{
+	RiskReadOnly:     "read-only",
+	RiskLocalWrite:   "local write",
+	RiskNetwork:      "network/remote",
+	RiskPrivileged:   "privileged",
+	RiskDestructive:  "destructive",
+	RiskIrreversible: "irreversible",
+}
+
+func (l RiskLevel) String() string {
+	return riskLevelNames[l]
+}
+
+// Color returns the color used for the level in confirmation prompts
+func (l RiskLevel) Color() *color.Color {
+	switch l {
+	case RiskReadOnly:
+		return color.New(color.FgGreen)
+	case RiskLocalWrite:
+		return color.New(color.FgBlue)
+	case RiskNetwork:
+		return color.New(color.FgYellow)
+	case RiskPrivileged:
+		return color.New(color.FgMagenta)
+	case RiskDestructive:
+		return color.New(color.FgRed)
+	default:
+		return color.New(color.FgHiRed, color.Bold)
+	}
+}
+
+// RequiresTypedYes reports whether confirming needs a typed "yes" instead of Enter
+func (l RiskLevel) RequiresTypedYes() bool {
+	return l >= RiskDestructive
+}
+
+// parseRiskLevel accepts the level names used in risk_rules
+func parseRiskLevel(name string) (RiskLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "read-only", "readonly", "read_only":
+		return RiskReadOnly, true
+	case "local write", "local-write", "local_write", "write":
+		return RiskLocalWrite, true
+	case "network/remote", "network", "remote":
+		return RiskNetwork, true
+	case "privileged":
+		return RiskPrivileged, true
+	case "destructive":
+		return RiskDestructive, true
+	case "irreversible":
+		return RiskIrreversible, true
+	}
+	return RiskReadOnly, false
+}
+
+// riskRule matches the text of a simple command, e.g. "rm -rf build"
+type riskRule struct {
+	Level   RiskLevel
+	Pattern *regexp.Regexp
+	Explain string
+}
+
+// builtinRiskRules are all checked and the highest level matching decides a stage's level.
+// Patterns are matched against the program's basename and its arguments, and again for
+// the command run by wrappers such as sudo or xargs, see stageTexts.
+var builtinRiskRules = []riskRule{
+	// irreversible
+	{RiskIrreversible, regexp.MustCompile(`^(shred|wipefs|mkfs(\.\w+)?|fdisk|gdisk|sgdisk|parted)\b`), "erases disks or file systems"},
+	{RiskIrreversible, regexp.MustCompile(`^dd\b.*\bof=`), "writes raw data to a file or device"},
+	{RiskIrreversible, regexp.MustCompile(`(?i)\b(drop\s+(table|database|schema)|truncate\s+table)\b`), "drops database objects"},
+	{RiskIrreversible, regexp.MustCompile(`^git\s+push\b.*\s(--force\b|--force-with-lease\b|-f\b|\+)`), "force-pushes, rewriting remote history"},
+	{RiskIrreversible, regexp.MustCompile(`^(terraform|tofu)\s+destroy\b`), "destroys infrastructure"},
+
+	// destructive
+	{RiskDestructive, regexp.MustCompile(`^rm\s+(.*\s)?-\w*[rR]`), "deletes files and directories recursively"},
+	{RiskDestructive, regexp.MustCompile(`^(rm|rmdir|unlink)\b`), "deletes files"},
+	{RiskDestructive, regexp.MustCompile(`^find\b.*\s-delete\b`), "deletes the files it finds"},
+	{RiskDestructive, regexp.MustCompile(`^git\s+(reset\s+(.*\s)?--hard|clean\b|checkout\s+(.*\s)?--\s|restore\b|branch\s+-D|stash\s+(drop|clear))`), "discards git changes"},
+	{RiskDestructive, regexp.MustCompile(`^kubectl\s+delete\b`), "deletes Kubernetes resources"},
+	{RiskDestructive, regexp.MustCompile(`^helm\s+(uninstall|delete)\b`), "uninstalls a Helm release"},
+	{RiskDestructive, regexp.MustCompile(`^(docker|podman)\s+(rm|rmi|kill|system\s+prune|volume\s+(rm|prune)|image\s+(rm|prune)|container\s+(rm|prune))\b`), "removes containers, images or volumes"},
+	{RiskDestructive, regexp.MustCompile(`^(kill|pkill|killall)\b`), "terminates processes"},
+	{RiskDestructive, regexp.MustCompile(`(?i)\bdelete\s+from\b`), "deletes database rows"},
+
+	// privileged
+	{RiskPrivileged, regexp.MustCompile(`^(sudo|doas|su|pkexec|runas)\b`), "runs with elevated privileges"},
+	{RiskPrivileged, regexp.MustCompile(`^(chmod|chown|chgrp|setfacl)\b`), "changes permissions or ownership"},
+	{RiskPrivileged, regexp.MustCompile(`^(systemctl|service|launchctl)\s+(start|stop|restart|reload|enable|disable|mask|unmask)\b`), "changes system services"},
+	{RiskPrivileged, regexp.MustCompile(`^(useradd|usermod|userdel|groupadd|groupdel|passwd|visudo|iptables|nft|ufw|firewall-cmd|mount|umount|sysctl|modprobe|reboot|shutdown|poweroff|halt)\b`), "changes system configuration"},
+	{RiskPrivileged, regexp.MustCompile(`^(apt|apt-get|dpkg|dnf|yum|rpm|pacman|zypper|apk|brew|snap)\s+(-\S+\s+)*(install|remove|purge|upgrade|update|autoremove|-i|-S|-R)\b`), "changes installed system packages"},
+
+	// network/remote
+	{RiskNetwork, regexp.MustCompile(`^(ssh|scp|sftp|rsync|mosh|telnet|nc|ncat|netcat|socat)\b`), "connects to a remote host"},
+	{RiskNetwork, regexp.MustCompile(`^(curl|wget|http|https)\b`), "makes network requests"},
+	{RiskNetwork, regexp.MustCompile(`^git\s+(push|pull|fetch|clone)\b`), "talks to a git remote"},
+	{RiskNetwork, regexp.MustCompile(`^(kubectl|helm)\s+(apply|create|patch|edit|scale|rollout|exec|cp|set|label|annotate|install|upgrade|port-forward)\b`), "changes a Kubernetes cluster"},
+	{RiskNetwork, regexp.MustCompile(`^(docker|podman)\s+(push|pull|login)\b`), "talks to a container registry"},
+	{RiskNetwork, regexp.MustCompile(`^(npm|pnpm|yarn|pip\d*|gem|cargo|go)\s+(install|add|get)\b`), "downloads and installs packages"},
+
+	// read-only variants of tools which can also write
+	{RiskReadOnly, regexp.MustCompile(`^git\s+(status|log|diff|show|blame|rev-parse|ls-files|remote\s+-v|branch\s*$)`), "inspects the git repository"},
+	{RiskReadOnly, regexp.MustCompile(`^(kubectl|oc)\s+(get|describe|logs|top|explain|version|config\s+(view|current-context|get-contexts))\b`), "reads Kubernetes resources"},
+	{RiskReadOnly, regexp.MustCompile(`^(docker|podman)\s+(ps|images|logs|inspect|version|info|stats)\b`), "inspects containers"},
+
+	// local write
+	{RiskLocalWrite, regexp.MustCompile(`^sed\b.*\s(-i\S*|--in-place)\b`), "edits files in place"},
+	{RiskLocalWrite, regexp.MustCompile(`^(mv|cp|touch|mkdir|ln|tee|truncate|install|patch|tar|unzip)\b`), "creates or modifies files"},
+}
+
+// wrapperPrograms run the command given as their arguments. The value lists the options
+// taking a separate argument, which are skipped to find that command.
+var wrapperPrograms = map[string][]string{
+	"sudo":    {"-u", "-g", "-C", "-D", "-h", "-p", "-r", "-t", "-U", "-T"},
+	"doas":    {"-u", "-C"},
+	"env":     {"-u", "-C", "-S"},
+	"xargs":   {"-I", "-L", "-n", "-P", "-s", "-d", "-E", "-a"},
+	"command": nil,
+	"nohup":   nil,
+	"time":    {"-f", "-o"},
+	"nice":    {"-n"},
+	"exec":    {"-a"},
+	"timeout": {"-s", "-k", "--signal", "--kill-after"},
+	"setsid":  nil,
+	"stdbuf":  {"-i", "-o", "-e"},
+	"ionice":  {"-c", "-n", "-p", "-P", "-u"},
+	"chroot":  {"--userspec", "--groups"},
+}
+
+// wrapperOperands are the operands wrappers take before the command, e.g. the duration
+// of timeout and the new root of chroot
+var wrapperOperands = map[string]int{"timeout": 1, "chroot": 1}
+
+// shellPrograms run the script given with -c
+var shellPrograms = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true}
+
+// findExecActions are the find actions running the command which follows them up to ";" or "+"
+var findExecActions = []string{"-exec", "-execdir", "-ok", "-okdir"}
+
+// readOnlyPrograms are commands which only inspect state when no rule says otherwise
+var readOnlyPrograms = map[string]bool{
+	"ls": true, "cat": true, "less": true, "more": true, "head": true, "tail": true, "grep": true,
+	"egrep": true, "rg": true, "ag": true, "find": true, "fd": true, "stat": true, "file": true,
+	"tree": true, "pwd": true, "echo": true, "printf": true, "wc": true, "sort": true, "uniq": true,
+	"cut": true, "tr": true, "awk": true, "sed": true, "jq": true, "yq": true, "diff": true,
+	"ps": true, "top": true, "htop": true, "df": true, "du": true, "free": true, "uptime": true,
+	"whoami": true, "id": true, "hostname": true, "uname": true, "date": true, "env": true,
+	"printenv": true, "which": true, "type": true, "man": true, "history": true, "lsof": true,
+	"ss": true, "netstat": true, "ip": true, "dig": true, "nslookup": true, "true": true,
+	"false": true, "test": true, "[": true, "seq": true, "basename": true, "dirname": true,
+	"realpath": true, "readlink": true, "md5sum": true, "sha256sum": true, "column": true,
+	"xxd": true, "od": true, "strings": true, "nl": true, "tac": true, "rev": true, "cd": true,
+	"command": true,
+}
+
+// RiskAssessment is the classification shown when confirming a command
+type RiskAssessment struct {
+	Level   RiskLevel
+	Explain string // one line describing what the command will do
+	Unseen  string // why part of the command can not be classified, e.g. the script of sh -c "$CMD"
+}
+
+// assessRisk classifies every stage of command and returns the highest level found
+func (m *Manager) assessRisk(command string) RiskAssessment {
+	stages, err := parseCommandStages(command)
+	if err != nil || len(stages) == 0 {
+		// still classify the raw text so an unparsable command is not reported as harmless
+		fields := strings.Fields(command)
+		program := ""
+		if len(fields) > 0 {
+			program = fields[0]
+		}
+		stages = []commandStage{{Text: strings.TrimSpace(command), Program: program}}
+	}
+
+	configRules := m.configRiskRules()
+
+	assessment := RiskAssessment{Level: RiskReadOnly}
+	var explains []string
+	var programs []string
+	seen := map[string]bool{}
+	add := func(explain string) {
+		if !seen[explain] {
+			seen[explain] = true
+			explains = append(explains, explain)
+		}
+	}
+
+	// commands run by a stage, e.g. the script of sh -c, are classified as stages of their own
+	for len(stages) > 0 {
+		stage := stages[0]
+		level, explain, inner, unseen := classifyStage(stage, configRules, builtinRiskRules)
+		stages = append(stages[1:], inner...)
+		if unseen != "" && assessment.Unseen == "" {
+			assessment.Unseen = unseen
+		}
+		if level > assessment.Level {
+			assessment.Level = level
+		}
+		if explain != "" {
+			add(explain)
+		} else if stage.Program != "" && !seen["runs "+stage.Program] {
+			seen["runs "+stage.Program] = true
+			programs = append(programs, stage.Program)
+		}
+
+		for _, target := range stage.Writes {
+			switch {
+			case target == "/dev/null":
+			case strings.HasPrefix(target, "/dev/sd") || strings.HasPrefix(target, "/dev/nvme") || strings.HasPrefix(target, "/dev/disk"):
+				assessment.Level = RiskIrreversible
+				add("overwrites the block device " + target)
+			default:
+				if assessment.Level < RiskLocalWrite {
+					assessment.Level = RiskLocalWrite
+				}
+				if target == "" {
+					target = "a computed path"
+				}
+				add("writes to " + target)
+			}
+		}
+	}
+
+	if len(programs) > 0 {
+		explains = append([]string{"runs " + strings.Join(programs, ", ")}, explains...)
+	}
+	assessment.Explain = strings.Join(explains, "; ")
+	return assessment
+}
+
+// classifyStage returns the highest level of the builtin rules matching stage or the
+// command it wraps, see unwrapStage. Rules from risk_rules take precedence over the builtin
+// ones for the text they match. Stages without a matching rule are read-only for well
+// known inspection tools and local writes otherwise. It also returns the stages of the
+// commands stage runs, see innerStages, which the caller classifies on their own, and why
+// the command stage runs can not be seen, e.g. for a program chosen by an expansion.
+func classifyStage(stage commandStage, configRules, rules []riskRule) (RiskLevel, string, []commandStage, string) {
+	cmd := unwrapStage(stage)
+	level, explain, matched := RiskReadOnly, "", false
+	for _, text := range cmd.texts {
+		textLevel, textExplain, textMatched := matchRiskRules(text, configRules, true)
+		if !textMatched {
+			textLevel, textExplain, textMatched = matchRiskRules(text, rules, false)
+		}
+		if textMatched && (!matched || textLevel > level) {
+			level, explain = textLevel, textExplain
+		}
+		matched = matched || textMatched
+	}
+
+	inner, runs, unseen := innerStages(cmd)
+	if unseen != "" {
+		// what runs is only known when it runs, so assume the worst short of irreversible
+		if !matched || level < RiskDestructive {
+			level, explain = RiskDestructive, unseen
+		}
+		return level, explain, nil, unseen
+	}
+	if cmd.dynamic {
+		unseen = "runs a program only known when it runs"
+	}
+	if matched {
+		if explain == "" {
+			explain = "runs " + stage.Program
+		}
+		return level, explain, inner, unseen
+	}
+	if cmd.dynamic {
+		return RiskLocalWrite, unseen, nil, unseen
+	}
+	if cmd.program == "" || readOnlyPrograms[cmd.program] || runs {
+		return RiskReadOnly, "", inner, ""
+	}
+	return RiskLocalWrite, "", inner, ""
+}
+
+// matchRiskRules returns the level of the first rule matching text, or the highest level
+// of all the rules matching it
+func matchRiskRules(text string, rules []riskRule, first bool) (RiskLevel, string, bool) {
+	level, explain, matched := RiskReadOnly, "", false
+	for _, rule := range rules {
+		if !rule.Pattern.MatchString(text) {
+			continue
+		}
+		if first {
+			return rule.Level, rule.Explain, true
+		}
+		if !matched || rule.Level > level {
+			level, explain = rule.Level, rule.Explain
+		}
+		matched = true
+	}
+	return level, explain, matched
+}
+
+// wrappedCommand is the command a stage runs once wrapper programs are skipped
+type wrappedCommand struct {
+	texts    []string // the texts risk rules are matched against
+	program  string   // basename of the innermost program
+	args     []string // arguments of the innermost program
+	expanded []bool   // whether each of args depends on expansions
+	dynamic  bool     // the innermost program is chosen by an expansion
+}
+
+// unwrapStage returns the texts the risk rules are matched against: the stage with the
+// basename of its program, e.g. "rm -rf x" for "/bin/rm -rf x", and the commands run by
+// wrapper programs, e.g. "rm -rf x" for "sudo env rm -rf x". It also returns the innermost
+// program and its arguments.
+func unwrapStage(stage commandStage) wrappedCommand {
+	text := stage.Text
+	if len(stage.Assigns) > 0 && stage.Program != "" {
+		// match "FOO=1 rm -rf x" like "rm -rf x"
+		if i := strings.Index(text, stage.Program); i > 0 {
+			text = text[i:]
+		}
+	}
+	if stage.Program == "" {
+		return wrappedCommand{texts: []string{text}, dynamic: stage.Dynamic}
+	}
+	program := path.Base(stage.Program)
+	cmd := wrappedCommand{
+		texts:    []string{program + strings.TrimPrefix(text, stage.Program)},
+		program:  program,
+		args:     stage.Args,
+		expanded: stage.Expanded,
+	}
+
+	words := stage.Args
+	for options, ok := wrapperPrograms[program]; ok; options, ok = wrapperPrograms[program] {
+		i := 0
+		for i < len(words) {
+			word := words[i]
+			switch {
+			case program == "command" && (word == "-v" || word == "-V"):
+				// only looks the command up
+				return cmd
+			case word == "--":
+				i++
+			case slices.Contains(options, word):
+				i += 2
+				continue
+			case strings.HasPrefix(word, "-") && word != "-",
+				program == "env" && strings.Contains(word, "="),
+				program == "nice" && strings.HasPrefix(word, "+"):
+				i++
+				continue
+			}
+			break
+		}
+		i += wrapperOperands[program]
+		if i >= len(words) {
+			break
+		}
+		offset := len(stage.Args) - len(words) + i
+		program, words = path.Base(words[i]), words[i+1:]
+		cmd.texts = append(cmd.texts, strings.Join(append([]string{program}, words...), " "))
+		cmd.program, cmd.args, cmd.expanded = program, words, stage.Expanded[offset+1:]
+		if stage.Expanded[offset] {
+			cmd.program, cmd.dynamic = "", true
+			break
+		}
+	}
+	return cmd
+}
+
+// innerStages returns the stages of the commands cmd runs as its arguments: the script of
+// sh -c, the arguments of eval and watch, and the commands find runs with -exec and the
+// like. runs reports whether cmd is such a program. unseen explains why the command can
+// not be classified, e.g. because the script of sh -c is only known when it runs.
+func innerStages(cmd wrappedCommand) (stages []commandStage, runs bool, unseen string) {
+	script := func(words []string, expanded []bool) ([]commandStage, bool, string) {
+		if slices.Contains(expanded, true) {
+			return nil, true, "runs a command only known when it runs"
+		}
+		stages, err := parseCommandStages(strings.Join(words, " "))
+		if err != nil {
+			return nil, true, "runs a command which could not be parsed"
+		}
+		return stages, true, ""
+	}
+
+	args, expanded := cmd.args, cmd.expanded
+	switch {
+	case shellPrograms[cmd.program]:
+		withScript := false
+		i := 0
+		for ; i < len(args); i++ {
+			word := args[i]
+			if word == "--" {
+				i++
+				break
+			}
+			if !strings.HasPrefix(word, "-") && !strings.HasPrefix(word, "+") {
+				break
+			}
+			if word == "-o" || word == "+o" || word == "-O" || word == "+O" {
+				i++
+				continue
+			}
+			withScript = withScript || !strings.HasPrefix(word, "--") && strings.Contains(word, "c")
+		}
+		if !withScript || i >= len(args) {
+			return nil, false, ""
+		}
+		return script(args[i:i+1], expanded[i:i+1])
+	case cmd.program == "eval":
+		return script(args, expanded)
+	case cmd.program == "watch":
+		i := 0
+		for i < len(args) && strings.HasPrefix(args[i], "-") {
+			if args[i] == "-n" || args[i] == "--interval" {
+				i++
+			}
+			i++
+		}
+		if i >= len(args) {
+			return nil, false, ""
+		}
+		return script(args[i:], expanded[i:])
+	case cmd.program == "find":
+		for i := 0; i < len(args); i++ {
+			if !slices.Contains(findExecActions, args[i]) {
+				continue
+			}
+			runs = true
+			end := i + 1
+			for end < len(args) && args[end] != ";" && args[end] != `\;` && args[end] != "+" {
+				end++
+			}
+			if end > i+1 {
+				if expanded[i+1] {
+					return nil, true, "runs a program only known when it runs"
+				}
+				stages = append(stages, commandStage{
+					Text:     strings.Join(args[i+1:end], " "),
+					Program:  args[i+1],
+					Args:     args[i+2 : end],
+					Expanded: expanded[i+2 : end],
+				})
+			}
+			i = end
+		}
+		return stages, runs, ""
+	}
+	return nil, false, ""
+}
+
+// configRiskRules compiles the risk_rules from the config, skipping invalid entries
+func (m *Manager) configRiskRules() []riskRule {
+	var rules []riskRule
+	for _, r := range m.Config.RiskRules {
+		level, ok := parseRiskLevel(r.Level)
+		if !ok {
+			logger.Error("Ignoring risk rule '%s': unknown level '%s'", r.Pattern, r.Level)
+			continue
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			logger.Error("Ignoring risk rule '%s': %v", r.Pattern, err)
+			continue
+		}
+		rules = append(rules, riskRule{Level: level, Pattern: pattern, Explain: r.Explain})
+	}
+	return rules
+}
+
+// FormatRisk renders the assessment as the colored line shown above confirmations
+func (a RiskAssessment) FormatRisk() string {
+	label := a.Level.Color().Sprintf("[%s]", strings.ToUpper(a.Level.String()))
+	if a.Explain == "" {
+		return label
+	}
+	return fmt.Sprintf("%s %s", label, a.Explain)
+}
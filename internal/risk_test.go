@@ -0,0 +1,141 @@
+// Tests for command risk classification in risk.go
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestAssessRisk(t *testing.T) {
+	m := &Manager{Config: config.DefaultConfig()}
+
+	tests := []struct {
+		command string
+		level   RiskLevel
+		explain string
+	}{
+		{"ps aux | grep node", RiskReadOnly, "runs ps, grep"},
+		{"git status", RiskReadOnly, "inspects the git repository"},
+		{"ls > files.txt", RiskLocalWrite, "writes to files.txt"},
+		{"mkdir -p build", RiskLocalWrite, "creates or modifies files"},
+		{"curl -s https://example.com | jq .", RiskNetwork, "makes network requests"},
+		{"sudo apt-get install -y jq", RiskPrivileged, "runs with elevated privileges"},
+		{"rm -rf build", RiskDestructive, "deletes files and directories recursively"},
+		{"cd /tmp && rm -r x", RiskDestructive, "deletes files and directories recursively"},
+		{"kubectl delete pod api-0", RiskDestructive, "deletes Kubernetes resources"},
+		{"echo $(rm -rf x)", RiskDestructive, "deletes files"},
+		{`psql -c "DROP TABLE users"`, RiskIrreversible, "drops database objects"},
+		{"git push --force origin main", RiskIrreversible, "force-pushes"},
+		{"dd if=/dev/zero of=/dev/sda", RiskIrreversible, "writes raw data"},
+		{"some-unknown-tool", RiskLocalWrite, "runs some-unknown-tool"},
+		{"git commit -m wip", RiskLocalWrite, "runs git"},
+		{"git push -f origin main", RiskIrreversible, "force-pushes"},
+	}
+	for _, tt := range tests {
+		risk := m.assessRisk(tt.command)
+		if risk.Level != tt.level {
+			t.Errorf("%q: expected %s, got %s (%s)", tt.command, tt.level, risk.Level, risk.Explain)
+		}
+		if !strings.Contains(risk.Explain, tt.explain) {
+			t.Errorf("%q: expected explanation containing %q, got %q", tt.command, tt.explain, risk.Explain)
+		}
+	}
+}
+
+func TestAssessRisk_ConfigRules(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RiskRules = []config.RiskRule{
+		{Pattern: `^make\s+deploy\b`, Level: "irreversible", Explain: "deploys to production"},
+		{Pattern: `^rm\s+-rf\s+node_modules$`, Level: "local write"},
+		{Pattern: `^bad`, Level: "unknown"},
+	}
+	m := &Manager{Config: cfg}
+
+	if risk := m.assessRisk("make deploy"); risk.Level != RiskIrreversible || risk.Explain != "deploys to production" {
+		t.Errorf("expected custom irreversible rule, got %s (%s)", risk.Level, risk.Explain)
+	}
+	if risk := m.assessRisk("rm -rf node_modules"); risk.Level != RiskLocalWrite {
+		t.Errorf("expected custom rule to take precedence over built-ins, got %s", risk.Level)
+	}
+	if !RiskDestructive.RequiresTypedYes() || RiskPrivileged.RequiresTypedYes() {
+		t.Errorf("only destructive and irreversible commands should require a typed yes")
+	}
+}
+
+func TestAssessRisk_WrappersAndPaths(t *testing.T) {
+	m := &Manager{Config: config.DefaultConfig()}
+
+	tests := []struct {
+		command string
+		level   RiskLevel
+	}{
+		{"sudo rm -rf /", RiskDestructive},
+		{"sudo dd if=/dev/zero of=/dev/sda", RiskIrreversible},
+		{"sudo -u postgres psql -c 'DROP DATABASE app'", RiskIrreversible},
+		{"/bin/rm -rf ~", RiskDestructive},
+		{"xargs rm -rf < list", RiskDestructive},
+		{"xargs -0 -n 1 rm < list", RiskDestructive},
+		{"command rm -rf x", RiskDestructive},
+		{"env rm -rf x", RiskDestructive},
+		{"env -i FOO=1 /usr/bin/shred -u secret", RiskIrreversible},
+		{"nohup nice -n 10 rm -r logs", RiskDestructive},
+		{"time git push --force", RiskIrreversible},
+		{"exec kill 1", RiskDestructive},
+		{"doas -u root sh -c 'id'", RiskPrivileged},
+		{"command -v rm", RiskReadOnly},
+		{"env", RiskReadOnly},
+		{"time ls -la", RiskReadOnly},
+		{"/usr/bin/git status", RiskReadOnly},
+	}
+	for _, tt := range tests {
+		risk := m.assessRisk(tt.command)
+		if risk.Level != tt.level {
+			t.Errorf("%q: expected %s, got %s (%s)", tt.command, tt.level, risk.Level, risk.Explain)
+		}
+		if tt.level >= RiskDestructive && !risk.Level.RequiresTypedYes() {
+			t.Errorf("%q: expected a typed yes", tt.command)
+		}
+	}
+}
+
+func TestAssessRisk_InnerCommands(t *testing.T) {
+	m := &Manager{Config: config.DefaultConfig()}
+
+	tests := []struct {
+		command string
+		level   RiskLevel
+	}{
+		{"bash -c 'rm -rf ~'", RiskDestructive},
+		{`sh -c "rm -rf /"`, RiskDestructive},
+		{"bash -lc 'cd /tmp && git push --force'", RiskIrreversible},
+		{"zsh -o pipefail -c 'ls | wc -l'", RiskReadOnly},
+		{`dash -c "$CMD"`, RiskDestructive},
+		{"sudo bash -c 'rm -rf /var/log'", RiskDestructive},
+		{"bash script.sh", RiskLocalWrite},
+		{"eval rm -rf /", RiskDestructive},
+		{"eval echo hi", RiskReadOnly},
+		{`eval "$(ssh-agent)"`, RiskDestructive},
+		{"timeout 5 rm -rf /", RiskDestructive},
+		{"timeout -s KILL 5m ls", RiskReadOnly},
+		{"watch -n 5 'rm -rf build'", RiskDestructive},
+		{"watch -n 2 df -h", RiskReadOnly},
+		{"setsid -f rm -rf x", RiskDestructive},
+		{"stdbuf -oL -e 0 rm -rf x", RiskDestructive},
+		{"ionice -c 3 rm -rf x", RiskDestructive},
+		{"chroot --userspec=1000 /mnt rm -rf /", RiskDestructive},
+		{"find . -exec rm -rf {} +", RiskDestructive},
+		{`find . -name '*.tmp' -execdir rm {} \;`, RiskDestructive},
+		{"find / -delete", RiskDestructive},
+		{"find . -name '*.go' -exec grep -l TODO {} +", RiskReadOnly},
+		{`find . -exec "$TOOL" {} \;`, RiskDestructive},
+		{"find . -name '*.go'", RiskReadOnly},
+	}
+	for _, tt := range tests {
+		risk := m.assessRisk(tt.command)
+		if risk.Level != tt.level {
+			t.Errorf("%q: expected %s, got %s (%s)", tt.command, tt.level, risk.Level, risk.Explain)
+		}
+	}
+}
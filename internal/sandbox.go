@@ -0,0 +1,401 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// Sandbox is a restricted exec pane working on a scratch copy of the project directory
+type Sandbox struct {
+	ProjectDir string // the real directory, read-only inside the sandbox
+	ScratchDir string // writable copy mounted over ProjectDir inside the sandbox
+	Backend    string
+	Network    bool
+	PaneId     string
+
+	// the files of both directories when the sandbox started or was last applied, Apply
+	// only copies what the sandbox changed since and refuses what was also changed outside
+	projectFiles map[string]fileState
+	scratchFiles map[string]fileState
+}
+
+// fileState is what tells whether a file changed, by path relative to the directory
+type fileState struct {
+	Mode    fs.FileMode
+	Size    int64
+	ModTime time.Time
+	Link    string // target of symlinks
+}
+
+// startSandbox copies the project to a scratch directory and spawns the sandboxed exec pane
+func (m *Manager) startSandbox() error {
+	cfg := m.Config.Sandbox
+
+	backend := cfg.Backend
+	if backend == "" {
+		for _, candidate := range []string{"bwrap", "unshare"} {
+			if _, err := exec.LookPath(candidate); err == nil {
+				backend = candidate
+				break
+			}
+		}
+	}
+	if backend != "bwrap" && backend != "unshare" {
+		return fmt.Errorf("no sandbox backend available, install bubblewrap or util-linux unshare")
+	}
+	if _, err := exec.LookPath(backend); err != nil {
+		return fmt.Errorf("sandbox backend %s not found: %w", backend, err)
+	}
+
+	projectDir := cfg.Dir
+	if projectDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+		projectDir = wd
+	}
+	projectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return fmt.Errorf("invalid sandbox directory: %w", err)
+	}
+
+	scratchDir, err := os.MkdirTemp("", "tmuxai-sandbox-")
+	if err != nil {
+		return fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	sandbox := &Sandbox{
+		ProjectDir: projectDir,
+		ScratchDir: scratchDir,
+		Backend:    backend,
+		Network:    cfg.Network,
+	}
+	// the project is scanned before copying it, so edits made meanwhile are conflicts
+	if sandbox.projectFiles, err = scanFiles(projectDir); err != nil {
+		os.RemoveAll(scratchDir)
+		return err
+	}
+	if out, err := exec.Command("cp", "-a", projectDir+"/.", scratchDir).CombinedOutput(); err != nil {
+		os.RemoveAll(scratchDir)
+		return fmt.Errorf("failed to copy %s to scratch directory: %v: %s", projectDir, err, out)
+	}
+	if sandbox.scratchFiles, err = scanFiles(scratchDir); err != nil {
+		os.RemoveAll(scratchDir)
+		return err
+	}
+
+	m.Sandbox = sandbox
+	logger.Info("Sandbox scratch copy of %s created at %s", projectDir, scratchDir)
+	return m.spawnSandboxPane()
+}
+
+// spawnSandboxPane opens a new pane running the user's shell inside the sandbox
+func (m *Manager) spawnSandboxPane() error {
+	paneId, err := system.TmuxCreateNewPaneWithCommand(m.PaneId, m.Sandbox.ProjectDir, m.Sandbox.command())
+	if err != nil {
+		return fmt.Errorf("failed to start sandbox pane: %w", err)
+	}
+	m.Sandbox.PaneId = paneId
+	logger.Info("Sandbox pane %s started with %s", paneId, m.Sandbox.Backend)
+	return nil
+}
+
+// command builds the argv starting a shell inside the sandbox
+func (s *Sandbox) command() []string {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	switch s.Backend {
+	case "bwrap":
+		args := []string{"bwrap",
+			"--ro-bind", "/", "/",
+			"--dev", "/dev",
+			"--proc", "/proc",
+			"--tmpfs", "/tmp",
+			"--bind", s.ScratchDir, s.ProjectDir,
+			"--chdir", s.ProjectDir,
+			"--unshare-pid", "--unshare-ipc", "--unshare-uts",
+			"--die-with-parent",
+			"--setenv", "TMUXAI_SANDBOX", "1",
+		}
+		if !s.Network {
+			args = append(args, "--unshare-net")
+		}
+		return append(args, shell)
+	default:
+		// unshare has no read-only root option, so remount it after binding the scratch copy.
+		// Other mount points (e.g. a separate /home) stay writable with this backend.
+		args := []string{"unshare", "--user", "--map-root-user", "--mount", "--pid", "--fork"}
+		if !s.Network {
+			args = append(args, "--net")
+		}
+		script := `mount --bind "$1" "$2" && mount -o remount,bind,ro / && cd "$2" && TMUXAI_SANDBOX=1 exec "$3"`
+		return append(args, "sh", "-c", script, "sh", s.ScratchDir, s.ProjectDir, shell)
+	}
+}
+
+// Changes returns the paths, relative to the project, which the sandbox created, modified
+// or deleted since it started or was last applied, sorted
+func (s *Sandbox) Changes() ([]string, error) {
+	scratch, err := scanFiles(s.ScratchDir)
+	if err != nil {
+		return nil, err
+	}
+	return changedFiles(s.scratchFiles, scratch), nil
+}
+
+// Diff returns a unified diff of the changes of the sandbox against the real project
+func (s *Sandbox) Diff() (string, error) {
+	changes, err := s.Changes()
+	if err != nil {
+		return "", err
+	}
+	var diff strings.Builder
+	for _, rel := range changes {
+		project, scratch := filepath.Join(s.ProjectDir, rel), filepath.Join(s.ScratchDir, rel)
+		if isDir(project) || isDir(scratch) {
+			continue // the files inside are changes of their own
+		}
+		cmd := exec.Command("diff", "-uN", "--no-dereference", project, scratch)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		// diff exits with 1 when files differ
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			err = nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("diff failed: %v: %s", err, stderr.String())
+		}
+		diff.WriteString(stdout.String())
+	}
+	return strings.ReplaceAll(diff.String(), s.ScratchDir, s.ProjectDir+" (sandbox)"), nil
+}
+
+// Apply copies the files the sandbox changed to the project and removes the ones it
+// deleted. Nothing is applied when one of them also changed in the project since the
+// sandbox started, so edits and new files of the user are never overwritten nor deleted.
+func (s *Sandbox) Apply() error {
+	changes, err := s.Changes()
+	if err != nil {
+		return err
+	}
+	project, err := scanFiles(s.ProjectDir)
+	if err != nil {
+		return err
+	}
+	userChanges := changedFiles(s.projectFiles, project)
+	var conflicts []string
+	for _, rel := range changes {
+		for _, changed := range userChanges {
+			// a directory the sandbox deleted must not hold files the user changed
+			if changed == rel || strings.HasPrefix(changed, rel+"/") {
+				conflicts = append(conflicts, changed)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		slices.Sort(conflicts)
+		return fmt.Errorf("%s also changed in %s since the sandbox started, nothing was applied", strings.Join(slices.Compact(conflicts), ", "), s.ProjectDir)
+	}
+
+	scratch, err := scanFiles(s.ScratchDir)
+	if err != nil {
+		return err
+	}
+	var deleted []string
+	for _, rel := range changes {
+		src, dst := filepath.Join(s.ScratchDir, rel), filepath.Join(s.ProjectDir, rel)
+		state, exists := scratch[rel]
+		if !exists {
+			deleted = append(deleted, dst)
+			continue
+		}
+		if err := applyFile(src, dst, state); err != nil {
+			return err
+		}
+	}
+	// children are sorted after their directories, remove them first
+	slices.Reverse(deleted)
+	for _, path := range deleted {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	if s.projectFiles, err = scanFiles(s.ProjectDir); err != nil {
+		return err
+	}
+	s.scratchFiles = scratch
+	return nil
+}
+
+// applyFile copies the file, symlink or directory src described by state to dst
+func applyFile(src, dst string, state fileState) error {
+	if current, err := os.Lstat(dst); err == nil && (current.IsDir() != state.Mode.IsDir() || state.Mode&fs.ModeSymlink != 0) {
+		if err := os.RemoveAll(dst); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", dst, err)
+		}
+	}
+	switch {
+	case state.Mode.IsDir():
+		if err := os.MkdirAll(dst, state.Mode.Perm()); err != nil {
+			return err
+		}
+		return os.Chmod(dst, state.Mode.Perm())
+	case state.Mode&fs.ModeSymlink != 0:
+		return os.Symlink(state.Link, dst)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, data, state.Mode.Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return os.Chmod(dst, state.Mode.Perm())
+}
+
+// scanFiles returns the state of every file and directory under dir
+func scanFiles(dir string) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		state := fileState{Mode: info.Mode()}
+		switch {
+		case info.IsDir():
+			// entries added or removed change the directory, they are compared on their own
+		case info.Mode()&fs.ModeSymlink != 0:
+			state.Link, _ = os.Readlink(path)
+		default:
+			state.Size, state.ModTime = info.Size(), info.ModTime()
+		}
+		files[filepath.ToSlash(rel)] = state
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// changedFiles returns the sorted paths created, modified or deleted between before and after
+func changedFiles(before, after map[string]fileState) []string {
+	var changed []string
+	for rel, state := range after {
+		if previous, ok := before[rel]; !ok || !previous.ModTime.Equal(state.ModTime) || previous.Mode != state.Mode ||
+			previous.Size != state.Size || previous.Link != state.Link {
+			changed = append(changed, rel)
+		}
+	}
+	for rel := range before {
+		if _, ok := after[rel]; !ok {
+			changed = append(changed, rel)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+func isDir(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
+}
+
+// syncDir makes dst an exact copy of src, removing files which only exist in dst
+func syncDir(src, dst string) error {
+	if out, err := exec.Command("cp", "-a", src+"/.", dst).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %v: %s", src, dst, err, out)
+	}
+
+	var removed []string
+	err := filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dst, path)
+		if _, statErr := os.Lstat(filepath.Join(src, rel)); os.IsNotExist(statErr) {
+			removed = append(removed, path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", dst, err)
+	}
+	for _, path := range removed {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// reviewSandbox shows the sandbox changes and asks whether to apply them to the real directory
+func (m *Manager) reviewSandbox() {
+	if m.Sandbox == nil {
+		return
+	}
+	if changes, err := m.Sandbox.Changes(); err == nil && len(changes) == 0 {
+		m.Println("Sandbox has no changes")
+		return
+	}
+	diff, err := m.Sandbox.Diff()
+	if err != nil {
+		m.Println("Failed to diff sandbox: " + err.Error())
+		return
+	}
+
+	code, _ := system.HighlightCode("diff", diff)
+	fmt.Println(code)
+
+	if !m.confirmYesNo("Apply sandbox changes to " + m.Sandbox.ProjectDir + "?") {
+		m.Println("Sandbox changes kept in " + m.Sandbox.ScratchDir)
+		return
+	}
+	if err := m.Sandbox.Apply(); err != nil {
+		m.Println("Failed to apply sandbox changes: " + err.Error())
+		return
+	}
+	logger.Info("Applied sandbox changes to %s", m.Sandbox.ProjectDir)
+	m.Println("Sandbox changes applied")
+}
+
+// stopSandbox closes the sandbox pane and removes the scratch copy unless it has unapplied changes
+func (m *Manager) stopSandbox() {
+	if m.Sandbox == nil {
+		return
+	}
+	system.TmuxKillPane(m.Sandbox.PaneId)
+
+	if changes, err := m.Sandbox.Changes(); err == nil && len(changes) == 0 {
+		os.RemoveAll(m.Sandbox.ScratchDir)
+		return
+	}
+	logger.Info("Sandbox has unapplied changes, keeping %s", m.Sandbox.ScratchDir)
+}
@@ -0,0 +1,108 @@
+// Tests for applying sandbox changes in sandbox.go
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startTestSandbox copies project to a scratch directory like startSandbox, without a pane
+func startTestSandbox(t *testing.T, project string) *Sandbox {
+	t.Helper()
+	s := &Sandbox{ProjectDir: project, ScratchDir: t.TempDir()}
+	var err error
+	if s.projectFiles, err = scanFiles(project); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("cp", "-a", project+"/.", s.ScratchDir).CombinedOutput(); err != nil {
+		t.Fatalf("cp: %v: %s", err, out)
+	}
+	if s.scratchFiles, err = scanFiles(s.ScratchDir); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func writeSandboxFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSandbox_DiffAndApply(t *testing.T) {
+	project := t.TempDir()
+	writeSandboxFile(t, project, "keep.txt", "same\n")
+	writeSandboxFile(t, project, "edit.txt", "old\n")
+	writeSandboxFile(t, project, "gone/file.txt", "bye\n")
+	s := startTestSandbox(t, project)
+
+	writeSandboxFile(t, s.ScratchDir, "edit.txt", "new content\n")
+	writeSandboxFile(t, s.ScratchDir, "added.txt", "hello\n")
+	os.RemoveAll(filepath.Join(s.ScratchDir, "gone"))
+	// the user keeps working in the real project meanwhile
+	writeSandboxFile(t, project, "mine.txt", "user file\n")
+	writeSandboxFile(t, project, "keep.txt", "edited by the user\n")
+
+	diff, err := s.Diff()
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	for _, want := range []string{"+new content", "-old", "+hello", "-bye"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff missing %q:\n%s", want, diff)
+		}
+	}
+	if strings.Contains(diff, "mine.txt") || strings.Contains(diff, "keep.txt") {
+		t.Errorf("diff should only show the changes of the sandbox:\n%s", diff)
+	}
+
+	if err := s.Apply(); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	for name, want := range map[string]string{"edit.txt": "new content\n", "added.txt": "hello\n", "mine.txt": "user file\n", "keep.txt": "edited by the user\n"} {
+		if got, _ := os.ReadFile(filepath.Join(project, name)); string(got) != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(project, "gone")); !os.IsNotExist(err) {
+		t.Errorf("deleted directory still exists")
+	}
+	if changes, _ := s.Changes(); len(changes) != 0 {
+		t.Errorf("expected no changes after apply, got %v", changes)
+	}
+}
+
+func TestSandbox_ApplyRefusesConflicts(t *testing.T) {
+	project := t.TempDir()
+	writeSandboxFile(t, project, "main.go", "package main\n")
+	writeSandboxFile(t, project, "old/keep.go", "package old\n")
+	s := startTestSandbox(t, project)
+
+	writeSandboxFile(t, s.ScratchDir, "main.go", "package main // sandbox\n")
+	writeSandboxFile(t, s.ScratchDir, "added.go", "package main\n")
+	os.RemoveAll(filepath.Join(s.ScratchDir, "old"))
+	writeSandboxFile(t, project, "main.go", "package main // edited by the user\n")
+	writeSandboxFile(t, project, "old/new.go", "package old\n")
+
+	err := s.Apply()
+	if err == nil || !strings.Contains(err.Error(), "main.go") || !strings.Contains(err.Error(), "old/new.go") {
+		t.Fatalf("expected the conflicts to be refused, got %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(project, "main.go")); string(got) != "package main // edited by the user\n" {
+		t.Errorf("the edit of the user was overwritten: %q", got)
+	}
+	for _, name := range []string{"old/new.go", "old/keep.go"} {
+		if _, err := os.Stat(filepath.Join(project, name)); err != nil {
+			t.Errorf("%s should be kept: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(project, "added.go")); !os.IsNotExist(err) {
+		t.Error("nothing should be applied when there are conflicts")
+	}
+}
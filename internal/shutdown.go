@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+)
+
+// sessionFile is the on-disk representation of a finished TmuxAI session
+type sessionFile struct {
+	Id          string               `json:"id"`
+	StartedAt   time.Time            `json:"started_at"`
+	EndedAt     time.Time            `json:"ended_at"`
+	ExecPaneId  string               `json:"exec_pane_id"`
+	Messages    []sessionMessage     `json:"messages"`
+	ExecHistory []CommandExecHistory `json:"exec_history"`
+}
+
+type sessionMessage struct {
+	Content     string    `json:"content"`
+	FromUser    bool      `json:"from_user"`
+	Timestamp   time.Time `json:"timestamp"`
+	Attachments []string  `json:"attachments,omitempty"` // names only, files may hold secrets
+}
+
+// Shutdown stops the watchers, restores the exec pane prompt (or closes the sandbox
+// pane), writes the session to disk and closes the logger. It is safe to call more
+// than once.
+func (m *Manager) Shutdown() {
+	m.shutdownOnce.Do(func() {
+		logger.Info("Shutting down session %s", m.SessionId)
+
+		m.Cancel()
+		m.stopWatchers()
+
+		if m.Sandbox != nil {
+			m.stopSandbox()
+		} else if m.UnprepareExecPane() {
+			logger.Info("Exec pane %s restored", m.ExecPane.Id)
+		}
+
+		m.removeCheckpoints()
+
+		if err := m.saveSession(); err != nil {
+			logger.Error("Failed to save session: %v", err)
+		}
+
+		m.notifying.Wait()
+
+		logger.Close()
+	})
+}
+
+// saveSession writes chat messages and exec history to ~/.config/tmuxai/sessions/<id>.json
+func (m *Manager) saveSession() error {
+	if len(m.Messages) == 0 && len(m.ExecHistory) == 0 {
+		return nil
+	}
+
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return err
+	}
+	sessionsDir := filepath.Join(configDir, "sessions")
+	if err := os.MkdirAll(sessionsDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	session := sessionFile{
+		Id:          m.SessionId,
+		StartedAt:   m.StartedAt,
+		EndedAt:     time.Now(),
+		ExecPaneId:  m.ExecPane.Id,
+		ExecHistory: m.ExecHistory,
+	}
+	for _, msg := range m.Messages {
+		session.Messages = append(session.Messages, sessionMessage{
+			Content:     msg.Content,
+			FromUser:    msg.FromUser,
+			Timestamp:   msg.Timestamp,
+			Attachments: msg.attachmentNames(),
+		})
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	path := filepath.Join(sessionsDir, m.SessionId+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	logger.Info("Session saved to %s", path)
+	return nil
+}
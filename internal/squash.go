@@ -15,7 +15,7 @@ import (
 func (m *Manager) needSquash() bool {
 	totalTokens := 0
 	for _, msg := range m.Messages {
-		totalTokens += system.EstimateTokenCount(msg.Content)
+		totalTokens += system.EstimateTokenCount(msg.text())
 	}
 
 	threshold := int(float64(m.GetMaxContextSize()) * 0.8)
@@ -102,12 +102,16 @@ func (m *Manager) summarizeChatHistory(messages []ChatMessage) (string, error) {
 			role = "User"
 		}
 
+		// attached files are only named, their content would crowd out the conversation
+		if names := msg.attachmentNames(); len(names) > 0 {
+			chatLog.WriteString(fmt.Sprintf("[%s attached files, content omitted]: %s\n", role, strings.Join(names, ", ")))
+		}
 		chatLog.WriteString(fmt.Sprintf("[%s]: %s\n\n", role, msg.Content))
 	}
 
 	// Create a summarization prompt
 	summarizationPrompt := fmt.Sprintf(
-		"Below is a chat history between a user and an assistant. Please provide a concise summary of the key points, decisions, and context from this conversation. Focus on the most important information that would be needed to continue the conversation effectively:\n\n%s",
+		"Below is a chat history between a user and an assistant. Please provide a concise summary of the key points, decisions, and context from this conversation. Focus on the most important information that would be needed to continue the conversation effectively. Mention the names of attached files, the user can attach them again with /attach:\n\n%s",
 		chatLog.String(),
 	)
 
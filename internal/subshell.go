@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// probeMarker returns the marker starting the line printed by a probe, with a nonce so
+// that neither older probes nor output of programs in the pane can pass for its answer
+func probeMarker(nonce string) string {
+	return "__TMUXAI_PROBE_" + nonce + "__"
+}
+
+// newProbeNonce returns a random nonce for probeMarker
+func newProbeNonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// subShellProbe holds what we learned about the shell running inside ssh, docker, etc.
+type subShellProbe struct {
+	Args        string // CurrentCommandArgs of the pane when probed, used to detect a new session
+	Shell       string
+	User        string
+	Host        string
+	OS          string
+	ContainerId string
+}
+
+// subShellProbeCommands print the marker of a nonce followed by the shell, user, host and
+// OS. %[1]s is the nonce, split from the rest of the marker so the echoed command line
+// never matches.
+var subShellProbeCommands = []string{
+	// POSIX shells (bash, zsh, dash, ksh, ...)
+	`echo "__TMUXAI_PROBE_""%[1]s__|$0|$(id -un)|$(hostname)|$(uname -srm)"`,
+	// fish does not support $0
+	`echo "__TMUXAI_PROBE_""%[1]s__|fish|"(id -un)"|"(hostname)"|"(uname -srm)`,
+}
+
+// valueFlags lists flags of container tools that consume the following argument
+var valueFlags = map[string]bool{
+	"-e": true, "--env": true, "--env-file": true, "-u": true, "--user": true,
+	"-w": true, "--workdir": true, "--detach-keys": true, "-n": true, "--namespace": true,
+	"-c": true, "--container": true, "--context": true, "--kubeconfig": true,
+	"-f": true, "--filename": true, "--pod-running-timeout": true, "--group": true,
+	"--cwd": true, "--mode": true, "--project": true,
+}
+
+// probeSubShell asks the shell inside the exec pane's subshell who and where it is.
+func (m *Manager) probeSubShell(pane *system.TmuxPaneDetails) (subShellProbe, error) {
+	for _, probe := range subShellProbeCommands {
+		nonce := newProbeNonce()
+		system.TmuxSendCommandToPane(pane.Id, fmt.Sprintf(probe, nonce), true)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			time.Sleep(300 * time.Millisecond)
+			content, _ := system.TmuxCapturePane(pane.Id, m.GetMaxCaptureLines())
+			if result, ok := parseProbeOutput(content, nonce); ok {
+				result.Args = pane.CurrentCommandArgs
+				result.ContainerId = containerIdFromArgs(pane.CurrentCommand, pane.CurrentCommandArgs)
+				if result.ContainerId == "" && (pane.CurrentCommand == "docker" || pane.CurrentCommand == "podman") {
+					// containers use their short id as hostname by default
+					result.ContainerId = result.Host
+				}
+				logger.Info("Probed subshell in pane %s: %+v", pane.Id, result)
+				return result, nil
+			}
+		}
+	}
+	return subShellProbe{}, fmt.Errorf("no probe response from pane %s", pane.Id)
+}
+
+// parseProbeOutput finds the line of the probe with nonce in the pane content
+func parseProbeOutput(content string, nonce string) (subShellProbe, bool) {
+	marker := probeMarker(nonce) + "|"
+	lines := strings.Split(content, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, marker) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, marker), "|", 4)
+		if len(parts) < 4 {
+			return subShellProbe{}, false
+		}
+		shell := filepath.Base(strings.TrimPrefix(parts[0], "-"))
+		return subShellProbe{
+			Shell: shell,
+			User:  parts[1],
+			Host:  parts[2],
+			OS:    parts[3],
+		}, true
+	}
+	return subShellProbe{}, false
+}
+
+// containerIdFromArgs extracts the container or pod name from exec style command lines
+// such as "docker exec -it web bash" or "kubectl exec -n prod api -- sh".
+func containerIdFromArgs(command, args string) string {
+	fields := strings.Fields(args)
+	start := -1
+	for i, f := range fields {
+		if f == "exec" || f == "enter" || f == "attach" {
+			start = i + 1
+			break
+		}
+	}
+	if start == -1 {
+		return ""
+	}
+
+	namespace := ""
+	for i := start; i < len(fields); i++ {
+		f := fields[i]
+		if f == "--" {
+			return ""
+		}
+		if strings.HasPrefix(f, "-") {
+			if (f == "-n" || f == "--namespace") && i+1 < len(fields) {
+				namespace = fields[i+1]
+			}
+			if valueFlags[f] {
+				i++
+			}
+			continue
+		}
+		if command == "kubectl" && namespace != "" {
+			return namespace + "/" + f
+		}
+		return f
+	}
+	return ""
+}
+
+// applySubShellDetails copies probed details onto pane, dropping stale probes
+func (m *Manager) applySubShellDetails(pane *system.TmuxPaneDetails) {
+	probe, ok := m.SubShells[pane.Id]
+	if !ok {
+		return
+	}
+	if !pane.IsSubShell || probe.Args != pane.CurrentCommandArgs {
+		// user left the subshell or opened a different one
+		delete(m.SubShells, pane.Id)
+		return
+	}
+	pane.Shell = probe.Shell
+	pane.OS = probe.OS
+	pane.RemoteHost = probe.Host
+	pane.RemoteUser = probe.User
+	pane.ContainerId = probe.ContainerId
+}
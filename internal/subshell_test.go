@@ -0,0 +1,49 @@
+// Tests for subshell probing helpers in subshell.go
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestContainerIdFromArgs(t *testing.T) {
+	tests := []struct {
+		command, args, want string
+	}{
+		{"docker", "docker exec -it -u root web bash", "web"},
+		{"podman", "podman exec --env FOO=bar -it db sh", "db"},
+		{"kubectl", "kubectl exec -it -n prod api-7d9c -- sh", "prod/api-7d9c"},
+		{"kubectl", "kubectl exec api -c app -- bash", "api"},
+		{"lxc", "lxc exec ubuntu -- bash", "ubuntu"},
+		{"ssh", "ssh deploy@example.com", ""},
+		{"docker", "docker run -it alpine sh", ""},
+	}
+	for _, tt := range tests {
+		if got := containerIdFromArgs(tt.command, tt.args); got != tt.want {
+			t.Errorf("containerIdFromArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	nonce := newProbeNonce()
+	content := "user@host:~$ " + fmt.Sprintf(subShellProbeCommands[0], nonce) + "\n" +
+		"__TMUXAI_PROBE_" + nonce + "__|-bash|deploy|web-1|Linux 6.1.0 x86_64\n" +
+		"deploy@web-1:~$"
+	got, ok := parseProbeOutput(content, nonce)
+	if !ok {
+		t.Fatal("probe line not found")
+	}
+	want := subShellProbe{Shell: "bash", User: "deploy", Host: "web-1", OS: "Linux 6.1.0 x86_64"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, ok := parseProbeOutput("user@host:~$ "+fmt.Sprintf(subShellProbeCommands[1], nonce), nonce); ok {
+		t.Error("echoed probe command must not match")
+	}
+	// a line printed by an earlier probe, or forged by a program in the pane
+	if _, ok := parseProbeOutput(content, newProbeNonce()); ok {
+		t.Error("only the line of the probe's own nonce may match")
+	}
+}
@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"gopkg.in/yaml.v3"
+)
+
+// Task is a saved request from the task library: a text/template with optional YAML
+// front-matter between --- lines
+type Task struct {
+	Name        string            `yaml:"-"` // file name without extension
+	Path        string            `yaml:"-"`
+	Source      string            `yaml:"-"` // "user" or "project"
+	Description string            `yaml:"description"`
+	Vars        []string          `yaml:"vars"`     // required variables
+	Defaults    map[string]string `yaml:"defaults"` // optional variables
+	Model       string            `yaml:"model"`    // preferred model
+	Approve     string            `yaml:"approve"`  // approval policy of headless runs: none, policy or all
+	Body        string            `yaml:"-"`
+}
+
+// taskDirs returns the task directories, later ones override tasks of the same name:
+// ~/.config/tmuxai/tasks and the nearest .tmuxai/tasks in dir or above
+func taskDirs(dir string) map[string]string {
+	dirs := make(map[string]string)
+	if configDir, err := config.GetConfigDir(); err == nil {
+		dirs["user"] = filepath.Join(configDir, "tasks")
+	}
+	for dir != "" {
+		project := filepath.Join(dir, ".tmuxai", "tasks")
+		if info, err := os.Stat(project); err == nil && info.IsDir() {
+			dirs["project"] = project
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return dirs
+}
+
+// LoadTasks returns the tasks of the user and of the project containing dir, sorted by name.
+// Project tasks override user tasks of the same name.
+func LoadTasks(dir string) ([]Task, error) {
+	dirs := taskDirs(dir)
+	byName := make(map[string]Task)
+	for _, source := range []string{"user", "project"} {
+		if dirs[source] == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dirs[source])
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			task, err := loadTask(filepath.Join(dirs[source], entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			task.Source = source
+			if source == "project" {
+				task.restrict()
+			}
+			byName[task.Name] = task
+		}
+	}
+
+	tasks := make([]Task, 0, len(byName))
+	for _, task := range byName {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks, nil
+}
+
+// FindTask returns the task called name, see LoadTasks
+func FindTask(name string, dir string) (Task, error) {
+	tasks, err := LoadTasks(dir)
+	if err != nil {
+		return Task{}, err
+	}
+	for _, task := range tasks {
+		if task.Name == name {
+			return task, nil
+		}
+	}
+	return Task{}, fmt.Errorf("no task %q in ~/.config/tmuxai/tasks or .tmuxai/tasks", name)
+}
+
+// loadTask reads the task at path and parses its front-matter
+func loadTask(path string) (Task, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Task{}, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	task := Task{Name: name, Path: path, Body: string(data)}
+
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(content, "---\n"); ok {
+		front, body, found := strings.Cut(rest, "\n---\n")
+		if !found {
+			front, found = strings.CutSuffix(rest, "\n---")
+		}
+		if !found {
+			return Task{}, fmt.Errorf("task %s: front-matter is not closed with ---", path)
+		}
+		if err := yaml.Unmarshal([]byte(front), &task); err != nil {
+			return Task{}, fmt.Errorf("task %s: %w", path, err)
+		}
+		task.Body = body
+	}
+	if task.Approve != "" {
+		if _, err := ParseHeadlessApprove(task.Approve); err != nil {
+			return Task{}, fmt.Errorf("task %s: %w", path, err)
+		}
+	}
+	if _, err := task.template(); err != nil {
+		return Task{}, fmt.Errorf("task %s: %w", path, err)
+	}
+	return task, nil
+}
+
+// restrict drops what a project task may not choose, as project tasks come with the
+// repositories you clone: its model, and an approval policy above policy
+func (t *Task) restrict() {
+	if t.Model != "" {
+		logger.Info("Task %s: model %s is ignored, only user tasks choose the model", t.Path, t.Model)
+		t.Model = ""
+	}
+	if t.Approve == string(HeadlessApproveAll) {
+		logger.Info("Task %s: approve all is capped at policy, only user tasks approve all", t.Path)
+		t.Approve = string(HeadlessApprovePolicy)
+	}
+}
+
+func (t Task) template() (*template.Template, error) {
+	return template.New(t.Name).Option("missingkey=error").Parse(t.Body)
+}
+
+// Render fills in the template of t with its defaults and vars
+func (t Task) Render(vars map[string]string) (string, error) {
+	data := make(map[string]string)
+	for k, v := range t.Defaults {
+		data[k] = v
+	}
+	for k, v := range vars {
+		data[k] = v
+	}
+	var missing []string
+	for _, name := range t.Vars {
+		if _, ok := data[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("task %s needs the variables %s", t.Name, strings.Join(missing, ", "))
+	}
+
+	tmpl, err := t.template()
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("task %s: %w", t.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// RenderTaskFile renders the task at path with its defaults, for -f/--file. Its model and
+// approval policy are not used.
+func RenderTaskFile(path string) (string, error) {
+	task, err := loadTask(path)
+	if err != nil {
+		return "", err
+	}
+	return task.Render(nil)
+}
+
+// VarNames returns the required and optional variables of t
+func (t Task) VarNames() []string {
+	names := slices.Clone(t.Vars)
+	for name := range t.Defaults {
+		if !slices.Contains(names, name) {
+			names = append(names, name+"?")
+		}
+	}
+	sort.Strings(names[len(t.Vars):])
+	return names
+}
+
+// ParseTaskVars parses k=v pairs
+func ParseTaskVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid variable %q, use name=value", pair)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// taskDir is where the chat looks for project tasks: the directory of the exec pane
+func (m *Manager) taskDir() string {
+	if m.ExecPane != nil && m.ExecPane.CurrentPath != "" {
+		return m.ExecPane.CurrentPath
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// taskNames returns the names of the tasks for completion
+func (m *Manager) taskNames(string) []string {
+	tasks, _ := LoadTasks(m.taskDir())
+	names := []string{"list"}
+	for _, task := range tasks {
+		names = append(names, task.Name)
+	}
+	return names
+}
+
+// isTaskRun reports whether input runs a task, "/task <name> [k=v...]"
+func isTaskRun(input string) bool {
+	parts := strings.Fields(input)
+	return len(parts) > 1 && prefixMatch(strings.ToLower(parts[0]), "/task") && parts[1] != "list"
+}
+
+// taskRequest renders the task run by input, "/task <name> [k=v...]", and returns
+// the message and preferred model
+func (m *Manager) taskRequest(input string) (message string, model string, err error) {
+	_, args, _ := strings.Cut(strings.TrimSpace(input), " ")
+	words, err := splitArgs(args)
+	if err != nil {
+		return "", "", err
+	}
+	task, err := FindTask(words[0], m.taskDir())
+	if err != nil {
+		return "", "", err
+	}
+	vars, err := ParseTaskVars(words[1:])
+	if err != nil {
+		return "", "", err
+	}
+	if message, err = task.Render(vars); err != nil {
+		return "", "", fmt.Errorf("%w, e.g. /task %s name=value", err, task.Name)
+	}
+	return message, task.Model, nil
+}
+
+// useModel switches the model of the session until restore is called
+func (m *Manager) useModel(model string) (restore func()) {
+	previous, overridden := m.SessionOverrides["openrouter.model"]
+	m.SessionOverrides["openrouter.model"] = model
+	return func() {
+		if overridden {
+			m.SessionOverrides["openrouter.model"] = previous
+		} else {
+			delete(m.SessionOverrides, "openrouter.model")
+		}
+	}
+}
+
+// listTasks prints the tasks of /task
+func (m *Manager) listTasks() {
+	tasks, err := LoadTasks(m.taskDir())
+	if err != nil {
+		m.Println("Failed to load tasks: " + err.Error())
+		return
+	}
+	if len(tasks) == 0 {
+		m.Println("No tasks, add them to ~/.config/tmuxai/tasks or .tmuxai/tasks in your project")
+		return
+	}
+	formatter := system.NewInfoFormatter()
+	for _, task := range tasks {
+		fmt.Printf("%s %s %s\n", formatter.LabelColor.Sprintf("%-20s", task.Name), task.Description,
+			formatter.NeutralColor.Sprint(strings.Join(task.VarNames(), " ")))
+	}
+}
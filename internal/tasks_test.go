@@ -0,0 +1,130 @@
+// Tests for the task library in tasks.go
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// writeTask writes a task file under dir
+func writeTask(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadTasks_UserAndProject(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	userTasks := filepath.Join(home, ".config", "tmuxai", "tasks")
+	writeTask(t, userTasks, "git-commit.txt", "Do git diff and commit.")
+	writeTask(t, userTasks, "deploy.md", "---\ndescription: user deploy\n---\nDeploy it.")
+
+	project := t.TempDir()
+	writeTask(t, filepath.Join(project, ".tmuxai", "tasks"), "deploy.md", `---
+description: Deploy the service
+vars: [env]
+defaults:
+  region: eu-west-1
+model: openai/gpt-4o-mini
+approve: all
+---
+Deploy to {{.env}} in {{.region}}.
+`)
+	subdir := filepath.Join(project, "cmd", "server")
+	os.MkdirAll(subdir, 0o755)
+
+	tasks, err := LoadTasks(subdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].Name != "deploy" || tasks[1].Name != "git-commit" {
+		t.Fatalf("expected deploy and git-commit, got %+v", tasks)
+	}
+	deploy := tasks[0]
+	if deploy.Source != "project" || deploy.Description != "Deploy the service" {
+		t.Errorf("project task should override the user task, got %+v", deploy)
+	}
+	if deploy.Model != "" || deploy.Approve != "policy" {
+		t.Errorf("a project task should not choose its model nor approve all, got %q %q", deploy.Model, deploy.Approve)
+	}
+	if got := strings.Join(deploy.VarNames(), " "); got != "env region?" {
+		t.Errorf("unexpected vars %q", got)
+	}
+
+	if _, err := deploy.Render(nil); err == nil || !strings.Contains(err.Error(), "env") {
+		t.Errorf("expected the missing variable to be reported, got %v", err)
+	}
+	message, err := deploy.Render(map[string]string{"env": "staging"})
+	if err != nil || message != "Deploy to staging in eu-west-1." {
+		t.Errorf("unexpected rendering %q, %v", message, err)
+	}
+	if tasks[1].Source != "user" || tasks[1].Body != "Do git diff and commit." {
+		t.Errorf("plain files should be tasks without front-matter, got %+v", tasks[1])
+	}
+}
+
+func TestLoadTask_Errors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"unclosed.md": "---\ndescription: x\nDo it.",
+		"approve.md":  "---\napprove: sometimes\n---\nDo it.",
+		"template.md": "Do {{.it",
+	} {
+		writeTask(t, dir, name, content)
+		if _, err := loadTask(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := ParseTaskVars([]string{"novalue"}); err == nil {
+		t.Error("expected a variable without = to be rejected")
+	}
+}
+
+func TestTaskRequest_Chat(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	project := t.TempDir()
+	writeTask(t, filepath.Join(home, ".config", "tmuxai", "tasks"), "greet.txt", "---\nvars: [name]\nmodel: small\n---\nSay hi to {{.name}}")
+	m := &Manager{Config: config.DefaultConfig(), ExecPane: &system.TmuxPaneDetails{CurrentPath: project}, SessionOverrides: map[string]interface{}{}}
+
+	if !isTaskRun("/task greet name=bob") || isTaskRun("/task list") || isTaskRun("/task") || isTaskRun("/squash now") {
+		t.Error("unexpected isTaskRun results")
+	}
+	message, model, err := m.taskRequest(`/task greet name="Bob Smith"`)
+	if err != nil || message != "Say hi to Bob Smith" || model != "small" {
+		t.Errorf("unexpected request %q %q %v", message, model, err)
+	}
+	if _, _, err := m.taskRequest("/task greet"); err == nil || !strings.Contains(err.Error(), "/task greet name=value") {
+		t.Errorf("expected a hint for the chat syntax, got %v", err)
+	}
+	if names := m.taskNames(""); strings.Join(names, " ") != "list greet" {
+		t.Errorf("unexpected completions %v", names)
+	}
+
+	m.SessionOverrides["openrouter.model"] = "chat-model"
+	restore := m.useModel("small")
+	if m.GetOpenRouterModel() != "small" {
+		t.Error("task model should be used")
+	}
+	restore()
+	if m.GetOpenRouterModel() != "chat-model" {
+		t.Error("the model of the session should be restored")
+	}
+}
+
+func TestRenderTaskFile(t *testing.T) {
+	message, err := RenderTaskFile(filepath.Join("..", "tasks", "git-commit.txt"))
+	if err != nil || strings.Contains(message, "---") || !strings.HasSuffix(message, "push to origin.") {
+		t.Errorf("-f should render the front-matter and defaults of the task, got %q, %v", message, err)
+	}
+}
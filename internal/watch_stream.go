@@ -0,0 +1,338 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const (
+	watchPollInterval = 200 * time.Millisecond
+	watchSettle       = time.Second // output has settled after this long without new output
+)
+
+// paneOutput is the new output of one watched pane
+type paneOutput struct {
+	PaneId string
+	Text   string
+}
+
+// panePipes shares the pipes of panes between the streams following them, a pane only
+// has one pipe. tmux pipe-pane appends everything a pane prints to a file in a
+// temporary directory, which each stream reads on its own.
+type panePipes struct {
+	mu    sync.Mutex
+	dir   string
+	pipes map[string]*panePipe
+}
+
+type panePipe struct {
+	path string
+	refs int
+}
+
+// open starts piping the output of pane id unless it is already piped for another
+// stream, and returns the pipe file positioned at its end
+func (p *panePipes) open(id string) (*os.File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pipe, ok := p.pipes[id]
+	if !ok {
+		piped, err := system.TmuxPanePiped(id)
+		if err != nil {
+			return nil, err
+		}
+		if piped {
+			return nil, errPanePiped
+		}
+		if p.dir == "" {
+			if p.dir, err = os.MkdirTemp("", "tmuxai-watch-"); err != nil {
+				return nil, fmt.Errorf("failed to create watch directory: %w", err)
+			}
+			p.pipes = make(map[string]*panePipe)
+		}
+		pipe = &panePipe{path: filepath.Join(p.dir, strings.TrimPrefix(id, "%")+".log")}
+		if err := os.WriteFile(pipe.path, nil, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to create watch file: %w", err)
+		}
+		quoted, err := syntax.Quote(pipe.path, syntax.LangPOSIX)
+		if err != nil {
+			return nil, err
+		}
+		if err := system.TmuxPipePane(id, "cat >> "+quoted); err != nil {
+			os.Remove(pipe.path)
+			return nil, err
+		}
+		p.pipes[id] = pipe
+		logger.Info("Streaming output of pane %s to %s", id, pipe.path)
+	}
+
+	f, err := os.Open(pipe.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watch file: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	pipe.refs++
+	return f, nil
+}
+
+// release stops the pipe of pane id once no stream follows it anymore
+func (p *panePipes) release(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pipe, ok := p.pipes[id]
+	if !ok {
+		return
+	}
+	if pipe.refs--; pipe.refs > 0 {
+		return
+	}
+	system.TmuxPipePane(id, "")
+	delete(p.pipes, id)
+	if len(p.pipes) == 0 {
+		os.RemoveAll(p.dir)
+		p.dir = ""
+	}
+}
+
+// errPanePiped is returned for panes whose output is already piped by something else,
+// e.g. a logging plugin
+var errPanePiped = errors.New("output of the pane is already piped")
+
+// paneStream follows the output of panes through their pipes
+type paneStream struct {
+	pipes *panePipes
+	panes []string
+	files map[string]*os.File
+
+	pending     map[string][]byte // output read but not batched yet
+	matched     map[string]int    // bytes of pending output already matched against triggers
+	first, last time.Time         // when pending output started and last grew
+}
+
+// newPaneStream follows the output of paneIds from now on. Panes already piped by
+// something else than TmuxAI are skipped.
+func newPaneStream(pipes *panePipes, paneIds []string) (*paneStream, error) {
+	s := &paneStream{pipes: pipes, files: make(map[string]*os.File), pending: make(map[string][]byte), matched: make(map[string]int)}
+	for _, id := range paneIds {
+		f, err := pipes.open(id)
+		if errors.Is(err, errPanePiped) {
+			logger.Info("Output of pane %s is already piped, not watching it", id)
+			continue
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.files[id] = f
+		s.panes = append(s.panes, id)
+	}
+
+	if len(s.panes) == 0 {
+		s.Close()
+		return nil, fmt.Errorf("no pane to watch")
+	}
+	return s, nil
+}
+
+// read returns the raw output of each pane appended since the last read
+func (s *paneStream) read() map[string][]byte {
+	output := make(map[string][]byte)
+	for _, id := range s.panes {
+		data, err := io.ReadAll(s.files[id])
+		if err != nil {
+			logger.Error("Failed to read output of pane %s: %v", id, err)
+		}
+		if len(data) > 0 {
+			output[id] = data
+		}
+	}
+	return output
+}
+
+// Close stops following the panes
+func (s *paneStream) Close() {
+	for _, id := range s.panes {
+		s.files[id].Close()
+		s.pipes.release(id)
+	}
+}
+
+// watchEvent is what ends a wait of a watcher: settled output, triggers which fired, or both
+type watchEvent struct {
+	Output []paneOutput // nil if no output settled
+	Hits   []triggerHit
+}
+
+// waitForWatchEvent blocks until the panes of w printed new output and it settled, or a
+// trigger fired. Continuous output is batched for at most the interval of w and output is
+// not returned before notBefore, so the AI is asked at most once per interval. Output
+// triggers are matched against each new line as it is read, regardless of notBefore, and
+// see all of the output while the AI only gets the last max_capture_lines lines of each
+// pane. Output of a paused watcher is dropped. It returns nil when ctx is cancelled.
+func waitForWatchEvent(ctx context.Context, w *Watcher, stream *paneStream, triggers *watchTriggers, notBefore time.Time) *watchEvent {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if w.Paused() {
+				stream.readPending(now)
+				stream.batch()
+				triggers.newBatch()
+				triggers.sawOutput(now)
+				continue
+			}
+			if stream.readPending(now) {
+				triggers.sawOutput(now)
+			}
+			event := &watchEvent{Hits: triggers.check(now, stream.panes)}
+			settled := !stream.first.IsZero() && (now.Sub(stream.last) >= watchSettle || now.Sub(stream.first) >= w.Interval)
+			if settled && !now.Before(notBefore) {
+				// the unfinished last line too, e.g. a prompt
+				event.Hits = append(event.Hits, triggers.matchOutput(stream.unmatched(true))...)
+				triggers.newBatch()
+				// nil when there was only cursor movement or colors, e.g. a redrawn prompt
+				event.Output = lastPaneLines(stream.batch(), w.maxLines)
+			} else {
+				event.Hits = append(event.Hits, triggers.matchOutput(stream.unmatched(false))...)
+			}
+			if event.Output != nil || len(event.Hits) > 0 {
+				return event
+			}
+		}
+	}
+}
+
+// readPending adds new output to the pending output, it returns true if there was any
+func (s *paneStream) readPending(now time.Time) bool {
+	output := s.read()
+	for id, data := range output {
+		s.pending[id] = append(s.pending[id], data...)
+	}
+	if len(output) == 0 {
+		return false
+	}
+	s.last = now
+	if s.first.IsZero() {
+		s.first = now
+	}
+	return true
+}
+
+// unmatched returns the complete lines of pending output not matched against triggers
+// yet, cleaned, and marks them matched. With all the unfinished last line is included.
+func (s *paneStream) unmatched(all bool) []paneOutput {
+	var batch []paneOutput
+	for _, id := range s.panes {
+		data := s.pending[id][s.matched[id]:]
+		if !all {
+			data = data[:bytes.LastIndexByte(data, '\n')+1]
+		}
+		s.matched[id] += len(data)
+		if text := cleanPaneOutput(data, 0); text != "" {
+			batch = append(batch, paneOutput{PaneId: id, Text: text})
+		}
+	}
+	return batch
+}
+
+// batch returns the pending output cleaned and starts a new batch. It returns nil when
+// there is no visible output.
+func (s *paneStream) batch() []paneOutput {
+	batch := batchPaneOutput(s.panes, s.pending, 0)
+	s.pending = make(map[string][]byte)
+	s.matched = make(map[string]int)
+	s.first, s.last = time.Time{}, time.Time{}
+	return batch
+}
+
+// batchPaneOutput cleans the pending output of panes in order. It returns nil when there
+// is no visible output.
+func batchPaneOutput(panes []string, pending map[string][]byte, maxLines int) []paneOutput {
+	var batch []paneOutput
+	for _, id := range panes {
+		if text := cleanPaneOutput(pending[id], maxLines); text != "" {
+			batch = append(batch, paneOutput{PaneId: id, Text: text})
+		}
+	}
+	return batch
+}
+
+// lastPaneLines keeps the last maxLines lines of the output of each pane
+func lastPaneLines(batch []paneOutput, maxLines int) []paneOutput {
+	if maxLines <= 0 {
+		return batch
+	}
+	var last []paneOutput
+	for _, output := range batch {
+		if lines := strings.Split(output.Text, "\n"); len(lines) > maxLines {
+			output.Text = strings.Join(lines[len(lines)-maxLines:], "\n")
+		}
+		last = append(last, output)
+	}
+	return last
+}
+
+// terminalEscapeRegex matches CSI, OSC and other escape sequences in raw terminal output
+var terminalEscapeRegex = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[()][0-9A-Za-z]|[@-Z\\-_])`)
+
+// cleanPaneOutput turns raw terminal output into text: escape sequences and control
+// characters are removed, carriage returns overwrite the line and only the last
+// maxLines lines are kept
+func cleanPaneOutput(data []byte, maxLines int) string {
+	text := terminalEscapeRegex.ReplaceAllString(string(data), "")
+
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if i := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		line = strings.Map(func(r rune) rune {
+			if r < 0x20 && r != '\t' || r == 0x7f {
+				return -1
+			}
+			return r
+		}, line)
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+
+	text = strings.TrimSpace(strings.Join(lines, "\n"))
+	if text == "" {
+		return ""
+	}
+	lines = strings.Split(text, "\n")
+	if maxLines > 0 && len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatPaneOutput renders new output for the watch message
+func formatPaneOutput(batch []paneOutput) string {
+	var b strings.Builder
+	b.WriteString("New output since the last check:\n")
+	for _, output := range batch {
+		fmt.Fprintf(&b, "<new_output pane=\"%s\">\n%s\n</new_output>\n", output.PaneId, output.Text)
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+// Tests for the pane output stream of watch mode in watch_stream.go
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+func TestCleanPaneOutput(t *testing.T) {
+	raw := "\x1b]0;user@host:~\x07\x1b[?2004h$ ls\r\n\x1b[0m\x1b[01;34mdir\x1b[0m  file.txt\r\n" +
+		"progress 10%\rprogress 100%\r\n\x1b[?2004l\x1b(B\x1b[K$ \r\n"
+	if got, want := cleanPaneOutput([]byte(raw), 0), "$ ls\ndir  file.txt\nprogress 100%\n$"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := cleanPaneOutput([]byte("a\nb\nc\n"), 2); got != "b\nc" {
+		t.Errorf("expected the last 2 lines, got %q", got)
+	}
+	if got := cleanPaneOutput([]byte("\x1b[2J\x1b[H\x1b[?25h\r\n"), 0); got != "" {
+		t.Errorf("escape sequences only should be empty, got %q", got)
+	}
+}
+
+// startTestWatchPanes starts a private tmux server with a chat pane running TmuxAI
+// and a shell pane to watch, it returns both pane ids
+func startTestWatchPanes(t *testing.T) (string, string) {
+	t.Helper()
+	chatPane := newTestTmux(t, []string{"sleep", "600"}).pane
+	out, err := exec.Command("tmux", "split-window", "-d", "-t", chatPane, "-P", "-F", "#{pane_id}", "sh").Output()
+	if err != nil {
+		t.Fatalf("split-window failed: %v", err)
+	}
+	t.Setenv("TMUX_PANE", chatPane)
+	return chatPane, strings.TrimSpace(string(out))
+}
+
+// fakeWatchAI answers requests with responses in order, repeating the last one, and records them
+type fakeWatchAI struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newFakeWatchAI(t *testing.T, responses ...string) *fakeWatchAI {
+	ai := &fakeWatchAI{}
+	ai.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ai.mu.Lock()
+		response := responses[min(len(ai.requests), len(responses)-1)]
+		ai.requests = append(ai.requests, string(body))
+		ai.mu.Unlock()
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Choices: []ChatCompletionChoice{{Message: Message{Role: "assistant", Content: response}}},
+		})
+	}))
+	t.Cleanup(ai.Close)
+	return ai
+}
+
+func (ai *fakeWatchAI) Requests() []string {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+	return slices.Clone(ai.requests)
+}
+
+// waitForRequests waits until the AI received n requests and returns them
+func (ai *fakeWatchAI) waitForRequests(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ai.Requests()) < n && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return ai.Requests()
+}
+
+// Test: idle panes cost no API calls, new output is sent once it settled
+func TestWatcher_OnlyAsksOnNewOutput(t *testing.T) {
+	chatPane, shellPane := startTestWatchPanes(t)
+	ai := newFakeWatchAI(t, "<NoComment>1</NoComment>")
+
+	m := newServerAgent(ai.URL)
+	m.PaneId = chatPane
+	w, err := m.startWatcher(watchArgs{Goal: "watch for errors"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Second)
+	if n := len(ai.Requests()); n != 0 {
+		t.Fatalf("expected no API calls while idle, got %d", n)
+	}
+
+	system.TmuxSendCommandToPane(shellPane, "echo watch-marker-$((20+22))", true)
+	ai.waitForRequests(t, 1)
+	time.Sleep(2 * time.Second)
+
+	requests := ai.Requests()
+	if len(requests) != 1 {
+		t.Errorf("expected exactly 1 API call for the burst, got %d", len(requests))
+	} else if !strings.Contains(requests[0], "watch-marker-42") || !strings.Contains(requests[0], "new_output") {
+		t.Errorf("request should contain the new output, got %s", requests[0])
+	}
+
+	m.stopWatcher(w)
+	if piped, _ := system.TmuxPanePiped(shellPane); piped {
+		t.Error("pipe-pane should be stopped after watching")
+	}
+}
@@ -0,0 +1,378 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/fatih/color"
+)
+
+const (
+	triggerContextLines = 10 // lines of output before and after a match sent when escalating
+	exitCheckInterval   = time.Second
+)
+
+// watchTrigger is a compiled watch_triggers rule
+type watchTrigger struct {
+	config.WatchTrigger
+	pattern *regexp.Regexp // from Pattern or Literal
+	exit    *regexp.Regexp
+}
+
+func (t *watchTrigger) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	switch {
+	case t.Pattern != "":
+		return "match /" + t.Pattern + "/"
+	case t.Literal != "":
+		return fmt.Sprintf("match %q", t.Literal)
+	case t.Exit != "":
+		return "exit of " + t.Exit
+	}
+	return "idle for " + t.Idle.String()
+}
+
+// triggerHit is a trigger which fired
+type triggerHit struct {
+	Trigger *watchTrigger
+	PaneId  string
+	Detail  string // matched line, exited process or idle time
+	Context string // output around the match
+}
+
+// compileWatchTriggers validates rules, each must set exactly one of pattern, literal, exit or idle
+func compileWatchTriggers(rules []config.WatchTrigger) ([]*watchTrigger, error) {
+	var triggers []*watchTrigger
+	for i, rule := range rules {
+		t := &watchTrigger{WatchTrigger: rule}
+		kinds := 0
+		var err error
+		if rule.Pattern != "" {
+			kinds++
+			if t.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("watch trigger %d: invalid pattern: %w", i+1, err)
+			}
+		}
+		if rule.Literal != "" {
+			kinds++
+			t.pattern = regexp.MustCompile(regexp.QuoteMeta(rule.Literal))
+		}
+		if rule.Exit != "" {
+			kinds++
+			if t.exit, err = regexp.Compile(rule.Exit); err != nil {
+				return nil, fmt.Errorf("watch trigger %d: invalid exit pattern: %w", i+1, err)
+			}
+		}
+		if rule.Idle > 0 {
+			kinds++
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("watch trigger %d: set exactly one of pattern, literal, exit or idle", i+1)
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
+
+// watchTriggers evaluates triggers against a watch and remembers what idle and
+// exit triggers need between checks
+type watchTriggers struct {
+	rules      []*watchTrigger
+	lastOutput time.Time
+	idleFired  map[*watchTrigger]bool
+	commands   map[string]string // foreground command of each pane at the last check
+	lastExit   time.Time
+	matched    map[string]bool // output triggers which fired in the batch, by trigger and pane
+
+	// paneCommands returns the foreground command of each pane still open
+	paneCommands func(paneIds []string) map[string]string
+}
+
+func newWatchTriggers(rules []*watchTrigger) *watchTriggers {
+	return &watchTriggers{
+		rules:        rules,
+		lastOutput:   time.Now(),
+		idleFired:    make(map[*watchTrigger]bool),
+		matched:      make(map[string]bool),
+		paneCommands: tmuxPaneCommands,
+	}
+}
+
+// tmuxPaneCommands asks tmux for the foreground command of panes
+func tmuxPaneCommands(paneIds []string) map[string]string {
+	commands := make(map[string]string)
+	for _, id := range paneIds {
+		if panes, err := system.TmuxPanesDetails(id); err == nil && len(panes) > 0 {
+			commands[id] = panes[0].CurrentCommand
+		}
+	}
+	return commands
+}
+
+// matchOutput returns pattern and literal triggers matching new output, at most once per
+// trigger and pane until newBatch
+func (w *watchTriggers) matchOutput(batch []paneOutput) []triggerHit {
+	var hits []triggerHit
+	for _, output := range batch {
+		lines := strings.Split(output.Text, "\n")
+		for _, t := range w.rules {
+			key := fmt.Sprintf("%p %s", t, output.PaneId)
+			if t.pattern == nil || w.matched[key] {
+				continue
+			}
+			for i, line := range lines {
+				if t.pattern.MatchString(line) {
+					w.matched[key] = true
+					from, to := max(0, i-triggerContextLines), min(len(lines), i+triggerContextLines+1)
+					hits = append(hits, triggerHit{
+						Trigger: t,
+						PaneId:  output.PaneId,
+						Detail:  strings.TrimSpace(line),
+						Context: strings.Join(lines[from:to], "\n"),
+					})
+					break
+				}
+			}
+		}
+	}
+	return hits
+}
+
+// newBatch re-arms output triggers once the output they matched was batched
+func (w *watchTriggers) newBatch() {
+	clear(w.matched)
+}
+
+// sawOutput re-arms idle triggers
+func (w *watchTriggers) sawOutput(now time.Time) {
+	w.lastOutput = now
+	clear(w.idleFired)
+}
+
+// check returns idle triggers which expired and exit triggers matching a process
+// which exited in one of panes since the last check
+func (w *watchTriggers) check(now time.Time, panes []string) []triggerHit {
+	var hits []triggerHit
+	watchExit := false
+	for _, t := range w.rules {
+		if t.Idle > 0 && !w.idleFired[t] && now.Sub(w.lastOutput) >= t.Idle {
+			w.idleFired[t] = true
+			hits = append(hits, triggerHit{Trigger: t, Detail: "no new output for " + t.Idle.String()})
+		}
+		watchExit = watchExit || t.exit != nil
+	}
+	if !watchExit || now.Sub(w.lastExit) < exitCheckInterval {
+		return hits
+	}
+	w.lastExit = now
+
+	commands := w.paneCommands(panes)
+	if w.commands != nil {
+		for _, id := range panes {
+			previous, ok := w.commands[id]
+			if !ok || previous == commands[id] || system.IsShellCommand(previous) {
+				continue
+			}
+			detail := previous + " exited"
+			if _, open := commands[id]; !open {
+				detail = previous + " exited and the pane closed"
+			}
+			for _, t := range w.rules {
+				if t.exit != nil && t.exit.MatchString(previous) {
+					hits = append(hits, triggerHit{Trigger: t, PaneId: id, Detail: detail})
+				}
+			}
+		}
+	}
+	w.commands = commands
+	return hits
+}
+
+// fireTrigger shows a trigger of w which fired and notifies about it
+func (m *Manager) fireTrigger(w *Watcher, hit triggerHit) {
+	logger.Info("Watcher %s trigger %s fired in pane %s: %s", w.Name, hit.Trigger, hit.PaneId, hit.Detail)
+	message := hit.Trigger.Message
+	if message == "" {
+		message = hit.Trigger.String()
+	}
+	where := ""
+	if hit.PaneId != "" {
+		where = " in pane " + hit.PaneId
+	}
+	m.watcherPrintln(w, color.New(color.FgHiRed, color.Bold).Sprint("Trigger: "+message)+
+		color.New(color.FgHiBlack).Sprintf(" (%s%s)", hit.Detail, where))
+
+	notifiers := hit.Trigger.Notify
+	if notifiers == nil {
+		notifiers = w.notifiers(w.config.Notify.Trigger)
+	}
+	m.notifyWith(w.config, notifiers, Notification{Event: "trigger", Title: "Watch trigger of " + w.Name, Message: message + ": " + hit.Detail, PaneId: hit.PaneId})
+}
+
+// formatTriggerHits renders escalated triggers for the AI
+func formatTriggerHits(hits []triggerHit) string {
+	var b strings.Builder
+	for _, hit := range hits {
+		fmt.Fprintf(&b, "Local watch trigger %s fired", hit.Trigger)
+		if hit.PaneId != "" {
+			fmt.Fprintf(&b, " in pane %s", hit.PaneId)
+		}
+		fmt.Fprintf(&b, ": %s\n", hit.Detail)
+		if hit.Context != "" {
+			fmt.Fprintf(&b, "<trigger_context pane=\"%s\">\n%s\n</trigger_context>\n", hit.PaneId, hit.Context)
+		}
+	}
+	b.WriteString("Briefly explain what happened and what the user could do next.")
+	return b.String()
+}
+
+// watchArgs are the parsed arguments of /watch
+type watchArgs struct {
+	Goal     string
+	Name     string
+	Target   watchTarget
+	Interval time.Duration // minimum time between AI calls, 0 uses wait_interval
+	Model    string
+	Act      bool     // the AI may run commands, see actPolicy
+	Allow    []string // regexes of commands the AI may run without confirmation
+	Triggers []config.WatchTrigger
+	Notify   []string // notifiers of this watcher, nil uses notify.watch and notify.trigger
+}
+
+// watchTarget is what a watcher watches, the current window when Kind is empty
+type watchTarget struct {
+	Kind  string // pane, window or session
+	Value string // tmux target, e.g. %3, main:1 or main
+}
+
+var watchValueFlags = []string{
+	"--name", "--pane", "--window", "--session", "--interval", "--model", "--allow",
+	"--match", "--literal", "--exit", "--idle", "--notify",
+}
+
+// parseWatchArgs splits /watch arguments into the watch goal, the watcher settings
+// (--name, --pane, --window, --session, --interval, --model, --notify, --act and --allow) and inline
+// triggers: --match <regex>, --literal <text>, --exit <process regex>, --idle <duration>
+// and --escalate, which asks the AI to explain when an inline trigger fires
+func parseWatchArgs(input string) (watchArgs, error) {
+	var args watchArgs
+	words, err := splitArgs(input)
+	if err != nil {
+		return args, err
+	}
+
+	var goal []string
+	escalate := false
+	for i := 0; i < len(words); i++ {
+		flag := words[i]
+		if flag == "--escalate" {
+			escalate = true
+			continue
+		}
+		if flag == "--act" {
+			args.Act = true
+			continue
+		}
+		if !slices.Contains(watchValueFlags, flag) {
+			goal = append(goal, flag)
+			continue
+		}
+		if i+1 >= len(words) {
+			return args, fmt.Errorf("%s needs a value", flag)
+		}
+		i++
+		value := words[i]
+
+		var rule config.WatchTrigger
+		switch flag {
+		case "--notify":
+			args.Notify = append(args.Notify, strings.Split(value, ",")...)
+			continue
+		case "--name":
+			args.Name = value
+			continue
+		case "--pane", "--window", "--session":
+			if args.Target.Kind != "" {
+				return args, fmt.Errorf("use only one of --pane, --window or --session")
+			}
+			args.Target = watchTarget{Kind: strings.TrimPrefix(flag, "--"), Value: value}
+			continue
+		case "--interval":
+			if args.Interval, err = time.ParseDuration(value); err != nil || args.Interval <= 0 {
+				return args, fmt.Errorf("invalid --interval %q, use a duration like 30s", value)
+			}
+			continue
+		case "--model":
+			args.Model = value
+			continue
+		case "--allow":
+			args.Allow = append(args.Allow, value)
+			continue
+		case "--match":
+			rule.Pattern = value
+		case "--literal":
+			rule.Literal = value
+		case "--exit":
+			rule.Exit = value
+		case "--idle":
+			if rule.Idle, err = time.ParseDuration(value); err != nil || rule.Idle <= 0 {
+				return args, fmt.Errorf("invalid --idle %q, use a duration like 10m", value)
+			}
+		}
+		args.Triggers = append(args.Triggers, rule)
+	}
+	for i := range args.Triggers {
+		args.Triggers[i].Escalate = escalate
+	}
+	args.Goal = strings.Join(goal, " ")
+	if args.Act && args.Goal == "" {
+		return args, fmt.Errorf("--act needs a goal which says when to act")
+	}
+	if len(args.Allow) > 0 && !args.Act {
+		return args, fmt.Errorf("--allow needs --act")
+	}
+	return args, nil
+}
+
+// splitArgs splits s into words, single and double quotes group words
+func splitArgs(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,220 @@
+// Tests for local watch triggers in watch_triggers.go
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+)
+
+func TestParseWatchArgs(t *testing.T) {
+	args, err := parseWatchArgs(`--match 'FAIL|panic:' --exit "go|make" --idle 5m --escalate --notify desktop,ops tell me when tests finish`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Goal != "tell me when tests finish" {
+		t.Errorf("unexpected goal %q", args.Goal)
+	}
+	if len(args.Notify) != 2 || args.Notify[0] != "desktop" || args.Notify[1] != "ops" {
+		t.Errorf("unexpected notifiers %v", args.Notify)
+	}
+	rules := args.Triggers
+	want := []config.WatchTrigger{
+		{Pattern: "FAIL|panic:", Escalate: true},
+		{Exit: "go|make", Escalate: true},
+		{Idle: 5 * time.Minute, Escalate: true},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("expected %d rules, got %+v", len(want), rules)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(rules[i], want[i]) {
+			t.Errorf("rule %d: got %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+
+	args, err = parseWatchArgs(`--name tests --pane %3 --interval 30s --model cheap flag failures`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Name != "tests" || args.Target != (watchTarget{Kind: "pane", Value: "%3"}) ||
+		args.Interval != 30*time.Second || args.Model != "cheap" || args.Goal != "flag failures" {
+		t.Errorf("unexpected watcher settings %+v", args)
+	}
+
+	for _, args := range []string{"--match", "--idle soon", "--literal 'unterminated", "--interval 0s", "--pane %1 --session main"} {
+		if _, err := parseWatchArgs(args); err == nil {
+			t.Errorf("expected an error for %q", args)
+		}
+	}
+}
+
+func TestCompileWatchTriggers_Validation(t *testing.T) {
+	for _, rule := range []config.WatchTrigger{
+		{},
+		{Pattern: "a", Literal: "b"},
+		{Pattern: "(unclosed"},
+		{Exit: "[", Message: "bad"},
+	} {
+		if _, err := compileWatchTriggers([]config.WatchTrigger{rule}); err == nil {
+			t.Errorf("expected %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestWatchTriggers_MatchOutput(t *testing.T) {
+	triggers, err := compileWatchTriggers([]config.WatchTrigger{
+		{Name: "build", Pattern: `(?i)build failed`},
+		{Literal: "OOMKilled", Escalate: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWatchTriggers(triggers)
+
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, "line")
+	}
+	lines[15] = "pod web-1 OOMKilled (the [1] is literal)"
+	hits := w.matchOutput([]paneOutput{
+		{PaneId: "%1", Text: "compiling\nBuild FAILED: 2 errors\nBuild failed again"},
+		{PaneId: "%2", Text: strings.Join(lines, "\n")},
+		{PaneId: "%3", Text: "all good"},
+	})
+
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %+v", hits)
+	}
+	if hits[0].Trigger.String() != "build" || hits[0].PaneId != "%1" || hits[0].Detail != "Build FAILED: 2 errors" {
+		t.Errorf("unexpected first hit %+v", hits[0])
+	}
+	if got := strings.Count(hits[1].Context, "\n") + 1; got != 2*triggerContextLines+1 {
+		t.Errorf("expected %d context lines, got %d", 2*triggerContextLines+1, got)
+	}
+	if msg := formatTriggerHits(hits[1:]); !strings.Contains(msg, `match "OOMKilled"`) || !strings.Contains(msg, `<trigger_context pane="%2">`) {
+		t.Errorf("unexpected escalation message:\n%s", msg)
+	}
+}
+
+func TestWatchTriggers_IdleAndExit(t *testing.T) {
+	triggers, err := compileWatchTriggers([]config.WatchTrigger{
+		{Idle: time.Minute},
+		{Name: "tests", Exit: "^go$"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWatchTriggers(triggers)
+	commands := map[string]string{"%1": "go", "%2": "vim"}
+	w.paneCommands = func([]string) map[string]string {
+		copied := make(map[string]string)
+		for k, v := range commands {
+			copied[k] = v
+		}
+		return copied
+	}
+	panes := []string{"%1", "%2"}
+	start := w.lastOutput
+
+	if hits := w.check(start.Add(time.Second), panes); len(hits) != 0 {
+		t.Fatalf("expected no hits on the first check, got %+v", hits)
+	}
+
+	// go exits, vim keeps running
+	commands["%1"] = "bash"
+	hits := w.check(start.Add(2*time.Second), panes)
+	if len(hits) != 1 || hits[0].Trigger.String() != "tests" || hits[0].PaneId != "%1" || hits[0].Detail != "go exited" {
+		t.Fatalf("expected the exit trigger, got %+v", hits)
+	}
+
+	// idle fires once until new output
+	hits = w.check(start.Add(time.Minute), panes)
+	if len(hits) != 1 || hits[0].Trigger.Idle != time.Minute {
+		t.Fatalf("expected the idle trigger, got %+v", hits)
+	}
+	if hits := w.check(start.Add(2*time.Minute), panes); len(hits) != 0 {
+		t.Errorf("idle trigger should fire once, got %+v", hits)
+	}
+	w.sawOutput(start.Add(2 * time.Minute))
+	if hits := w.check(start.Add(3*time.Minute), panes); len(hits) != 1 {
+		t.Errorf("idle trigger should fire again after new output, got %+v", hits)
+	}
+}
+
+// newFileStream returns a stream reading the output of pane %1 from a file instead of tmux
+func newFileStream(t *testing.T) (*paneStream, *os.File) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "1.log")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { out.Close() })
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { in.Close() })
+	return &paneStream{panes: []string{"%1"}, files: map[string]*os.File{"%1": in}, pending: make(map[string][]byte), matched: make(map[string]int)}, out
+}
+
+func TestWaitForWatchEvent_TriggersSeeAllOutput(t *testing.T) {
+	triggers, err := compileWatchTriggers([]config.WatchTrigger{{Literal: "FATAL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, out := newFileStream(t)
+	fmt.Fprintln(out, "FATAL: out of memory")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintln(out, "stack frame", i)
+	}
+
+	w := &Watcher{Interval: time.Minute, maxLines: 5}
+	event := waitForWatchEvent(context.Background(), w, stream, newWatchTriggers(triggers), time.Time{})
+	if len(event.Hits) != 1 || event.Hits[0].Detail != "FATAL: out of memory" {
+		t.Errorf("the trigger should match output beyond max_capture_lines, got %+v", event.Hits)
+	}
+	if event.Output == nil {
+		event = waitForWatchEvent(context.Background(), w, stream, newWatchTriggers(triggers), time.Time{})
+	}
+	if len(event.Output) != 1 || strings.Count(event.Output[0].Text, "\n") != 4 {
+		t.Errorf("the AI should only get the last 5 lines, got %+v", event.Output)
+	}
+}
+
+func TestWaitForWatchEvent_TriggersIgnoreRateLimit(t *testing.T) {
+	triggers, err := compileWatchTriggers([]config.WatchTrigger{{Pattern: "panic:"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, out := newFileStream(t)
+	w := &Watcher{Interval: time.Minute, maxLines: 5}
+	watchTriggers := newWatchTriggers(triggers)
+	fmt.Fprint(out, "starting\npanic: nil map\ngoroutine 1")
+
+	started := time.Now()
+	event := waitForWatchEvent(context.Background(), w, stream, watchTriggers, started.Add(time.Hour))
+	if time.Since(started) > watchSettle || len(event.Hits) != 1 || event.Output != nil {
+		t.Fatalf("the trigger should fire right away, without the output, got %+v after %s", event, time.Since(started))
+	}
+
+	// the same trigger fires once per batch, the output still goes to the AI once it may be asked
+	fmt.Fprintln(out, "panic: again")
+	ctx, cancel := context.WithTimeout(context.Background(), watchSettle)
+	defer cancel()
+	if event := waitForWatchEvent(ctx, w, stream, watchTriggers, started.Add(time.Hour)); event != nil {
+		t.Errorf("expected no second hit in the same batch, got %+v", event)
+	}
+	event = waitForWatchEvent(context.Background(), w, stream, watchTriggers, time.Time{})
+	if len(event.Output) != 1 || !strings.Contains(event.Output[0].Text, "panic: nil map") {
+		t.Errorf("expected the batched output, got %+v", event)
+	}
+}
@@ -0,0 +1,454 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/config"
+	"github.com/alvinunreal/tmuxai/logger"
+	"github.com/alvinunreal/tmuxai/system"
+	"github.com/fatih/color"
+)
+
+const watcherHistory = 20 // messages of its conversation a watcher keeps
+
+// Watcher watches panes in the background with its own goal, triggers, model and
+// conversation, while the chat pane stays usable
+type Watcher struct {
+	Id        int
+	Name      string
+	Target    string // what is watched, e.g. "window main:1"
+	Goal      string
+	Interval  time.Duration // minimum time between AI calls
+	Model     string
+	Notify    []string // notifiers chosen with --notify, nil uses notify.watch and notify.trigger
+	Act       bool     // started with --act, the AI may run commands
+	StartedAt time.Time
+
+	panes    []string
+	config   *config.Config // copy of the config when the watcher started, see snapshotConfig
+	triggers []*watchTrigger
+	client   *AiClient  // own client, usage of concurrent requests must not mix
+	act      *actPolicy // nil unless Act
+	prompt   ChatMessage
+	maxLines int
+	paused   atomic.Bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu       sync.Mutex // guards the fields below
+	messages []ChatMessage
+	asks     int
+	comments int
+	tokens   int
+	cost     float64
+	pending  *watchAction // command waiting for /watch approve
+	actions  []time.Time  // when commands ran, for the rate limit
+	notes    []string     // what happened to commands, sent with the next message
+}
+
+// Paused reports whether the watcher drops output instead of watching it
+func (w *Watcher) Paused() bool {
+	return w.paused.Load()
+}
+
+// notifiers returns the notifiers chosen with --notify, or configured
+func (w *Watcher) notifiers(configured []string) []string {
+	if w.Notify != nil {
+		return w.Notify
+	}
+	return configured
+}
+
+// Watchers returns the running watchers in the order they were started
+func (m *Manager) Watchers() []*Watcher {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.watchers)
+}
+
+// findWatcher returns the watcher with the given id or name
+func (m *Manager) findWatcher(ref string) *Watcher {
+	id, err := strconv.Atoi(ref)
+	for _, w := range m.Watchers() {
+		if (err == nil && w.Id == id) || w.Name == ref {
+			return w
+		}
+	}
+	return nil
+}
+
+// startWatcher resolves the target of args and starts watching it in the background
+func (m *Manager) startWatcher(args watchArgs, triggers []*watchTrigger) (*Watcher, error) {
+	target, panes, err := m.watchTargetPanes(args.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := m.snapshotConfig()
+	w := &Watcher{
+		Name:      args.Name,
+		Target:    target,
+		Goal:      args.Goal,
+		Interval:  args.Interval,
+		Model:     args.Model,
+		Notify:    args.Notify,
+		Act:       args.Act,
+		StartedAt: time.Now(),
+		config:    cfg,
+		triggers:  triggers,
+		client:    NewAiClient(&cfg.OpenRouter),
+		prompt:    m.watchPrompt(args.Act),
+		maxLines:  m.GetMaxCaptureLines(),
+		done:      make(chan struct{}),
+	}
+	if w.Interval <= 0 {
+		w.Interval = time.Duration(m.GetWaitInterval()) * time.Second
+	}
+	if w.Model == "" {
+		w.Model = m.GetOpenRouterModel()
+	}
+	if w.Goal != "" {
+		w.prompt.Content += "\n\nWatch for: " + w.Goal
+	}
+	if w.Act {
+		if w.act, err = newActPolicy(cfg, args.Allow); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	for _, other := range m.watchers {
+		if w.Name != "" && other.Name == w.Name {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("a watcher called %s is already running", w.Name)
+		}
+	}
+	m.nextWatcherId++
+	w.Id = m.nextWatcherId
+	if w.Name == "" {
+		w.Name = fmt.Sprintf("watch%d", w.Id)
+	}
+	m.mu.Unlock()
+
+	stream, err := newPaneStream(&m.pipes, panes)
+	if err != nil {
+		return nil, err
+	}
+	w.panes = stream.panes
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	m.mu.Lock()
+	m.watchers = append(m.watchers, w)
+	m.mu.Unlock()
+
+	logger.Info("Watcher %d %s started on %s %v: %s", w.Id, w.Name, w.Target, w.panes, w.Goal)
+	go m.runWatcher(ctx, w, stream)
+	return w, nil
+}
+
+// watchTargetPanes returns a description of target and its panes, the TmuxAI pane excluded.
+// Without a target the current window is watched.
+func (m *Manager) watchTargetPanes(target watchTarget) (string, []string, error) {
+	value := target.Value
+	if target.Kind == "" {
+		window, err := system.TmuxCurrentWindowTarget()
+		if err != nil {
+			return "", nil, err
+		}
+		target, value = watchTarget{Kind: "window"}, window
+	}
+	ids, err := system.TmuxPaneIds(value, target.Kind == "session")
+	if err != nil {
+		return "", nil, err
+	}
+	ids = slices.DeleteFunc(ids, func(id string) bool { return id == m.PaneId })
+	if len(ids) == 0 {
+		return "", nil, fmt.Errorf("no pane to watch in %s %s besides TmuxAI", target.Kind, value)
+	}
+	return target.Kind + " " + value, ids, nil
+}
+
+// runWatcher streams the output of the panes of w until it is stopped or its goal is
+// accomplished. Triggers fire locally, the AI is only asked about settled new output
+// when the watcher has a goal and when a trigger escalates.
+func (m *Manager) runWatcher(ctx context.Context, w *Watcher, stream *paneStream) {
+	defer close(w.done)
+	defer stream.Close()
+
+	triggers := newWatchTriggers(w.triggers)
+	var notBefore time.Time
+	for {
+		event := waitForWatchEvent(ctx, w, stream, triggers, notBefore)
+		if event == nil {
+			return
+		}
+
+		var escalate []triggerHit
+		for _, hit := range event.Hits {
+			m.fireTrigger(w, hit)
+			if hit.Trigger.Escalate {
+				escalate = append(escalate, hit)
+			}
+		}
+
+		var message []string
+		if w.Goal != "" && event.Output != nil {
+			message = append(message, formatPaneOutput(event.Output))
+		}
+		if len(escalate) > 0 {
+			message = append(message, formatTriggerHits(escalate))
+		}
+		if len(message) == 0 {
+			continue
+		}
+
+		notBefore = time.Now().Add(w.Interval)
+		if m.askWatcher(ctx, w, strings.Join(message, "\n\n"), actionPane(w, event.Output, escalate)) {
+			logger.Info("Watcher %d %s accomplished its goal", w.Id, w.Name)
+			m.watcherPrintln(w, "Watch goal accomplished, stopped watching")
+			m.removeWatcher(w)
+			return
+		}
+	}
+}
+
+// askWatcher sends message to the AI in the conversation of w and shows its comment.
+// Commands of a watcher started with --act are proposed to run in paneId. It returns
+// true when the AI considers the watch goal accomplished.
+func (m *Manager) askWatcher(ctx context.Context, w *Watcher, message string, paneId string) bool {
+	w.mu.Lock()
+	notes := w.notes
+	w.notes = nil
+	if len(notes) > 0 {
+		message = strings.Join(notes, "\n") + "\n\n" + message
+	}
+	current := ChatMessage{Content: message, FromUser: true, Timestamp: time.Now()}
+	sending := append(append([]ChatMessage{w.prompt}, w.messages...), current)
+	w.mu.Unlock()
+
+	response, err := w.client.GetResponseFromChatMessages(ctx, sending, w.Model)
+	if err != nil {
+		// keep the notes for the next message
+		w.mu.Lock()
+		w.notes = append(notes, w.notes...)
+		w.mu.Unlock()
+		if ctx.Err() == nil {
+			logger.Error("Watcher %s failed to get response from AI: %v", w.Name, err)
+			m.watcherPrintln(w, "Failed to get response from AI: "+err.Error())
+		}
+		return false
+	}
+	usage := w.client.LastUsage()
+
+	r, err := m.parseAIResponse(response)
+	if err != nil {
+		logger.Error("Watcher %s failed to parse AI response: %v", w.Name, err)
+		m.watcherPrintln(w, "Failed to parse AI response: "+err.Error())
+		return false
+	}
+	logger.Debug("Watcher %s AIResponse: %s", w.Name, r.String())
+
+	w.mu.Lock()
+	w.asks++
+	w.tokens += max(usage.TotalTokens, usage.PromptTokens+usage.CompletionTokens)
+	w.cost += usage.Cost
+	comment := r.Message != "" && !r.NoComment
+	if comment || len(r.ExecCommand) > 0 {
+		w.comments++
+		w.messages = append(w.messages, current, ChatMessage{Content: response, Timestamp: time.Now()})
+		if len(w.messages) > watcherHistory {
+			w.messages = slices.Clone(w.messages[len(w.messages)-watcherHistory:])
+		}
+	}
+	w.mu.Unlock()
+
+	if comment {
+		m.watcherPrintln(w, system.Cosmetics(r.Message))
+		m.notifyWith(w.config, w.notifiers(w.config.Notify.Watch), Notification{Event: "watch", Title: "Watch " + w.Name, Message: r.Message})
+	}
+
+	if len(r.SendKeys) > 0 || r.PasteMultilineContent != "" || (len(r.ExecCommand) > 0 && !w.Act) {
+		logger.Info("Watcher %s ignored actions it may not take: %s", w.Name, r.String())
+	}
+	if w.Act && len(r.ExecCommand) > 0 && ctx.Err() == nil {
+		m.proposeAction(w, r.ExecCommand[0], paneId)
+		for _, command := range r.ExecCommand[1:] {
+			m.refuseAction(w, &watchAction{Command: command, PaneId: paneId}, "only one command runs per response")
+		}
+	}
+	return r.RequestAccomplished
+}
+
+// stopWatcher stops w and waits until it released its panes
+func (m *Manager) stopWatcher(w *Watcher) {
+	w.cancel()
+	<-w.done
+	m.removeWatcher(w)
+	logger.Info("Watcher %d %s stopped", w.Id, w.Name)
+}
+
+// stopWatchers stops every watcher
+func (m *Manager) stopWatchers() {
+	for _, w := range m.Watchers() {
+		m.stopWatcher(w)
+	}
+}
+
+func (m *Manager) removeWatcher(w *Watcher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchers = slices.DeleteFunc(m.watchers, func(other *Watcher) bool { return other == w })
+}
+
+// SetOutput sets where output of watchers goes, readline's writer keeps it above the
+// prompt being edited. nil prints to stdout.
+func (m *Manager) SetOutput(out io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.output = out
+}
+
+// watcherPrintln prints msg of a watcher prefixed with its name
+func (m *Manager) watcherPrintln(w *Watcher, msg string) {
+	m.mu.Lock()
+	out := m.output
+	m.mu.Unlock()
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintln(out, color.New(color.FgHiCyan, color.Bold).Sprint("["+w.Name+"] ")+msg)
+}
+
+const watchUsage = `Usage: /watch [--name <name>] [--pane <id> | --window <target> | --session <target>]
+              [--interval <duration>] [--model <model>] [--match <regex>] [--literal <text>]
+              [--exit <process>] [--idle <duration>] [--escalate] [--notify <notifiers>] [goal]
+              [--act [--allow <regex>]]
+       /watch list | stop <id|name|all> | pause <id|name> | resume <id|name>
+       /watch approve <id|name> | reject <id|name>`
+
+// processWatchCommand handles /watch, the watch_triggers of the config apply to every watcher
+func (m *Manager) processWatchCommand(input string) {
+	words := strings.Fields(input)
+	switch {
+	case len(words) == 0 || len(words) == 1 && words[0] == "list":
+		m.listWatchers()
+		return
+	case len(words) == 2 && slices.Contains([]string{"stop", "pause", "resume", "approve", "reject"}, words[0]):
+		m.controlWatcher(words[0], words[1])
+		return
+	}
+
+	args, err := parseWatchArgs(input)
+	if err != nil {
+		m.Println(err.Error() + "\n" + watchUsage)
+		return
+	}
+	rules := append(append([]config.WatchTrigger{}, m.Config.WatchTriggers...), args.Triggers...)
+	triggers, err := compileWatchTriggers(rules)
+	if err != nil {
+		m.Println(err.Error())
+		return
+	}
+	if args.Goal == "" && len(triggers) == 0 {
+		m.Println(watchUsage)
+		return
+	}
+
+	w, err := m.startWatcher(args, triggers)
+	if err != nil {
+		m.Println("Failed to watch panes: " + err.Error())
+		return
+	}
+	watching := fmt.Sprintf("Watcher %d %s is watching %s (%s) in the background", w.Id, w.Name, w.Target, strings.Join(w.panes, ", "))
+	if len(triggers) > 0 {
+		names := make([]string, len(triggers))
+		for i, t := range triggers {
+			names[i] = t.String()
+		}
+		watching += " with triggers: " + strings.Join(names, ", ")
+	}
+	m.Println(watching)
+}
+
+// controlWatcher stops, pauses or resumes the watcher ref or approves or rejects its
+// command, stop also accepts all
+func (m *Manager) controlWatcher(action string, ref string) {
+	if action == "stop" && ref == "all" {
+		m.stopWatchers()
+		m.Println("Stopped all watchers")
+		return
+	}
+	w := m.findWatcher(ref)
+	if w == nil {
+		m.Println(fmt.Sprintf("No watcher %s, see /watch list", ref))
+		return
+	}
+	switch action {
+	case "stop":
+		m.stopWatcher(w)
+		m.Println("Stopped watcher " + w.Name)
+	case "pause":
+		w.paused.Store(true)
+		logger.Info("Watcher %d %s paused", w.Id, w.Name)
+		m.Println("Paused watcher " + w.Name + ", its output is ignored until /watch resume")
+	case "resume":
+		w.paused.Store(false)
+		logger.Info("Watcher %d %s resumed", w.Id, w.Name)
+		m.Println("Resumed watcher " + w.Name)
+	case "approve", "reject":
+		m.resolveAction(w, action == "approve")
+	}
+}
+
+// listWatchers prints the running watchers
+func (m *Manager) listWatchers() {
+	watchers := m.Watchers()
+	if len(watchers) == 0 {
+		m.Println("No watchers running\n" + watchUsage)
+		return
+	}
+	formatter := system.NewInfoFormatter()
+	for _, w := range watchers {
+		state := "running"
+		if w.Paused() {
+			state = "paused"
+		}
+		if w.Act {
+			state += ", acting"
+		}
+		w.mu.Lock()
+		stats := fmt.Sprintf("%d asks, %d comments, %d tokens", w.asks, w.comments, w.tokens)
+		if w.cost > 0 {
+			stats += fmt.Sprintf(", $%.4f", w.cost)
+		}
+		pending := w.pending
+		w.mu.Unlock()
+
+		fmt.Printf("%s %s %s %s\n",
+			formatter.LabelColor.Sprintf("%3d", w.Id),
+			formatter.ValueColor.Sprint(w.Name),
+			formatter.NeutralColor.Sprintf("[%s]", state),
+			fmt.Sprintf("%s (%s), every %s with %s", w.Target, strings.Join(w.panes, ", "), w.Interval, w.Model))
+		if w.Goal != "" {
+			fmt.Printf("    goal: %s\n", w.Goal)
+		}
+		for _, t := range w.triggers {
+			fmt.Printf("    trigger: %s\n", t)
+		}
+		if pending != nil {
+			fmt.Println(formatter.ValueColor.Sprintf("    waiting for approval since %s: %s in pane %s",
+				pending.At.Format("15:04:05"), pending.Command, pending.PaneId))
+		}
+		fmt.Println(formatter.NeutralColor.Sprintf("    started %s, %s", w.StartedAt.Format("15:04:05"), stats))
+	}
+}
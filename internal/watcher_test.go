@@ -0,0 +1,99 @@
+// Tests for background watchers in watcher.go, meant to run with go test -race
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alvinunreal/tmuxai/system"
+)
+
+// syncBuffer collects the output of watchers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Test: watchers of the same pane share its pipe, run in the background and prefix comments with their name
+func TestWatchers_RunInBackground(t *testing.T) {
+	chatPane, shellPane := startTestWatchPanes(t)
+	ai := newFakeWatchAI(t, "The build failed")
+
+	m := newServerAgent(ai.URL)
+	m.PaneId = chatPane
+	var out syncBuffer
+	m.SetOutput(&out)
+
+	m.processWatchCommand("--name alpha --pane " + shellPane + " --interval 1s flag failures")
+	m.processWatchCommand("--name beta flag failures too")
+	if watchers := m.Watchers(); len(watchers) != 2 || watchers[1].Target == "" || watchers[1].panes[0] != shellPane {
+		t.Fatalf("expected 2 watchers of %s, got %+v", shellPane, watchers)
+	}
+	if m.State() != StateIdle || !strings.Contains(m.GetPrompt(), "∞2") {
+		t.Errorf("chat should stay idle with 2 watchers, got %s and prompt %q", m.State(), m.GetPrompt())
+	}
+
+	system.TmuxSendCommandToPane(shellPane, "echo build-$((40+2))", true)
+	if requests := ai.waitForRequests(t, 2); len(requests) != 2 {
+		t.Fatalf("expected one API call per watcher, got %d", len(requests))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for strings.Count(out.String(), "The build failed") < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := out.String(); !strings.Contains(got, "[alpha] The build failed") || !strings.Contains(got, "[beta] The build failed") {
+		t.Errorf("comments should be prefixed with the watcher name, got %q", got)
+	}
+
+	m.processWatchCommand("stop alpha")
+	if piped, _ := system.TmuxPanePiped(shellPane); !piped {
+		t.Error("pipe should stay while beta watches the pane")
+	}
+	m.processWatchCommand("stop all")
+	if piped, _ := system.TmuxPanePiped(shellPane); piped || len(m.Watchers()) != 0 {
+		t.Error("pipe should be stopped with the last watcher")
+	}
+}
+
+// Test: a paused watcher ignores output until it is resumed
+func TestWatchers_PauseAndResume(t *testing.T) {
+	chatPane, shellPane := startTestWatchPanes(t)
+	ai := newFakeWatchAI(t, "<NoComment>1</NoComment>")
+
+	m := newServerAgent(ai.URL)
+	m.PaneId = chatPane
+	m.processWatchCommand("--name logs --interval 1s watch the logs")
+	defer m.stopWatchers()
+
+	m.processWatchCommand("pause 1")
+	if w := m.findWatcher("logs"); w == nil || !w.Paused() {
+		t.Fatal("watcher 1 should be paused")
+	}
+	system.TmuxSendCommandToPane(shellPane, "echo while-paused", true)
+	time.Sleep(2 * time.Second)
+	if n := len(ai.Requests()); n != 0 {
+		t.Fatalf("expected no API calls while paused, got %d", n)
+	}
+
+	m.processWatchCommand("resume logs")
+	system.TmuxSendCommandToPane(shellPane, "echo after-resume", true)
+	requests := ai.waitForRequests(t, 1)
+	if len(requests) != 1 || strings.Contains(requests[0], "while-paused") || !strings.Contains(requests[0], "after-resume") {
+		t.Errorf("expected only the output after resume, got %v", requests)
+	}
+}
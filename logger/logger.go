@@ -112,3 +112,10 @@ func Debug(format string, v ...interface{}) {
 		instance.Debug(format, v...)
 	}
 }
+
+// Close closes the singleton instance
+func Close() {
+	if instance != nil {
+		instance.Close()
+	}
+}
@@ -0,0 +1,93 @@
+package system
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrKeyringNotFound is returned by KeyringGet when no secret is stored for the account
+var ErrKeyringNotFound = errors.New("no secret in the keyring")
+
+// KeyringAvailable reports whether the OS keyring can be used: the Secret Service API
+// through secret-tool (libsecret) on Linux, the login keychain on macOS
+func KeyringAvailable() bool {
+	_, err := exec.LookPath(keyringTool())
+	return err == nil
+}
+
+func keyringTool() string {
+	if runtime.GOOS == "darwin" {
+		return "security"
+	}
+	return "secret-tool"
+}
+
+func errNoKeyring() error {
+	return fmt.Errorf("%s not found, it is needed for the keyring (libsecret-tools on Debian and Ubuntu, libsecret on Fedora and Arch)", keyringTool())
+}
+
+// KeyringGet returns the secret stored for service and account
+func KeyringGet(service, account string) (string, error) {
+	if !KeyringAvailable() {
+		return "", errNoKeyring()
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	secret := strings.TrimRight(stdout.String(), "\r\n")
+	switch {
+	case err == nil && secret != "":
+		return secret, nil
+	case err == nil, stderr.Len() == 0, strings.Contains(stderr.String(), "could not be found"):
+		// secret-tool exits with 1 and prints nothing when there is no secret
+		return "", ErrKeyringNotFound
+	}
+	return "", fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+}
+
+// KeyringSet stores secret for service and account, replacing the stored one
+func KeyringSet(service, account, label, secret string) error {
+	if !KeyringAvailable() {
+		return errNoKeyring()
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// security only takes the password as an argument
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-l", label, "-w", secret)
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label", label, "service", service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// KeyringDelete removes the secret stored for service and account
+func KeyringDelete(service, account string) error {
+	if _, err := KeyringGet(service, account); err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "delete-generic-password", "-s", service, "-a", account)
+	} else {
+		cmd = exec.Command("secret-tool", "clear", "service", service, "account", account)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -28,9 +29,38 @@ func TmuxCreateNewPane(target string) (string, error) {
 	return paneId, nil
 }
 
+// TmuxCreateNewPaneWithCommand splits the target window and runs command in dir instead of the default shell
+func TmuxCreateNewPaneWithCommand(target string, dir string, command []string) (string, error) {
+	args := []string{"split-window", "-d", "-h", "-t", target, "-c", dir, "-P", "-F", "#{pane_id}"}
+	args = append(args, command...)
+	cmd := exec.Command("tmux", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		logger.Error("Failed to create tmux pane with command %v: %v, stderr: %s", command, err, stderr.String())
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// TmuxKillPane closes the given pane
+func TmuxKillPane(paneId string) error {
+	cmd := exec.Command("tmux", "kill-pane", "-t", paneId)
+	if err := cmd.Run(); err != nil {
+		logger.Error("Failed to kill pane %s: %v", paneId, err)
+		return err
+	}
+	return nil
+}
+
 // TmuxPanesDetails gets details for all panes in a target window
 func TmuxPanesDetails(target string) ([]TmuxPaneDetails, error) {
-	cmd := exec.Command("tmux", "list-panes", "-t", target, "-F", "#{pane_id},#{pane_active},#{pane_pid},#{pane_current_command},#{history_size},#{history_limit}")
+	// pane_current_path goes last as it may contain commas
+	cmd := exec.Command("tmux", "list-panes", "-t", target, "-F", "#{pane_id},#{pane_active},#{pane_pid},#{pane_current_command},#{history_size},#{history_limit},#{pane_current_path}")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -55,8 +85,8 @@ func TmuxPanesDetails(target string) ([]TmuxPaneDetails, error) {
 			continue
 		}
 
-		parts := strings.SplitN(line, ",", 6)
-		if len(parts) < 5 {
+		parts := strings.SplitN(line, ",", 7)
+		if len(parts) < 7 {
 			logger.Error("Invalid pane details format for line: %s", line)
 			continue
 		}
@@ -81,6 +111,7 @@ func TmuxPanesDetails(target string) ([]TmuxPaneDetails, error) {
 			CurrentPid:         pid,
 			CurrentCommand:     parts[3],
 			CurrentCommandArgs: currentCommandArgs,
+			CurrentPath:        parts[6],
 			HistorySize:        historySize,
 			HistoryLimit:       historyLimit,
 			IsSubShell:         isSubShell,
@@ -202,3 +233,124 @@ func TmuxClearPane(paneId string) error {
 	logger.Debug("Successfully cleared pane %s", paneId)
 	return nil
 }
+
+// TmuxPipePane pipes new output of a pane to a shell command, an empty command stops the pipe.
+// An existing pipe of the pane is kept.
+func TmuxPipePane(paneId string, command string) error {
+	args := []string{"pipe-pane", "-t", paneId}
+	if command != "" {
+		args = append(args, "-o", command)
+	}
+	cmd := exec.Command("tmux", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.Error("Failed to pipe pane %s: %v, stderr: %s", paneId, err, stderr.String())
+		return fmt.Errorf("tmux pipe-pane %s: %w", paneId, err)
+	}
+	return nil
+}
+
+// TmuxPanePiped reports whether the pane output is already piped to a command
+func TmuxPanePiped(paneId string) (bool, error) {
+	output, err := exec.Command("tmux", "display-message", "-p", "-t", paneId, "#{pane_pipe}").Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to get pipe state of pane %s: %w", paneId, err)
+	}
+	return strings.TrimSpace(string(output)) == "1", nil
+}
+
+// TmuxDisplayMessage shows message in the status line of the clients attached to the pane's session
+func TmuxDisplayMessage(paneId string, message string) error {
+	// display-message expands formats, a literal # has to be doubled
+	message = strings.ReplaceAll(message, "#", "##")
+	cmd := exec.Command("tmux", "display-message", "-t", paneId, message)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("tmux display-message: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// TmuxPaneIds lists the pane ids of a target window, or of every window of the
+// target session when session is set
+func TmuxPaneIds(target string, session bool) ([]string, error) {
+	args := []string{"list-panes", "-t", target, "-F", "#{pane_id}"}
+	if session {
+		args = append(args, "-s")
+	}
+	cmd := exec.Command("tmux", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tmux list-panes %s: %w: %s", target, err, strings.TrimSpace(stderr.String()))
+	}
+	ids := strings.Fields(stdout.String())
+	if !session && strings.HasPrefix(target, "%") {
+		// a pane id targets the pane's window, keep only the pane itself
+		ids = slices.DeleteFunc(ids, func(id string) bool { return id != target })
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no panes found for target %s", target)
+	}
+	return ids, nil
+}
+
+// TmuxVersion returns the version of the tmux binary, e.g. "3.3a"
+func TmuxVersion() (string, error) {
+	output, err := exec.Command("tmux", "-V").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run tmux -V: %w", err)
+	}
+	version := strings.TrimSpace(string(output))
+	version = strings.TrimPrefix(version, "tmux ")
+	version = strings.TrimPrefix(version, "next-")
+	return version, nil
+}
+
+// TmuxDefaultShell returns the default-shell option of the tmux server, the shell of new panes
+func TmuxDefaultShell() (string, error) {
+	output, err := exec.Command("tmux", "show-options", "-gv", "default-shell").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tmux default-shell: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// TmuxUserOptions returns the user options starting with prefix, e.g. "@tmuxai_", which
+// apply to the pane target: global options, overridden by session and then window options
+func TmuxUserOptions(target string, prefix string) (map[string]string, error) {
+	options := make(map[string]string)
+	for _, scope := range [][]string{{"-g"}, {"-t", target}, {"-w", "-t", target}} {
+		args := append([]string{"show-options"}, scope...)
+		output, err := exec.Command("tmux", args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tmux options: %w", err)
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			name, value, _ := strings.Cut(line, " ")
+			if strings.HasPrefix(name, prefix) {
+				options[name] = unquoteTmuxValue(value)
+			}
+		}
+	}
+	return options, nil
+}
+
+// unquoteTmuxValue undoes the quoting of show-options, e.g. "a \"b\"" for a "b"
+func unquoteTmuxValue(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
@@ -10,6 +10,7 @@ type TmuxPaneDetails struct {
 	CurrentPid         int
 	CurrentCommand     string
 	CurrentCommandArgs string
+	CurrentPath        string
 	Content            string
 	Shell              string
 	OS                 string
@@ -19,6 +20,9 @@ type TmuxPaneDetails struct {
 	IsTmuxAiExecPane   bool
 	IsPrepared         bool
 	IsSubShell         bool
+	RemoteHost         string // host reported by the subshell probe
+	RemoteUser         string // user reported by the subshell probe
+	ContainerId        string // container or pod the subshell runs in
 	HistorySize        int
 	HistoryLimit       int
 }
@@ -49,7 +53,20 @@ func (p *TmuxPaneDetails) String() string {
 		fmt.Sprintf("TmuxAI Pane: %s\n", formatBool(p.IsTmuxAiPane)) +
 		fmt.Sprintf("TmuxAI Exec Pane: %s\n", formatBool(p.IsTmuxAiExecPane)) +
 		fmt.Sprintf("Prepared: %s\n", formatBool(p.IsPrepared)) +
-		fmt.Sprintf("Sub Shell: %s\n", formatBool(p.IsSubShell))
+		fmt.Sprintf("Sub Shell: %s\n", formatBool(p.IsSubShell)) +
+		p.remoteString(cyan, reset)
+}
+
+// remoteString formats the probed subshell details, empty for local panes
+func (p *TmuxPaneDetails) remoteString(color, reset string) string {
+	var s string
+	if p.RemoteUser != "" || p.RemoteHost != "" {
+		s += fmt.Sprintf("Remote: %s%s@%s%s\n", color, p.RemoteUser, p.RemoteHost, reset)
+	}
+	if p.ContainerId != "" {
+		s += fmt.Sprintf("Container: %s%s%s\n", color, p.ContainerId, reset)
+	}
+	return s
 }
 
 func (p *TmuxPaneDetails) FormatInfo(f *InfoFormatter) string {
@@ -93,6 +110,12 @@ func (p *TmuxPaneDetails) FormatInfo(f *InfoFormatter) string {
 	formatLine("Exec Pane", f.FormatBool(p.IsTmuxAiExecPane))
 	formatLine("Prepared", f.FormatBool(p.IsPrepared))
 	formatLine("Sub Shell", f.FormatBool(p.IsSubShell))
+	if p.RemoteHost != "" {
+		formatLine("Remote", p.RemoteUser+"@"+p.RemoteHost)
+	}
+	if p.ContainerId != "" {
+		formatLine("Container", p.ContainerId)
+	}
 
 	return builder.String()
 }
@@ -107,14 +107,16 @@ func HighlightCode(language string, code string) (string, error) {
 // IsShellCommand checks if the given command is a shell
 func IsShellCommand(command string) bool {
 	shellCommands := []string{
-		"bash", "zsh", "fish", "sh", "dash", "ksh", "csh", "tcsh",
+		"bash", "zsh", "fish", "sh", "dash", "ksh", "ksh93", "mksh", "csh", "tcsh",
+		"nu", "pwsh", "powershell", "xonsh",
 	}
 	return slices.Contains(shellCommands, command)
 }
 
 func IsSubShell(command string) bool {
 	subShellCommands := []string{
-		"ssh", "docker", "podman",
+		"ssh", "docker", "podman", "kubectl", "mosh", "mosh-client",
+		"lxc", "nsenter", "toolbox",
 	}
 	return slices.Contains(subShellCommands, command)
 }